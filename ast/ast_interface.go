@@ -1,6 +1,9 @@
 package ast
 
-import "io"
+import (
+	"go/token"
+	"io"
+)
 
 // PrintContext stores options used when printing a representation of an AST
 type PrintContext struct {
@@ -12,57 +15,117 @@ type PrintContext struct {
 type Node interface {
 	Print(level int, printContext *PrintContext)
 	Exec(context *ExecContext) *Variant
+	Position() token.Position
+}
+
+// Span is embedded in every node, recording the position of the node in the source.
+type Span struct {
+	Pos token.Position
+}
+
+// Position returns the position of the node in the source, which is invalid if unknown.
+func (s Span) Position() token.Position {
+	return s.Pos
+}
+
+// SetPosition records the position of the node in the source.
+func (s *Span) SetPosition(pos token.Position) {
+	s.Pos = pos
 }
 
-// StatementList represents a list of nodes to be executed sequentially.
+// position returns the position of node in the source, if node is not nil and its position is known.
+func position(node Node) token.Position {
+	if node == nil {
+		return token.Position{}
+	}
+	return node.Position()
+}
+
+// StatementList represents a list of nodes to be executed sequentially. Unless NoScope is set, the list is a block
+// and variables declared within it are not visible outside it. Layout is set on the body of a function by Resolve().
 type StatementList struct {
-	Stmts []Node
+	Span
+	Stmts   []Node
+	NoScope bool
+	Layout  *FrameLayout
+}
+
+// FrameLayout describes the frame of a function whose variables have been resolved by Resolve(). The parameters of
+// the function occupy the first slots of the frame, named by Params, followed by the variables declared by its body.
+type FrameLayout struct {
+	Params []string
+	Slots  int
 }
 
 // IntegerLiteral represents a literal whole number.
 type IntegerLiteral struct {
+	Span
 	Val int64
 }
 
 // StringLiteral represents a literal string.
 type StringLiteral struct {
+	Span
 	Str string
 }
 
 // BoolLiteral represents a literal boolean (true/false).
 type BoolLiteral struct {
+	Span
 	Val bool
 }
 
 // ArrayLiteral represents a composite of literals which initialize a variable.
 type ArrayLiteral struct {
+	Span
 	Type    ArrayType
 	Literal []Node
 }
 
+// SliceLiteral represents a composite of literals which initialize a slice.
+type SliceLiteral struct {
+	Span
+	Type    SliceType
+	Literal []Node
+}
+
 // StructLiteral represents a composite of named values which initialize a variable of type struct.
 type StructLiteral struct {
+	Span
 	Type   StructType
 	Values map[string]Node
 }
 
-// NilLiteral symbolizes an invalid construct, or simply a null value.
+// NilLiteral symbolizes an invalid construct, or simply a null value. Type is set if the type of the null value is
+// known, such as the zero value of an error.
 type NilLiteral struct {
+	Span
+	Type TypeKind
+}
+
+// TupleLiteral represents the values returned by a function with more than one result, or assigned by an assignment
+// with more than one operand on each side.
+type TupleLiteral struct {
+	Span
+	Values []Node
 }
 
 // ReturnStmt represents a short-circuit of linear StatementList execution, returning a value down to the function level.
 type ReturnStmt struct {
+	Span
 	Expr Node
 }
 
 // NamedSelector represents the fetch of a named set of data from the upstream data structure.
 type NamedSelector struct {
+	Span
 	Expr Node
 	Name string
 }
 
 // IfStmt represents conditional branching, evaluating a condition then taking various actions based on the result.
 type IfStmt struct {
+	Span
 	Conditional Node
 	Code        Node
 	Init        Node
@@ -71,6 +134,7 @@ type IfStmt struct {
 
 // ForStmt represents a loop, including an initializer, post-iteration code, and conditional.
 type ForStmt struct {
+	Span
 	Conditional   Node
 	Code          Node
 	Init          Node
@@ -78,14 +142,28 @@ type ForStmt struct {
 }
 
 // VariableReference represents the fetching of a value at runtime from a variable. If possible the runtime type
-// is inferred and stored in the structure for the sake of typechecking.
+// is inferred and stored in the structure for the sake of typechecking. Storage and Slot are set by Resolve().
 type VariableReference struct {
-	Name string
-	Type TypeKind
+	Span
+	Name    string
+	Type    TypeKind
+	Storage Storage
+	Slot    int
 }
 
+// Storage encapsulates where the variable named by a VariableReference is stored.
+type Storage int
+
+// Represents the possible storage of a variable.
+const (
+	StorageDynamic Storage = iota // looked up by name at runtime, as the variable has not been resolved
+	StorageLocal                  // in slot Slot of the frame of the function
+	StorageGlobal                 // in the global namespace
+)
+
 // BinaryOp represents a binary operation between two operands.
 type BinaryOp struct {
+	Span
 	LHS Node
 	RHS Node
 	Op  BinOpType
@@ -93,6 +171,7 @@ type BinaryOp struct {
 
 // UnaryOp represents a unary operation (EG: NOT or !), done on a single operand.
 type UnaryOp struct {
+	Span
 	Op   UnOpType
 	Expr Node
 }
@@ -107,6 +186,7 @@ const (
 
 // Subscript is a node representing the access of an index from a array/slice at runtime to retrieve a value.
 type Subscript struct {
+	Span
 	Subscript Node
 	Expr      Node
 }
@@ -132,13 +212,112 @@ const (
 
 // Assign represents storing a value into a variable construct at runtime.
 type Assign struct {
+	Span
 	Value    Node
 	Variable Node
 	NewLocal bool
 }
 
+// MultiAssign represents storing each value of a tuple into the corresponding variable, as in a, b = f(). Variables
+// are nil for values which are discarded, and NewLocal is set for each variable declared by the assignment.
+type MultiAssign struct {
+	Span
+	Value     Node
+	Variables []Node
+	NewLocal  []bool
+}
+
 // FunctionCall represents an invocation of a function type variant, with given values as arguments (or none).
 type FunctionCall struct {
+	Span
 	Function Node
 	Args     []Node
+	Spread   bool // set if the final argument is a slice passed as the variadic parameter, as in f(xs...)
 }
+
+// Name returns the name of the function called, as written at the call site.
+func (n *FunctionCall) Name() string {
+	return calleeName(n.Function)
+}
+
+func calleeName(n Node) string {
+	switch n := n.(type) {
+	case *VariableReference:
+		return n.Name
+	case *NamedSelector:
+		return calleeName(n.Expr) + "." + n.Name
+	}
+	return "func"
+}
+
+// GoStmt represents the invocation of a function on a new goroutine.
+type GoStmt struct {
+	Span
+	Call *FunctionCall
+}
+
+// SendStmt represents sending a value on a channel, blocking until the value is accepted.
+type SendStmt struct {
+	Span
+	Channel Node
+	Value   Node
+}
+
+// Receive represents receiving a value from a channel, blocking until a value is available or the channel is closed.
+// If WithOk is set, the result is a tuple of the value and whether it was sent, as in v, ok := <-ch.
+type Receive struct {
+	Span
+	Channel Node
+	WithOk  bool
+}
+
+// RangeStmt represents a loop over every element in an array, or every value received on a channel until it is closed.
+// Key and Value are nil if they are not used.
+type RangeStmt struct {
+	Span
+	Key      Node
+	Value    Node
+	NewLocal bool
+	Expr     Node
+	Code     Node
+}
+
+// SelectStmt represents waiting on a set of channel operations, executing the code for the first operation to proceed.
+type SelectStmt struct {
+	Span
+	Cases []SelectCase
+}
+
+// SelectCase represents a single communication clause in a SelectStmt. For receive operations, Target and OkTarget
+// are the (optional) variables which the received value and success boolean are stored in.
+type SelectCase struct {
+	IsDefault bool
+	IsSend    bool
+	Channel   Node
+	Value     Node
+	Target    Node
+	OkTarget  Node
+	NewLocal  bool
+	Code      Node
+}
+
+// BuiltinCall represents the invocation of a function built into the language, such as make() or close().
+// Type is the type operand of the builtin, if applicable.
+type BuiltinCall struct {
+	Span
+	Builtin BuiltinType
+	Type    TypeKind
+	Args    []Node
+	Spread  bool // set if the final argument is a slice whose elements are appended, as in append(xs, ys...)
+}
+
+// BuiltinType encapsulates the valid builtin functions for BuiltinCall.
+type BuiltinType int
+
+// Represents the possible builtin functions.
+const (
+	BuiltinMake BuiltinType = iota
+	BuiltinClose
+	BuiltinLen
+	BuiltinAppend
+)
@@ -1,9 +1,10 @@
 package ast
 
-import "fmt"
+import "strconv"
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *IntegerLiteral) Exec(context *ExecContext) *Variant {
+	context.Step(n)
 	return &Variant{
 		Type: PrimitiveTypeInt,
 		Int:  n.Val,
@@ -12,6 +13,7 @@ func (n *IntegerLiteral) Exec(context *ExecContext) *Variant {
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *BoolLiteral) Exec(context *ExecContext) *Variant {
+	context.Step(n)
 	return &Variant{
 		Type: PrimitiveTypeBool,
 		Bool: n.Val,
@@ -20,6 +22,7 @@ func (n *BoolLiteral) Exec(context *ExecContext) *Variant {
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *StringLiteral) Exec(context *ExecContext) *Variant {
+	context.Step(n)
 	return &Variant{
 		Type:   PrimitiveTypeString,
 		String: n.Str,
@@ -28,61 +31,113 @@ func (n *StringLiteral) Exec(context *ExecContext) *Variant {
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *NilLiteral) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	if n.Type != nil {
+		return &Variant{
+			Type: n.Type,
+		}
+	}
 	return &Variant{
 		Type: PrimitiveTypeUndefined,
 	}
 }
 
+// Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
+func (n *TupleLiteral) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	t := TupleType{}
+	ret := &Variant{}
+	for _, node := range n.Values {
+		v := node.Exec(context).Copy() //values are assigned or returned, so are copied
+		t.Types = append(t.Types, v.Type)
+		ret.VectorData = append(ret.VectorData, v)
+	}
+	ret.Type = t
+	return ret
+}
+
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *ArrayLiteral) Exec(context *ExecContext) *Variant {
-	sizeNode := n.Type.Len.Exec(context)
+	context.Step(n)
+	values, ok := n.Alloc(context, n.Type.Len.Exec(context))
+	if !ok {
+		return &Variant{Type: PrimitiveTypeUndefined}
+	}
+	for i, literal := range n.Literal {
+		values[i] = literal.Exec(context).Copy()
+	}
+
+	return &Variant{
+		Type:       ComplexTypeArray,
+		VectorData: values,
+	}
+}
+
+// Alloc returns the elements of the array, given sizeNode, the value of the length of its type. Elements not
+// initialized by the literal are undefined. False is returned if the length is invalid.
+func (n *ArrayLiteral) Alloc(context *ExecContext, sizeNode *Variant) ([]*Variant, bool) {
 	if sizeNode.Type != PrimitiveTypeInt {
-		context.Errors = append(context.Errors, ExecutionError{
+		context.Raise(ExecutionError{
 			Class:        TypeErr,
 			CreatingNode: n,
 			Text:         "Non-integer len used for array",
 		})
-		return &Variant{Type: PrimitiveTypeUndefined}
+		return nil, false
 	}
 
+	if sizeNode.Int < 0 {
+		context.Raise(ExecutionError{
+			Class:        BoundsErr,
+			CreatingNode: n,
+			Text:         "Negative len used for array",
+		})
+		return nil, false
+	}
+	context.reserve(n, vectorSize(sizeNode.Int))
 	var values = make([]*Variant, sizeNode.Int)
 	if len(values) != len(n.Literal) && len(n.Literal) != 0 {
-		context.Errors = append(context.Errors, ExecutionError{
+		context.Raise(ExecutionError{
 			Class:        BoundsErr,
 			CreatingNode: n,
 			Text:         "Literal used in array assignment does not match the size of the underlying array",
 		})
-		return &Variant{Type: PrimitiveTypeUndefined}
-	}
-
-	var i int
-	for ; i < len(n.Literal); i++ {
-		values[i] = n.Literal[i].Exec(context)
+		return nil, false
 	}
-	for ; i < len(values); i++ {
+	for i := len(n.Literal); i < len(values); i++ {
 		values[i] = &Variant{Type: PrimitiveTypeUndefined}
 	}
+	return values, true
+}
 
+// Exec resolves the values for the literals specified (if any).
+func (n *SliceLiteral) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	values := make([]*Variant, len(n.Literal))
+	for i, literal := range n.Literal {
+		values[i] = literal.Exec(context).Copy()
+	}
 	return &Variant{
-		Type:       ComplexTypeArray,
+		Type:       ComplexTypeSlice,
 		VectorData: values,
 	}
 }
 
 // Exec resolves the values for the literals specified (if any).
 func (n *StructLiteral) Exec(context *ExecContext) *Variant {
+	context.Step(n)
 	o := &Variant{
-		Type:      ComplexTypeStruct,
-		NamedData: map[string]*Variant{},
+		Type:           n.Type,
+		NamedData:      map[string]*Variant{},
+		EmbeddedFields: n.Type.EmbeddedFields(),
 	}
 	for _, field := range n.Type.Fields {
 		if n.Values != nil && n.Values[field.Ident] != nil {
-			o.NamedData[field.Ident] = n.Values[field.Ident].Exec(context)
+			o.NamedData[field.Ident] = n.Values[field.Ident].Exec(context).Copy()
 		} else {
 			var err error
-			o.NamedData[field.Ident], err = DefaultVariantValue(field.Type)
+			o.NamedData[field.Ident], err = context.DefaultValue(n, field.Type)
 			if err != nil {
-				context.Errors = append(context.Errors, ExecutionError{
+				context.Raise(ExecutionError{
 					Class:        InternalErr,
 					CreatingNode: n,
 					Text:         "Failed to create default value to populate field '" + field.Ident + "' with type: " + field.Type.String(),
@@ -95,9 +150,17 @@ func (n *StructLiteral) Exec(context *ExecContext) *Variant {
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *StatementList) Exec(context *ExecContext) *Variant {
+	if n.Layout != nil && context.Locals == nil {
+		return n.enter(context)
+	}
+	context.Step(n)
 	callingContext := (*context)
 	newContext := callingContext
 	newContext.IsFuncContext = false
+	if !callingContext.IsFuncContext && !n.NoScope { // the body of a function shares the scope of its parameters
+		newContext.pushScope()
+		defer newContext.popScope()
+	}
 
 	for _, node := range n.Stmts {
 		v := node.Exec(&newContext)
@@ -117,8 +180,25 @@ func (n *StatementList) Exec(context *ExecContext) *Variant {
 	}
 }
 
+// enter executes the body of a resolved function without a frame, as the entry point of a program started with
+// ExecMain(). The arguments of the function are taken from context.FunctionNamespace.
+func (n *StatementList) enter(context *ExecContext) *Variant {
+	frameContext := *context
+	frameContext.Locals = make([]*Variant, n.Layout.Slots)
+	for i, name := range n.Layout.Params {
+		if name != "" {
+			frameContext.Locals[i] = context.FunctionNamespace[name]
+		}
+	}
+	ret := n.Exec(&frameContext)
+	frameContext.releaseFrame(frameContext.Locals)
+	context.Errors = frameContext.Errors
+	return ret
+}
+
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *ReturnStmt) Exec(context *ExecContext) *Variant {
+	context.Step(n)
 	v := n.Expr.Exec(context)
 	temp := *v
 	temp.IsReturn = true
@@ -127,11 +207,22 @@ func (n *ReturnStmt) Exec(context *ExecContext) *Variant {
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *BinaryOp) Exec(context *ExecContext) *Variant {
-	l := n.LHS.Exec(context)
-	r := n.RHS.Exec(context)
+	context.Step(n)
+	return n.Apply(context, n.LHS.Exec(context), n.RHS.Exec(context))
+}
+
+// Apply performs the operation on l and r, the values of its operands.
+func (n *BinaryOp) Apply(context *ExecContext, l, r *Variant) *Variant {
 	ret := Variant{
 		Type: PrimitiveTypeUndefined,
 	}
+	if _, isNil := n.RHS.(*NilLiteral); isNil {
+		return compareNil(context, n, l)
+	}
+	if _, isNil := n.LHS.(*NilLiteral); isNil {
+		return compareNil(context, n, r)
+	}
+
 	if l.Type == PrimitiveTypeInt && r.Type == PrimitiveTypeInt {
 		ret.Type = PrimitiveTypeInt
 		switch n.Op {
@@ -141,10 +232,22 @@ func (n *BinaryOp) Exec(context *ExecContext) *Variant {
 			ret.Int = l.Int - r.Int
 		case BinOpMul:
 			ret.Int = l.Int * r.Int
-		case BinOpDiv:
-			ret.Int = l.Int / r.Int
-		case BinOpMod:
-			ret.Int = l.Int % r.Int
+		case BinOpDiv, BinOpMod:
+			if r.Int == 0 {
+				context.Raise(ExecutionError{
+					Class:        DivideByZeroErr,
+					CreatingNode: n,
+					Text:         "Integer divide by zero",
+				})
+				return &Variant{
+					Type: PrimitiveTypeUndefined,
+				}
+			}
+			if n.Op == BinOpDiv {
+				ret.Int = l.Int / r.Int
+			} else {
+				ret.Int = l.Int % r.Int
+			}
 		case BinOpEquality:
 			ret.Type = PrimitiveTypeBool
 			ret.Bool = l.Int == r.Int
@@ -156,6 +259,7 @@ func (n *BinaryOp) Exec(context *ExecContext) *Variant {
 		ret.Type = PrimitiveTypeString
 		switch n.Op {
 		case BinOpAdd:
+			context.reserve(n, len(l.String)+len(r.String))
 			ret.String = l.String + r.String
 		case BinOpEquality:
 			ret.Type = PrimitiveTypeBool
@@ -165,7 +269,7 @@ func (n *BinaryOp) Exec(context *ExecContext) *Variant {
 			ret.Bool = l.String != r.String
 		default:
 			ret.Type = PrimitiveTypeUndefined
-			context.Errors = append(context.Errors, ExecutionError{
+			context.Raise(ExecutionError{
 				Class:        TypeErr,
 				CreatingNode: n,
 				Text:         "Invalid operation for string operands: " + n.Op.String(),
@@ -175,7 +279,7 @@ func (n *BinaryOp) Exec(context *ExecContext) *Variant {
 		ret.Type = PrimitiveTypeBool
 		switch n.Op {
 		case BinOpEquality:
-			ret.Bool = l.Bool && r.Bool
+			ret.Bool = l.Bool == r.Bool
 		case BinOpNotEquality:
 			ret.Bool = l.Bool != r.Bool
 		case BinOpLAnd:
@@ -184,14 +288,44 @@ func (n *BinaryOp) Exec(context *ExecContext) *Variant {
 			ret.Bool = l.Bool || r.Bool
 		default:
 			ret.Type = PrimitiveTypeUndefined
-			context.Errors = append(context.Errors, ExecutionError{
+			context.Raise(ExecutionError{
 				Class:        TypeErr,
 				CreatingNode: n,
 				Text:         "Invalid operation for boolean operands: " + n.Op.String(),
 			})
 		}
+	} else if isErrorOrNil(l) && isErrorOrNil(r) && (l.Type.Kind() == PrimitiveTypeError || r.Type.Kind() == PrimitiveTypeError) {
+		ret.Type = PrimitiveTypeBool
+		switch n.Op {
+		case BinOpEquality:
+			ret.Bool = ErrorsEqual(l.ErrorData, r.ErrorData)
+		case BinOpNotEquality:
+			ret.Bool = !ErrorsEqual(l.ErrorData, r.ErrorData)
+		default:
+			ret.Type = PrimitiveTypeUndefined
+			context.Raise(ExecutionError{
+				Class:        TypeErr,
+				CreatingNode: n,
+				Text:         "Invalid operation for error operands: " + n.Op.String(),
+			})
+		}
+	} else if l.Type.Kind() == r.Type.Kind() && isComparableKind(l.Type.Kind()) {
+		ret.Type = PrimitiveTypeBool
+		switch n.Op {
+		case BinOpEquality:
+			ret.Bool = l.Equal(r)
+		case BinOpNotEquality:
+			ret.Bool = !l.Equal(r)
+		default:
+			ret.Type = PrimitiveTypeUndefined
+			context.Raise(ExecutionError{
+				Class:        TypeErr,
+				CreatingNode: n,
+				Text:         "Invalid operation for " + l.Type.Kind().String() + " operands: " + n.Op.String(),
+			})
+		}
 	} else {
-		context.Errors = append(context.Errors, ExecutionError{
+		context.Raise(ExecutionError{
 			Class:        TypeErr,
 			CreatingNode: n,
 			Text:         "Invalid types for operands: " + l.Type.String() + " and " + r.Type.String(),
@@ -202,46 +336,115 @@ func (n *BinaryOp) Exec(context *ExecContext) *Variant {
 	return &ret
 }
 
+// isErrorOrNil returns true if v is an error, or a nil value which may be compared with an error.
+func isErrorOrNil(v *Variant) bool {
+	return v.Type.Kind() == PrimitiveTypeError || (v.Type == PrimitiveTypeUndefined && !v.VariableReferenceFailed)
+}
+
+// compareNil evaluates the comparison n, where v is compared with the nil literal. Errors, slices, channels and handles
+// can be compared with nil.
+func compareNil(context *ExecContext, n *BinaryOp, v *Variant) *Variant {
+	var isNil bool
+	switch v.Type.Kind() {
+	case PrimitiveTypeUndefined:
+		isNil = !v.VariableReferenceFailed
+	case PrimitiveTypeError:
+		isNil = v.ErrorData == nil
+	case ComplexTypeSlice:
+		isNil = v.VectorData == nil
+	case ComplexTypeChannel:
+		isNil = v.ChannelData == nil
+	case ComplexTypeHandle:
+		isNil = v.HandleData == nil
+	default:
+		context.Raise(ExecutionError{
+			Class:        TypeErr,
+			CreatingNode: n,
+			Text:         "Cannot compare type " + v.Type.String() + " with nil",
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+
+	switch n.Op {
+	case BinOpEquality:
+		return &Variant{Type: PrimitiveTypeBool, Bool: isNil}
+	case BinOpNotEquality:
+		return &Variant{Type: PrimitiveTypeBool, Bool: !isNil}
+	}
+	context.Raise(ExecutionError{
+		Class:        TypeErr,
+		CreatingNode: n,
+		Text:         "Invalid operation for nil operand: " + n.Op.String(),
+	})
+	return &Variant{
+		Type: PrimitiveTypeUndefined,
+	}
+}
+
+// isComparableKind returns true if values of composite kind k can be compared with == and !=.
+func isComparableKind(k TypeKindDescription) bool {
+	switch k {
+	case ComplexTypeArray, ComplexTypeStruct, ComplexTypeChannel, ComplexTypeHandle:
+		return true
+	}
+	return false
+}
+
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *VariableReference) Exec(context *ExecContext) *Variant {
-	if v, ok := context.FunctionNamespace[n.Name]; ok {
-		return v
-	}
-	if context.GlobalNamespace != nil {
-		if v, ok := context.GlobalNamespace[n.Name]; ok {
+	context.Step(n)
+	switch n.Storage {
+	case StorageLocal:
+		if v := context.Locals[n.Slot]; v != nil {
+			return v
+		}
+	case StorageGlobal:
+		if v := context.GlobalNamespace[n.Name]; v != nil {
+			return v
+		}
+	default:
+		if v, _ := context.lookup(n.Name); v != nil {
 			return v
 		}
 	}
 	return &Variant{
-		Type: PrimitiveTypeUndefined,
+		Type:                    PrimitiveTypeUndefined,
 		VariableReferenceFailed: true,
 	}
 }
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *Assign) Exec(context *ExecContext) *Variant {
+	context.Step(n)
 	variable := n.Variable.Exec(context)
 	v := n.Value.Exec(context)
-	if ident, ok := n.Variable.(*VariableReference); ok {
-		if n.NewLocal || v.VariableReferenceFailed {
-			context.FunctionNamespace.Save(ident.Name, v)
-		} else {
-			if _, ok := context.FunctionNamespace[ident.Name]; ok && context.IsFuncContext {
-				context.FunctionNamespace.Save(ident.Name, v)
-			} else if _, ok := context.GlobalNamespace[ident.Name]; ok {
-				context.GlobalNamespace.Save(ident.Name, v)
-			} else {
-				if context.IsFuncContext {
-					context.FunctionNamespace.Save(ident.Name, v)
-				} else {
-					context.GlobalNamespace.Save(ident.Name, v)
-				}
-			}
+	storeVariant(context, n.Variable, variable, v, n.NewLocal)
+
+	return &Variant{
+		Type: PrimitiveTypeUndefined,
+	}
+}
+
+// Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
+func (n *MultiAssign) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	v := n.Value.Exec(context)
+	if v.Type.Kind() != ComplexTypeTuple || len(v.VectorData) != len(n.Variables) {
+		context.Raise(ExecutionError{
+			Class:        TypeErr,
+			CreatingNode: n,
+			Text:         "Assignment mismatch: " + strconv.Itoa(len(n.Variables)) + " variables but value has type " + v.Type.String(),
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+	for i, variable := range n.Variables {
+		if variable != nil {
+			storeVariant(context, variable, variable.Exec(context), v.VectorData[i], n.NewLocal[i])
 		}
-	} else {
-		newValue := *v
-		newValue.IsReturn = false
-		*variable = newValue
 	}
 
 	return &Variant{
@@ -249,9 +452,49 @@ func (n *Assign) Exec(context *ExecContext) *Variant {
 	}
 }
 
+// storeVariant saves v into the variable represented by node, where variable is the result of executing node.
+func storeVariant(context *ExecContext, node Node, variable *Variant, v *Variant, newLocal bool) {
+	ident, ok := node.(*VariableReference)
+	if !ok {
+		context.Replace(node, variable, v)
+		*variable = *v.Copy()
+		return
+	}
+	switch ident.Storage {
+	case StorageLocal:
+		context.Replace(node, context.Locals[ident.Slot], v)
+		context.Locals[ident.Slot] = v.Copy()
+	case StorageGlobal:
+		context.Replace(node, context.GlobalNamespace[ident.Name], v)
+		context.GlobalNamespace.Save(ident.Name, v)
+	default:
+		ns := context.namespaceOf(ident.Name, v, newLocal)
+		context.Replace(node, ns[ident.Name], v)
+		ns.Save(ident.Name, v)
+	}
+}
+
+// namespaceOf returns the namespace which v is stored in when assigned to the named variable, which has not been
+// resolved. The variable is declared in the innermost scope if newLocal is set or v is undefined, and otherwise
+// assigned wherever it is found.
+func (context *ExecContext) namespaceOf(name string, v *Variant, newLocal bool) Namespace {
+	switch _, found := context.lookup(name); {
+	case newLocal || v.VariableReferenceFailed:
+		return context.localNamespace()
+	case found != nil:
+		return found
+	case context.IsFuncContext:
+		return context.FunctionNamespace
+	}
+	return context.GlobalNamespace
+}
+
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *IfStmt) Exec(context *ExecContext) *Variant {
+	context.Step(n)
 	if n.Init != nil {
+		context.pushScope()
+		defer context.popScope()
 		n.Init.Exec(context)
 	}
 
@@ -269,14 +512,17 @@ func (n *IfStmt) Exec(context *ExecContext) *Variant {
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *ForStmt) Exec(context *ExecContext) *Variant {
+	context.Step(n)
 	if n.Init != nil {
+		context.pushScope()
+		defer context.popScope()
 		n.Init.Exec(context)
 	}
 
 	conditionResult := n.Conditional.Exec(context)
 	for true {
 		if conditionResult.Type != PrimitiveTypeBool {
-			context.Errors = append(context.Errors, ExecutionError{
+			context.Raise(ExecutionError{
 				Class:        TypeErr,
 				CreatingNode: n,
 				Text:         "Non-bool used as loop conditional: " + conditionResult.Type.String(),
@@ -286,7 +532,9 @@ func (n *ForStmt) Exec(context *ExecContext) *Variant {
 			}
 		}
 		if conditionResult.Bool {
-			n.Code.Exec(context)
+			if r := n.Code.Exec(context); r.IsReturn {
+				return r
+			}
 			if n.PostIteration != nil {
 				n.PostIteration.Exec(context)
 			}
@@ -303,7 +551,12 @@ func (n *ForStmt) Exec(context *ExecContext) *Variant {
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *UnaryOp) Exec(context *ExecContext) *Variant {
-	upper := n.Expr.Exec(context)
+	context.Step(n)
+	return n.Apply(context, n.Expr.Exec(context))
+}
+
+// Apply performs the operation on upper, the value of its operand.
+func (n *UnaryOp) Apply(context *ExecContext, upper *Variant) *Variant {
 	if upper.Type == PrimitiveTypeBool {
 		switch n.Op {
 		case UnOpNot:
@@ -312,14 +565,14 @@ func (n *UnaryOp) Exec(context *ExecContext) *Variant {
 				Bool: !upper.Bool,
 			}
 		default:
-			context.Errors = append(context.Errors, ExecutionError{
+			context.Raise(ExecutionError{
 				Class:        TypeErr,
 				CreatingNode: n,
 				Text:         "Cannot perform boolean unary operation on " + upper.Type.String(),
 			})
 		}
 	} else {
-		context.Errors = append(context.Errors, ExecutionError{
+		context.Raise(ExecutionError{
 			Class:        TypeErr,
 			CreatingNode: n,
 			Text:         "Cannot perform unary operations on type " + upper.Type.String(),
@@ -332,11 +585,15 @@ func (n *UnaryOp) Exec(context *ExecContext) *Variant {
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *Subscript) Exec(context *ExecContext) *Variant {
-	baseVar := n.Expr.Exec(context)
-	subscript := n.Subscript.Exec(context)
+	context.Step(n)
+	return n.Apply(context, n.Expr.Exec(context), n.Subscript.Exec(context))
+}
+
+// Apply returns the element of baseVar at index subscript, which may be assigned to set the element.
+func (n *Subscript) Apply(context *ExecContext, baseVar, subscript *Variant) *Variant {
 
 	if baseVar.VariableReferenceFailed {
-		context.Errors = append(context.Errors, ExecutionError{
+		context.Raise(ExecutionError{
 			Class:        NotFoundErr,
 			CreatingNode: n,
 			Text:         "Could not resolve a value/variable for base data of type " + baseVar.Type.String(),
@@ -346,8 +603,8 @@ func (n *Subscript) Exec(context *ExecContext) *Variant {
 		}
 	}
 
-	if baseVar.Type != ComplexTypeArray {
-		context.Errors = append(context.Errors, ExecutionError{
+	if baseVar.Type.Kind() != ComplexTypeArray && baseVar.Type.Kind() != ComplexTypeSlice {
+		context.Raise(ExecutionError{
 			Class:        TypeErr,
 			CreatingNode: n,
 			Text:         "Cannot perform subscript operation on type " + baseVar.Type.String(),
@@ -357,7 +614,7 @@ func (n *Subscript) Exec(context *ExecContext) *Variant {
 		}
 	}
 	if subscript.Type != PrimitiveTypeInt {
-		context.Errors = append(context.Errors, ExecutionError{
+		context.Raise(ExecutionError{
 			Class:        TypeErr,
 			CreatingNode: n,
 			Text:         "Cannot perform subscript operation on type " + baseVar.Type.String(),
@@ -366,8 +623,8 @@ func (n *Subscript) Exec(context *ExecContext) *Variant {
 			Type: PrimitiveTypeUndefined,
 		}
 	}
-	if int(subscript.Int) >= len(baseVar.VectorData) {
-		context.Errors = append(context.Errors, ExecutionError{
+	if subscript.Int < 0 || subscript.Int >= int64(len(baseVar.VectorData)) {
+		context.Raise(ExecutionError{
 			Class:        BoundsErr,
 			CreatingNode: n,
 			Text:         "Subscript out of bounds",
@@ -382,10 +639,21 @@ func (n *Subscript) Exec(context *ExecContext) *Variant {
 
 // Exec carries out node-specific logic, which may include evaluation of subnodes and primitive operations depending on the nodes type.
 func (n *NamedSelector) Exec(context *ExecContext) *Variant {
-	baseVar := n.Expr.Exec(context)
+	context.Step(n)
+	return n.Apply(context, n.Expr.Exec(context))
+}
+
+// Apply returns the field or method of baseVar selected by the node. Fields may be assigned to set the field.
+func (n *NamedSelector) Apply(context *ExecContext, baseVar *Variant) *Variant {
+	if baseVar.Type.Kind() == PrimitiveTypeError {
+		return errorMethod(context, n, baseVar)
+	}
+	if handle, isHandle := baseVar.Type.(HandleType); isHandle {
+		return handleMethod(context, n, handle, baseVar)
+	}
 
-	if baseVar.Type.Kind() != ComplexTypeStruct {
-		context.Errors = append(context.Errors, ExecutionError{
+	if baseVar.Type.Kind() != ComplexTypeStruct && baseVar.Type.Kind() != ComplexTypePackage {
+		context.Raise(ExecutionError{
 			Class:        TypeErr,
 			CreatingNode: n,
 			Text:         "Cannot perform named selection operation on type " + baseVar.Type.String(),
@@ -395,11 +663,22 @@ func (n *NamedSelector) Exec(context *ExecContext) *Variant {
 		}
 	}
 
-	if v, ok := baseVar.NamedData[n.Name]; ok {
+	v, ambiguous := baseVar.SelectField(n.Name)
+	if v != nil {
 		return v
 	}
+	if ambiguous {
+		context.Raise(ExecutionError{
+			Class:        NotFoundErr,
+			CreatingNode: n,
+			Text:         "Ambiguous selector " + n.Name,
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
 
-	context.Errors = append(context.Errors, ExecutionError{
+	context.Raise(ExecutionError{
 		Class:        NotFoundErr,
 		CreatingNode: n,
 		Text:         "Cannot find named element " + n.Name,
@@ -409,34 +688,623 @@ func (n *NamedSelector) Exec(context *ExecContext) *Variant {
 	}
 }
 
+// errorMethod returns the method selected by n from the error err. The only method of an error is Error(), which
+// returns the text of the error.
+func errorMethod(context *ExecContext, n *NamedSelector, err *Variant) *Variant {
+	if n.Name != "Error" {
+		context.Raise(ExecutionError{
+			Class:        NotFoundErr,
+			CreatingNode: n,
+			Text:         "Cannot find method " + n.Name + " of type error",
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+	if err.ErrorData == nil {
+		context.Raise(ExecutionError{
+			Class:        NilErr,
+			CreatingNode: n,
+			Text:         "Cannot call method Error on a nil error",
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+	text := err.ErrorData.Error()
+	return &Variant{
+		Type: FunctionType{
+			ReturnType: PrimitiveTypeString,
+			Native: func(context *ExecContext, node Node, args []*Variant) *Variant {
+				return MakeVariant(text)
+			},
+		},
+	}
+}
+
+// handleMethod returns the method selected by n from the handle h, of type t. The method is bound to h, so it is called
+// with h as its receiver.
+func handleMethod(context *ExecContext, n *NamedSelector, t HandleType, h *Variant) *Variant {
+	method, ok := t.Methods[n.Name]
+	if !ok {
+		context.Raise(ExecutionError{
+			Class:        NotFoundErr,
+			CreatingNode: n,
+			Text:         "Cannot find method " + n.Name + " of type " + t.Name,
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+	if h.HandleData == nil {
+		context.Raise(ExecutionError{
+			Class:        NilErr,
+			CreatingNode: n,
+			Text:         "Cannot call method " + n.Name + " on a nil " + t.Name,
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+
+	fnType, _ := FunctionTypeOf(method.Type) //registered by the host as a function
+	bound := fnType
+	bound.Parameters = fnType.Parameters[1:]
+	bound.Native = func(context *ExecContext, node Node, args []*Variant) *Variant {
+		return context.CallFunction(node, t.Name+"."+n.Name, method, append([]*Variant{h}, args...))
+	}
+	return &Variant{
+		Type: bound,
+	}
+}
+
 // Exec represents the invocation of the FunctionCall - with the function pointer and arguments resolved from the contained nodes.
 func (n *FunctionCall) Exec(context *ExecContext) *Variant {
-	fmt.Println(context.GlobalNamespace)
+	context.Step(n)
+	functionPointer, args, ok := n.resolve(context)
+	if !ok {
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+	return context.CallFunction(n, n.Name(), functionPointer, args)
+}
 
+// resolve evaluates the function pointer and arguments of the call. False is returned if the call cannot proceed.
+func (n *FunctionCall) resolve(context *ExecContext) (*Variant, []*Variant, bool) {
 	functionPointer := n.Function.Exec(context)
-	if functionPointer.Type.Kind() != ComplexTypeFunction {
-		context.Errors = append(context.Errors, ExecutionError{
+	if !n.Callee(context, functionPointer) {
+		return nil, nil, false
+	}
+
+	args := make([]*Variant, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.Exec(context)
+	}
+	args, ok := n.Bind(context, functionPointer, args)
+	return functionPointer, args, ok
+}
+
+// Callee checks that functionPointer, the value of the function of the call, can be called.
+func (n *FunctionCall) Callee(context *ExecContext, functionPointer *Variant) bool {
+	if _, ok := FunctionTypeOf(functionPointer.Type); !ok {
+		context.Raise(ExecutionError{
+			Class:        TypeErr,
+			CreatingNode: n,
+			Text:         "Cannot call non-function type: " + functionPointer.Type.String(),
+		})
+		return false
+	}
+	return true
+}
+
+// Bind returns the arguments functionPointer is called with, given args, the values of the arguments of the call.
+// Trailing arguments to a variadic function are collected into a slice. False is returned if the call cannot proceed.
+func (n *FunctionCall) Bind(context *ExecContext, functionPointer *Variant, args []*Variant) ([]*Variant, bool) {
+	fnType, _ := FunctionTypeOf(functionPointer.Type)
+	if n.Spread && !fnType.Variadic {
+		context.Raise(ExecutionError{
 			Class:        TypeErr,
 			CreatingNode: n,
+			Text:         "Cannot spread arguments to non-variadic function",
+		})
+		return nil, false
+	}
+	if fnType.Variadic && !n.Spread {
+		// trailing arguments are collected into a slice for the final parameter.
+		fixed := len(fnType.Parameters) - 1
+		if len(args) < fixed || fixed < 0 {
+			context.Raise(ExecutionError{
+				Class:        TypeErr,
+				CreatingNode: n,
+				Text:         "Not enough arguments in call to variadic function",
+			})
+			return nil, false
+		}
+		variadic := &Variant{Type: ComplexTypeSlice}
+		for _, arg := range args[fixed:] {
+			variadic.VectorData = append(variadic.VectorData, arg.Copy())
+		}
+		args = append(args[:fixed], variadic)
+	}
+	return args, true
+}
+
+// FunctionTypeOf returns the signature of functions of type t, which may be a named function type. False is returned if
+// t is not a function type.
+func FunctionTypeOf(t TypeKind) (FunctionType, bool) {
+	if named, isNamed := t.(NamedType); isNamed {
+		return FunctionTypeOf(named.Type)
+	}
+	fnType, ok := t.(FunctionType)
+	return fnType, ok
+}
+
+// CallFunction executes the code of the given function variant with the given arguments, returning the result. node
+// is the call which invoked the function, and name the name of the function as written by the call. The function
+// executes in the globals of the package which declared it, in a new frame of the call stack.
+func (context *ExecContext) CallFunction(node Node, name string, functionPointer *Variant, args []*Variant) *Variant {
+	fnType, ok := FunctionTypeOf(functionPointer.Type)
+	if !ok {
+		context.Raise(ExecutionError{
+			Class:        TypeErr,
+			CreatingNode: node,
 			Text:         "Cannot call non-function type: " + functionPointer.Type.String(),
 		})
 		return &Variant{
 			Type: PrimitiveTypeUndefined,
 		}
 	}
+	if fnType.Native == nil && fnType.Code == nil {
+		context.Raise(ExecutionError{
+			Class:        NilErr,
+			CreatingNode: node,
+			Text:         "Call of nil function " + name,
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+	if len(args) != len(fnType.Parameters) {
+		context.Raise(ExecutionError{
+			Class:        TypeErr,
+			CreatingNode: node,
+			Text:         "Incorrect number of arguments: expected " + strconv.Itoa(len(fnType.Parameters)) + ", got " + strconv.Itoa(len(args)),
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+	if native := fnType.Native; native != nil {
+		copies := make([]*Variant, len(args))
+		for i, arg := range args {
+			copies[i] = arg.Copy() //arguments are passed by value
+		}
+		return native(context, node, copies)
+	}
+	frame, ok := context.PushFrame(node, name)
+	if !ok {
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
 
-	fn := map[string]*Variant{}
+	globals := context.GlobalNamespace
+	if functionPointer.Globals != nil {
+		globals = functionPointer.Globals
+	}
 	execContext := &ExecContext{
-		IsFuncContext:     true,
-		FunctionNamespace: fn,
-		GlobalNamespace:   context.GlobalNamespace,
+		IsFuncContext:   true,
+		GlobalNamespace: globals,
+		Scheduler:       context.Scheduler,
+		Output:          context.Output,
+		Stack:           frame,
+	}
+	var ret *Variant
+	if body, resolved := fnType.Code.(*StatementList); resolved && body.Layout != nil {
+		execContext.Locals = make([]*Variant, body.Layout.Slots)
+		for i, arg := range args {
+			execContext.Locals[i] = arg.Copy() //arguments are passed by value
+		}
+		ret = body.Exec(execContext)
+		execContext.releaseFrame(execContext.Locals)
+	} else {
+		fn := map[string]*Variant{}
+		for i, paramNode := range fnType.Parameters {
+			if nt, named := paramNode.(NamedType); named { //unnamed parameters cannot be referenced
+				fn[nt.Ident] = args[i].Copy() //arguments are passed by value
+			}
+		}
+		execContext.FunctionNamespace = fn
+		ret = fnType.Code.Exec(execContext)
+		execContext.release(fn)
+	}
+	traceErrors(execContext.Errors, execContext.Stack)
+	context.Errors = append(context.Errors, execContext.Errors...)
+	if ret.IsReturn { // the return has reached the function boundary
+		temp := *ret
+		temp.IsReturn = false
+		return &temp
+	}
+	return ret
+}
+
+// PushFrame returns a new innermost frame for a call of the named function by node. False is returned if the frame
+// would exceed the maximum depth of the call stack, in which case a StackOverflowErr aborts the program.
+func (context *ExecContext) PushFrame(node Node, name string) (*Frame, bool) {
+	frame := context.Stack.push(name, node)
+	if depth, max := frame.Depth, context.maxDepth(); depth > max {
+		err := ExecutionError{
+			Class:        StackOverflowErr,
+			CreatingNode: node,
+			Text:         "Maximum call depth of " + strconv.Itoa(max) + " exceeded",
+			Stack:        context.Stack.Trace(),
+		}
+		if s := context.Scheduler; s != nil && s.canAbort() {
+			s.abort(err)
+		}
+		context.Errors = append(context.Errors, err)
+		return nil, false
+	}
+	return frame, true
+}
+
+// Call invokes the function fn with args, as if it were called by node. It allows native functions to call functions
+// which are passed to them as arguments.
+func (context *ExecContext) Call(node Node, fn *Variant, args ...*Variant) *Variant {
+	if _, ok := FunctionTypeOf(fn.Type); !ok {
+		context.Raise(ExecutionError{
+			Class:        TypeErr,
+			CreatingNode: node,
+			Text:         "Cannot call non-function type: " + fn.Type.String(),
+		})
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+	return context.CallFunction(node, "func", fn, args)
+}
+
+// Exec starts a new goroutine, which invokes the function call with arguments resolved on the calling goroutine.
+func (n *GoStmt) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	functionPointer, args, ok := n.Call.resolve(context)
+	if ok {
+		s := context.scheduler()
+		globals, output := context.GlobalNamespace, context.Output
+		s.spawn(func() []ExecutionError {
+			goroutineContext := &ExecContext{
+				GlobalNamespace: globals,
+				Scheduler:       s,
+				Output:          output,
+			}
+			goroutineContext.CallFunction(n.Call, n.Call.Name(), functionPointer, args)
+			return goroutineContext.Errors
+		})
+	}
+
+	return &Variant{
+		Type: PrimitiveTypeUndefined,
+	}
+}
+
+// checkChannel adds an error to context if v is not a channel, returning true if it is.
+func checkChannel(context *ExecContext, n Node, v *Variant) bool {
+	if v.Type.Kind() != ComplexTypeChannel {
+		context.Raise(ExecutionError{
+			Class:        TypeErr,
+			CreatingNode: n,
+			Text:         "Cannot perform channel operation on type " + v.Type.String(),
+		})
+		return false
+	}
+	return true
+}
+
+// Exec sends the value on the channel, blocking the goroutine until it is accepted.
+func (n *SendStmt) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	ch := n.Channel.Exec(context)
+	v := n.Value.Exec(context)
+	if checkChannel(context, n, ch) {
+		_, _, _, err := context.scheduler().communicate(n, []commOp{{ch: ch.ChannelData, send: true, value: v}}, true)
+		if err != nil {
+			context.Raise(*err)
+		}
+	}
+
+	return &Variant{
+		Type: PrimitiveTypeUndefined,
+	}
+}
+
+// Exec receives a value from the channel, blocking the goroutine until one is available or the channel is closed.
+func (n *Receive) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	ch := n.Channel.Exec(context)
+	if checkChannel(context, n, ch) {
+		_, v, ok, err := context.scheduler().communicate(n, []commOp{{ch: ch.ChannelData}}, true)
+		if err == nil && n.WithOk {
+			return &Variant{
+				Type:       TupleType{Types: []TypeKind{v.Type, PrimitiveTypeBool}},
+				VectorData: []*Variant{v, MakeVariant(ok)},
+			}
+		}
+		if err == nil {
+			return v
+		}
+		context.Raise(*err)
+	}
+
+	return &Variant{
+		Type: PrimitiveTypeUndefined,
+	}
+}
+
+// Exec runs the loop body for every element in an array, or every value received on a channel until it is closed.
+func (n *RangeStmt) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	base, ok := n.Range(context, n.Expr.Exec(context))
+	for i := 0; ok; i++ {
+		var key, value *Variant
+		if key, value, ok = n.Next(context, base, i); ok {
+			if r := n.iterate(context, key, value); r.IsReturn {
+				return r
+			}
+		}
+	}
+
+	return &Variant{
+		Type: PrimitiveTypeUndefined,
 	}
+}
+
+// Range returns the value iterated over by the loop, given base, the value of its range expression. The range
+// expression is evaluated once, so arrays are copied. False is returned if base cannot be ranged over.
+func (n *RangeStmt) Range(context *ExecContext, base *Variant) (*Variant, bool) {
+	switch base.Type.Kind() {
+	case ComplexTypeChannel:
+		return base, true
+	case ComplexTypeArray, ComplexTypeSlice:
+		return base.Copy(), true
+	}
+	context.Raise(ExecutionError{
+		Class:        TypeErr,
+		CreatingNode: n,
+		Text:         "Cannot range over type " + base.Type.String(),
+	})
+	return base, false
+}
+
+// Next returns the key and value of iteration i of the loop over base, the value returned by Range(). Ranging over a
+// channel receives the key from it, blocking until a value is sent. False is returned once the loop is done.
+func (n *RangeStmt) Next(context *ExecContext, base *Variant, i int) (key, value *Variant, ok bool) {
+	if base.Type.Kind() == ComplexTypeChannel {
+		_, v, ok, err := context.scheduler().communicate(n, []commOp{{ch: base.ChannelData}}, true)
+		if err != nil {
+			context.Raise(*err)
+			return nil, nil, false
+		}
+		return v, nil, ok
+	}
+	if i >= len(base.VectorData) {
+		return nil, nil, false
+	}
+	return MakeVariant(i), base.VectorData[i], true
+}
+
+// iterate runs a single iteration of the loop. Iteration variables declared by the loop are scoped to the iteration.
+func (n *RangeStmt) iterate(context *ExecContext, key, value *Variant) *Variant {
+	if n.NewLocal {
+		context.pushScope()
+		defer context.popScope()
+	}
+	if n.Key != nil {
+		storeVariant(context, n.Key, n.Key.Exec(context), key, n.NewLocal)
+	}
+	if n.Value != nil {
+		storeVariant(context, n.Value, n.Value.Exec(context), value, n.NewLocal)
+	}
+	return n.Code.Exec(context)
+}
+
+// Exec evaluates the channel operations of every case, then executes the code of the first case able to proceed.
+// If no case can proceed, the default case is executed, or the goroutine blocks if there is no default case.
+func (n *SelectStmt) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	var ops []commOp
+	var opCases []int
+	defaultCase := -1
+
+	for i, c := range n.Cases {
+		if c.IsDefault {
+			defaultCase = i
+			continue
+		}
+		ch := c.Channel.Exec(context)
+		if !checkChannel(context, n, ch) {
+			return &Variant{
+				Type: PrimitiveTypeUndefined,
+			}
+		}
+		op := commOp{ch: ch.ChannelData, send: c.IsSend}
+		if c.IsSend {
+			op.value = c.Value.Exec(context)
+		}
+		ops = append(ops, op)
+		opCases = append(opCases, i)
+	}
+
+	chosen, v, ok, err := context.scheduler().communicate(n, ops, defaultCase < 0)
+	if err != nil {
+		context.Raise(*err)
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+
+	context.pushScope()
+	defer context.popScope()
+	var c SelectCase
+	if chosen < 0 {
+		c = n.Cases[defaultCase]
+	} else {
+		c = n.Cases[opCases[chosen]]
+		if c.Target != nil {
+			storeVariant(context, c.Target, c.Target.Exec(context), v, c.NewLocal)
+		}
+		if c.OkTarget != nil {
+			storeVariant(context, c.OkTarget, c.OkTarget.Exec(context), MakeVariant(ok), c.NewLocal)
+		}
+	}
+
+	if c.Code == nil {
+		return &Variant{
+			Type: PrimitiveTypeUndefined,
+		}
+	}
+	return c.Code.Exec(context)
+}
+
+// Exec evaluates the arguments of the builtin function, then carries it out.
+func (n *BuiltinCall) Exec(context *ExecContext) *Variant {
+	context.Step(n)
+	args := make([]*Variant, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.Exec(context)
+	}
+	return n.Apply(context, args)
+}
+
+// Apply carries out the builtin function, given args, the values of its arguments.
+func (n *BuiltinCall) Apply(context *ExecContext, args []*Variant) *Variant {
+	switch n.Builtin {
+	case BuiltinMake:
+		ct, ok := n.Type.(ChannelType)
+		if !ok {
+			context.Raise(ExecutionError{
+				Class:        NotImplementedErr,
+				CreatingNode: n,
+				Text:         "Cannot make value of type " + n.Type.String(),
+			})
+			break
+		}
+		size := 0
+		if len(args) > 0 {
+			sizeNode := args[0]
+			if sizeNode.Type != PrimitiveTypeInt {
+				context.Raise(ExecutionError{
+					Class:        TypeErr,
+					CreatingNode: n,
+					Text:         "Non-integer size used for channel buffer",
+				})
+				break
+			}
+			if sizeNode.Int < 0 {
+				context.Raise(ExecutionError{
+					Class:        BoundsErr,
+					CreatingNode: n,
+					Text:         "Negative size used for channel buffer",
+				})
+				break
+			}
+			context.reserve(n, vectorSize(sizeNode.Int))
+			size = int(sizeNode.Int)
+		}
+		return &Variant{
+			Type:        ct,
+			ChannelData: NewChannel(ct, size),
+		}
+
+	case BuiltinClose:
+		if len(args) != 1 {
+			context.Raise(ExecutionError{
+				Class:        InvalidAst,
+				CreatingNode: n,
+				Text:         "close() expects exactly one argument",
+			})
+			break
+		}
+		ch := args[0]
+		if checkChannel(context, n, ch) {
+			if err := context.scheduler().closeChannel(n, ch.ChannelData); err != nil {
+				context.Raise(*err)
+			}
+		}
+
+	case BuiltinLen:
+		if len(args) != 1 {
+			context.Raise(ExecutionError{
+				Class:        InvalidAst,
+				CreatingNode: n,
+				Text:         "len() expects exactly one argument",
+			})
+			break
+		}
+		v := args[0]
+		switch v.Type.Kind() {
+		case PrimitiveTypeString:
+			return MakeVariant(len(v.String))
+		case ComplexTypeArray, ComplexTypeSlice:
+			return MakeVariant(len(v.VectorData))
+		}
+		context.Raise(ExecutionError{
+			Class:        TypeErr,
+			CreatingNode: n,
+			Text:         "Cannot take the length of type " + v.Type.String(),
+		})
+
+	case BuiltinAppend:
+		if len(args) == 0 || (n.Spread && len(args) != 2) {
+			context.Raise(ExecutionError{
+				Class:        InvalidAst,
+				CreatingNode: n,
+				Text:         "append() expects a slice followed by the elements to append",
+			})
+			break
+		}
+		s := args[0]
+		if s.Type.Kind() != ComplexTypeSlice {
+			context.Raise(ExecutionError{
+				Class:        TypeErr,
+				CreatingNode: n,
+				Text:         "Cannot append to non-slice type " + s.Type.String(),
+			})
+			break
+		}
+		elems := args[1:]
+		if n.Spread {
+			elems = args[1].VectorData
+		}
+		// like Go, the result shares the elements of s if they have spare capacity, and otherwise holds copies of them.
+		data := s.VectorData
+		if len(data)+len(elems) > cap(data) {
+			data = make([]*Variant, len(s.VectorData), 2*len(s.VectorData)+len(elems))
+			for i, elem := range s.VectorData {
+				if elem != nil {
+					data[i] = elem.Copy()
+				}
+			}
+		}
+		for _, elem := range elems {
+			elem = elem.Copy()
+			context.reserve(n, SizeOf(elem))
+			data = append(data, elem)
+		}
+		return &Variant{
+			Type:       s.Type,
+			VectorData: data,
+		}
 
-	for i, paramNode := range functionPointer.Type.(FunctionType).Parameters {
-		pn := n.Args[i].Exec(context)
-		nt := paramNode.(NamedType)
-		fn[nt.Ident] = pn
+	default:
+		context.Raise(ExecutionError{
+			Class:        NotImplementedErr,
+			CreatingNode: n,
+			Text:         "Unknown builtin: " + n.Builtin.String(),
+		})
 	}
 
-	return functionPointer.Type.(FunctionType).Code.Exec(execContext)
+	return &Variant{
+		Type: PrimitiveTypeUndefined,
+	}
 }
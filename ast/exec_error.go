@@ -1,5 +1,10 @@
 package ast
 
+import (
+	"go/token"
+	"strings"
+)
+
 type errClass int
 
 // Represents possible classes of execution errors.
@@ -10,6 +15,16 @@ const (
 	InvalidAst
 	InternalErr
 	NotImplementedErr
+	DeadlockErr
+	ChannelErr
+	HostErr // a function implemented in Go failed
+	NilErr  // a method was called on a nil value
+
+	BudgetExceededErr // execution exceeded ExecContext.MaxSteps
+	CancelledErr      // ExecContext.Ctx was cancelled
+	MemoryLimitErr    // execution exceeded ExecContext.MaxMemory
+	StackOverflowErr  // the call stack exceeded ExecContext.MaxDepth
+	DivideByZeroErr   // an integer was divided by zero
 )
 
 // ExecutionError encapsulates errors encountered while executing the AST at runtime.
@@ -17,8 +32,41 @@ type ExecutionError struct {
 	Class        errClass
 	CreatingNode Node
 	Text         string
+	Stack        []Frame // the call stack of the goroutine which raised the error, innermost first
 }
 
 func (e ExecutionError) Error() string {
+	if pos := e.Position(); pos.IsValid() {
+		return pos.String() + ": " + e.Text
+	}
 	return e.Text
 }
+
+// Position returns the position of the node which raised the error, which is invalid if unknown.
+func (e ExecutionError) Position() token.Position {
+	return position(e.CreatingNode)
+}
+
+// StackTrace formats the call stack of the error, with a line for each function followed by the position it was
+// executing, starting with the function which raised the error.
+func (e ExecutionError) StackTrace() string {
+	var out strings.Builder
+	pos := e.Position()
+	for _, frame := range e.Stack {
+		out.WriteString(frame.Function + "()\n")
+		if pos.IsValid() {
+			out.WriteString("\t" + pos.String() + "\n")
+		}
+		pos = frame.Pos
+	}
+	return out.String()
+}
+
+// traceErrors sets the stack of any of errs which do not have one to the stack starting at f.
+func traceErrors(errs []ExecutionError, f *Frame) {
+	for i := range errs {
+		if errs[i].Stack == nil {
+			errs[i].Stack = f.Trace()
+		}
+	}
+}
@@ -1,17 +1,146 @@
 package ast
 
+import (
+	"context"
+	"go/token"
+	"io"
+	"os"
+)
+
 // ExecContext is a structure passed to AST nodes during execution to contain namespaces or contextualise behaviour.
+// Scope is the innermost block scope within the function, or nil at the top level of the function. Locals is the frame
+// of a function resolved by Resolve(), which holds its variables in place of the function namespace and block scopes.
+// Output receives anything the program prints, and is os.Stdout if nil.
 type ExecContext struct {
 	IsFuncContext     bool
 	FunctionNamespace Namespace
 	GlobalNamespace   Namespace
+	Scope             *Scope
+	Locals            []*Variant
 	Errors            []ExecutionError
+	Scheduler         *Scheduler
+	Output            io.Writer
+
+	// MaxSteps limits the number of nodes a program started with ExecMain() may evaluate, if non-zero. Ctx aborts the
+	// program once it is done, if set. Either aborts the program with a BudgetExceededErr or CancelledErr respectively.
+	MaxSteps int
+	Ctx      context.Context
+	// MaxMemory limits the approximate number of bytes of memory a program started with ExecMain() may use, if
+	// non-zero. Exceeding it aborts the program with a MemoryLimitErr. PeakMemory is set to the peak usage once the
+	// program finishes, which excludes the allocation that exceeded the limit.
+	MaxMemory  int
+	PeakMemory int
+
+	// Stack is the innermost frame of the call stack of the goroutine. MaxDepth limits the number of frames in the
+	// stack, or DefaultMaxDepth if zero, as checked by programs started with ExecMain(). Exceeding it aborts the
+	// program with a StackOverflowErr.
+	Stack    *Frame
+	MaxDepth int
+
+	// FailFast aborts a program started with ExecMain() at the first error it raises. Otherwise, errors are collected
+	// and execution continues, with the value which raised the error undefined.
+	FailFast bool
+}
+
+// DefaultMaxDepth is the maximum depth of the call stack if ExecContext.MaxDepth is not set.
+const DefaultMaxDepth = 10000
+
+// Frame is an entry in the call stack of a goroutine, representing a call of a function which has not returned.
+type Frame struct {
+	Function string         // name of the function called, as written at the call site
+	Call     Node           // the call which invoked the function, nil for the entry point of a program
+	Pos      token.Position // position of Call in the source, if known
+	Caller   *Frame         // the frame which made the call, nil for the outermost frame
+	Depth    int            // number of frames in the stack, including this one
+}
+
+// push returns a new innermost frame for a call of the named function by node, above f.
+func (f *Frame) push(name string, node Node) *Frame {
+	depth := 1
+	if f != nil {
+		depth = f.Depth + 1
+	}
+	return &Frame{
+		Function: name,
+		Call:     node,
+		Pos:      position(node),
+		Caller:   f,
+		Depth:    depth,
+	}
+}
+
+// Trace returns the frames of the stack starting at f, innermost first.
+func (f *Frame) Trace() []Frame {
+	var out []Frame
+	for ; f != nil; f = f.Caller {
+		out = append(out, *f)
+	}
+	return out
+}
+
+// Writer returns the writer which the program prints to.
+func (context *ExecContext) Writer() io.Writer {
+	if context.Output == nil {
+		return os.Stdout
+	}
+	return context.Output
+}
+
+// Scope represents a lexical block nested within a function, holding the variables declared within that block.
+type Scope struct {
+	Parent    *Scope
+	Namespace Namespace
+}
+
+// lookup returns the variable with the given name, along with the namespace it was found in. Block scopes are
+// searched from the innermost outwards, followed by the function and then the global namespace.
+func (context *ExecContext) lookup(name string) (*Variant, Namespace) {
+	for s := context.Scope; s != nil; s = s.Parent {
+		if v, ok := s.Namespace[name]; ok {
+			return v, s.Namespace
+		}
+	}
+	if v, ok := context.FunctionNamespace[name]; ok {
+		return v, context.FunctionNamespace
+	}
+	if v, ok := context.GlobalNamespace[name]; ok {
+		return v, context.GlobalNamespace
+	}
+	return nil, nil
+}
+
+// localNamespace returns the namespace which new variables are declared in.
+func (context *ExecContext) localNamespace() Namespace {
+	if context.Scope == nil {
+		return context.FunctionNamespace
+	}
+	if context.Scope.Namespace == nil {
+		context.Scope.Namespace = Namespace{}
+	}
+	return context.Scope.Namespace
+}
+
+// pushScope enters a new block scope, which is left by calling popScope. Resolved functions have no block scopes, as
+// each variable has its own slot in the frame.
+func (context *ExecContext) pushScope() {
+	if context.Locals != nil {
+		return
+	}
+	context.Scope = &Scope{Parent: context.Scope}
+}
+
+func (context *ExecContext) popScope() {
+	if context.Locals != nil {
+		return
+	}
+	context.release(context.Scope.Namespace)
+	context.Scope = context.Scope.Parent
 }
 
 // Namespace represents a mapping of (variable) names to values.
 type Namespace map[string]*Variant
 
-// Save constructs a Variant from v and saves it. If a *variant is given, a shallow copy is performed.
+// Save constructs a Variant from v and saves it. If a *Variant is given, it is copied with assignment semantics.
 func (n Namespace) Save(name string, v interface{}) {
 	n[name] = MakeVariant(v) //makes a copy
 }
@@ -1214,7 +1214,7 @@ func TestStructLiteralWorksWhenGivenValue(t *testing.T) {
 	}
 
 	r := op.Exec(&context)
-	if r.Type != ComplexTypeStruct {
+	if r.Type.Kind() != ComplexTypeStruct {
 		t.Error("Expected ComplexTypeStruct")
 	}
 	if len(context.Errors) != 0 {
@@ -1252,7 +1252,7 @@ func TestStructLiteralWorksWhenValueOmitted(t *testing.T) {
 	}
 
 	r := op.Exec(&context)
-	if r.Type != ComplexTypeStruct {
+	if r.Type.Kind() != ComplexTypeStruct {
 		t.Error("Expected ComplexTypeStruct")
 	}
 	if len(context.Errors) != 0 {
@@ -1484,3 +1484,261 @@ func TestForStatementPostIteratorBodyExec(t *testing.T) {
 		t.Error("Incorrect value")
 	}
 }
+
+func TestReceiveFromEmptyChannelDeadlocks(t *testing.T) {
+	chanType := ChannelType{SubType: PrimitiveTypeInt}
+	node := &StatementList{
+		Stmts: []Node{
+			&Assign{
+				Variable: &VariableReference{Name: "ch"},
+				Value:    &BuiltinCall{Builtin: BuiltinMake, Type: chanType},
+				NewLocal: true,
+			},
+			&ReturnStmt{
+				Expr: &Receive{Channel: &VariableReference{Name: "ch"}},
+			},
+		},
+	}
+	context := ExecContext{
+		IsFuncContext:     true,
+		FunctionNamespace: Namespace(map[string]*Variant{}),
+		GlobalNamespace:   Namespace(map[string]*Variant{}),
+	}
+
+	v := ExecMain(node, &context)
+	if v.Type != PrimitiveTypeUndefined {
+		t.Error("Expected PrimitiveTypeUndefined return, got " + v.Type.String())
+	}
+	if len(context.Errors) != 1 || context.Errors[0].Class != DeadlockErr {
+		t.Error("Expected deadlock error")
+	}
+}
+
+func TestBufferedChannelSendReceive(t *testing.T) {
+	chanType := ChannelType{SubType: PrimitiveTypeString}
+	node := &StatementList{
+		Stmts: []Node{
+			&Assign{
+				Variable: &VariableReference{Name: "ch"},
+				Value:    &BuiltinCall{Builtin: BuiltinMake, Type: chanType, Args: []Node{&IntegerLiteral{Val: 1}}},
+				NewLocal: true,
+			},
+			&SendStmt{
+				Channel: &VariableReference{Name: "ch"},
+				Value:   &StringLiteral{Str: "abc"},
+			},
+			&ReturnStmt{
+				Expr: &Receive{Channel: &VariableReference{Name: "ch"}},
+			},
+		},
+	}
+	context := ExecContext{
+		IsFuncContext:     true,
+		FunctionNamespace: Namespace(map[string]*Variant{}),
+		GlobalNamespace:   Namespace(map[string]*Variant{}),
+	}
+
+	v := node.Exec(&context)
+	if len(context.Errors) != 0 {
+		t.Error("Errors not expected")
+	}
+	if v.String != "abc" {
+		t.Error("Incorrect value")
+	}
+}
+
+func TestLoopVariablesDoNotLeakFromLoop(t *testing.T) {
+	forNode := ForStmt{
+		Init: &Assign{
+			Variable: &VariableReference{Name: "i"},
+			Value:    &IntegerLiteral{Val: 0},
+			NewLocal: true,
+		},
+		Conditional: &BinaryOp{
+			LHS: &VariableReference{Name: "i"},
+			RHS: &IntegerLiteral{Val: 0},
+			Op:  BinOpEquality,
+		},
+		Code: &StatementList{
+			Stmts: []Node{
+				&Assign{
+					Variable: &VariableReference{Name: "inner"},
+					Value:    &IntegerLiteral{Val: 5},
+					NewLocal: true,
+				},
+				&Assign{
+					Variable: &VariableReference{Name: "counter"},
+					Value:    &VariableReference{Name: "inner"},
+				},
+			},
+		},
+		PostIteration: &Assign{
+			Variable: &VariableReference{Name: "i"},
+			Value:    &IntegerLiteral{Val: 1},
+		},
+	}
+	context := ExecContext{
+		IsFuncContext: true,
+		FunctionNamespace: Namespace(map[string]*Variant{
+			"counter": &Variant{Type: PrimitiveTypeInt},
+		}),
+		GlobalNamespace: Namespace(map[string]*Variant{}),
+	}
+
+	forNode.Exec(&context)
+	if len(context.Errors) != 0 {
+		t.Error("Errors not expected")
+	}
+	if _, ok := context.FunctionNamespace["i"]; ok {
+		t.Error("Loop initializer variable leaked into function namespace")
+	}
+	if _, ok := context.FunctionNamespace["inner"]; ok {
+		t.Error("Loop body variable leaked into function namespace")
+	}
+	if context.FunctionNamespace["counter"].Int != 5 {
+		t.Error("Outer variable was not assigned from within the loop")
+	}
+	if len(context.GlobalNamespace) != 0 {
+		t.Error("Nothing should be written to the global namespace")
+	}
+}
+
+func TestNamedSelectorAmbiguousPromotedFieldErrors(t *testing.T) {
+	a := StructType{Name: "A", Fields: []NamedType{{Ident: "ID", Type: PrimitiveTypeInt}}}
+	b := StructType{Name: "B", Fields: []NamedType{{Ident: "ID", Type: PrimitiveTypeInt}}}
+	op := &NamedSelector{
+		Name: "ID",
+		Expr: &StructLiteral{
+			Type: StructType{Fields: []NamedType{{Ident: "A", Type: a, Embedded: true}, {Ident: "B", Type: b, Embedded: true}}},
+		},
+	}
+
+	context := ExecContext{
+		IsFuncContext:     true,
+		GlobalNamespace:   Namespace(map[string]*Variant{}),
+		FunctionNamespace: map[string]*Variant{},
+	}
+	op.Exec(&context)
+	if len(context.Errors) != 1 {
+		t.Fatal("1 error expected,", len(context.Errors))
+	}
+	if context.Errors[0].Class != NotFoundErr {
+		t.Error("Expected NotFoundErr")
+	}
+}
+
+func TestFunctionCallWithTooFewArgumentsErrors(t *testing.T) {
+	fn := FunctionType{
+		Parameters: []TypeKind{NamedType{Ident: "a", Type: PrimitiveTypeInt}},
+		ReturnType: PrimitiveTypeInt,
+		Code:       &ReturnStmt{Expr: &VariableReference{Name: "a"}},
+	}
+	context := ExecContext{
+		IsFuncContext:     true,
+		GlobalNamespace:   Namespace(map[string]*Variant{"f": &Variant{Type: fn}}),
+		FunctionNamespace: map[string]*Variant{},
+	}
+
+	r := (&FunctionCall{Function: &VariableReference{Name: "f"}}).Exec(&context)
+	if r.Type != PrimitiveTypeUndefined {
+		t.Error("Expected undefined result")
+	}
+	if len(context.Errors) != 1 {
+		t.Fatal("1 error expected,", len(context.Errors))
+	}
+	if context.Errors[0].Class != TypeErr {
+		t.Error("Expected TypeErr")
+	}
+}
+
+func TestPackageFunctionUsesPackageGlobals(t *testing.T) {
+	pkg := Namespace(map[string]*Variant{"count": MakeVariant(7)})
+	pkg["Count"] = &Variant{
+		Type:    FunctionType{ReturnType: PrimitiveTypeInt, Code: &ReturnStmt{Expr: &VariableReference{Name: "count"}}},
+		Globals: pkg,
+	}
+	context := ExecContext{
+		IsFuncContext: true,
+		GlobalNamespace: Namespace(map[string]*Variant{
+			"count": MakeVariant(1),
+			"pkg":   &Variant{Type: PackageType{Path: "pkg", Members: pkg}, NamedData: pkg},
+		}),
+		FunctionNamespace: map[string]*Variant{},
+	}
+
+	r := (&FunctionCall{Function: &NamedSelector{Name: "Count", Expr: &VariableReference{Name: "pkg"}}}).Exec(&context)
+	if len(context.Errors) != 0 {
+		t.Fatal(context.Errors)
+	}
+	if r.Int != 7 {
+		t.Error("Incorrect value: ", r.Int)
+	}
+}
+
+func TestResolvedVariables(t *testing.T) {
+	ref := func(name string) *VariableReference { return &VariableReference{Name: name} }
+	y, w, g, missing := ref("y"), ref("w"), ref("g"), ref("missing")
+	body := &StatementList{Stmts: []Node{
+		&Assign{Variable: ref("x"), Value: ref("a"), NewLocal: true},
+		&StatementList{Stmts: []Node{
+			&Assign{Variable: y, Value: ref("x"), NewLocal: true},
+			&Assign{Variable: ref("g"), Value: y},
+		}},
+		&StatementList{Stmts: []Node{
+			&Assign{Variable: w, Value: &IntegerLiteral{Val: 3}, NewLocal: true},
+			&Assign{Variable: ref("x"), Value: &BinaryOp{LHS: ref("x"), RHS: w, Op: BinOpAdd}},
+		}},
+		&Assign{Variable: g, Value: missing},
+		&ReturnStmt{Expr: ref("x")},
+	}}
+	fn := FunctionType{Parameters: []TypeKind{NamedType{Ident: "a", Type: PrimitiveTypeInt}}, Code: body}
+	if !Resolve(fn) {
+		t.Fatal("Expected the function to be resolved")
+	}
+
+	if body.Layout == nil || body.Layout.Slots != 3 || len(body.Layout.Params) != 1 || body.Layout.Params[0] != "a" {
+		t.Fatalf("Unexpected frame layout %+v", body.Layout)
+	}
+	if y.Storage != StorageLocal || y.Slot != 2 || w.Storage != StorageLocal || w.Slot != 2 {
+		t.Error("Expected variables of sibling blocks to share a slot")
+	}
+	if g.Storage != StorageGlobal || missing.Storage != StorageGlobal {
+		t.Error("Expected undeclared variables to be global")
+	}
+
+	context := &ExecContext{
+		IsFuncContext:     true,
+		FunctionNamespace: Namespace{"a": MakeVariant(2)},
+		GlobalNamespace:   Namespace{"g": MakeVariant(0)},
+	}
+	ret := ExecMain(body, context)
+	if len(context.Errors) > 0 {
+		t.Fatal(context.Errors)
+	}
+	if ret.Type != PrimitiveTypeInt || ret.Int != 5 {
+		t.Errorf("Expected 5, got %+v", ret)
+	}
+	// an undefined value is assigned to the global, rather than declaring a local variable.
+	if v := context.GlobalNamespace["g"]; v.Type != PrimitiveTypeUndefined {
+		t.Errorf("Expected g to be assigned an undefined value, got %+v", v)
+	}
+	if len(context.FunctionNamespace) != 1 {
+		t.Errorf("Expected no variables to be declared in the function namespace, got %v", context.FunctionNamespace.Names())
+	}
+}
+
+func TestResolveUnknownNode(t *testing.T) {
+	x := &VariableReference{Name: "x"}
+	body := &StatementList{Stmts: []Node{&Assign{Variable: x, Value: &unknownNode{}, NewLocal: true}}}
+	if Resolve(FunctionType{Code: body}) {
+		t.Error("Expected a function with an unknown node not to be resolved")
+	}
+	if body.Layout != nil || x.Storage != StorageDynamic {
+		t.Error("Expected the function to be unchanged")
+	}
+}
+
+// unknownNode is a node which Resolve() does not know how to resolve.
+type unknownNode struct {
+	IntegerLiteral
+}
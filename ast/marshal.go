@@ -0,0 +1,368 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+var errorInterface = reflect.TypeOf((*error)(nil)).Elem()
+
+// ToVariant converts a Go value to a Variant. See Marshaller for the Go types which can be converted.
+func ToVariant(v interface{}) (*Variant, error) {
+	return Marshaller{}.ToVariant(v)
+}
+
+// FromVariant stores the value of v into the Go value pointed to by out. See Marshaller for the Go types which can be
+// converted.
+func FromVariant(v *Variant, out interface{}) error {
+	return Marshaller{}.FromVariant(v, out)
+}
+
+// Marshaller converts between Go values and Variants. Integers of any size, strings, bools, errors, arrays, slices,
+// structs, maps with string keys and pointers to those types can be converted, as can the Go types of Handles.
+//
+// Structs are represented by structs with a field for each exported field, named by the `harsh:"name"` tag of the
+// field if present. Fields tagged `harsh:"-"` are ignored. Maps are represented by structs with a field for each key,
+// and pointers by the value they point to - nil pointers are represented by the zero value.
+type Marshaller struct {
+	Handles map[reflect.Type]HandleType // handle types, keyed by the Go type of the values they hold
+}
+
+// ToVariant converts a Go value to a Variant. A *Variant is copied.
+func (m Marshaller) ToVariant(v interface{}) (*Variant, error) {
+	switch v := v.(type) {
+	case nil:
+		return &Variant{Type: PrimitiveTypeUndefined}, nil
+	case *Variant:
+		return v.Copy(), nil
+	}
+	if _, ok := m.Handles[reflect.TypeOf(v)]; !ok {
+		if err, ok := v.(error); ok {
+			return &Variant{Type: PrimitiveTypeError, ErrorData: err}, nil
+		}
+	}
+	return m.Variant(reflect.ValueOf(v))
+}
+
+// FromVariant stores the value of v into the Go value pointed to by out.
+func (m Marshaller) FromVariant(v *Variant, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cannot store a value into non-pointer %T", out)
+	}
+	value, err := m.Value(v, rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	rv.Elem().Set(value)
+	return nil
+}
+
+// TypeOf returns the harsh type which represents values of the Go type t.
+func (m Marshaller) TypeOf(t reflect.Type) (TypeKind, error) {
+	return m.typeOf(t, map[reflect.Type]bool{})
+}
+
+// typeOf implements TypeOf. Struct types being converted are recorded in converting, as recursive types cannot be
+// represented.
+func (m Marshaller) typeOf(t reflect.Type, converting map[reflect.Type]bool) (TypeKind, error) {
+	if t == errorInterface {
+		return PrimitiveTypeError, nil
+	}
+	if h, ok := m.Handles[t]; ok {
+		return h, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return PrimitiveTypeInt, nil
+	case reflect.String:
+		return PrimitiveTypeString, nil
+	case reflect.Bool:
+		return PrimitiveTypeBool, nil
+	case reflect.Ptr:
+		return m.typeOf(t.Elem(), converting)
+	case reflect.Slice:
+		sub, err := m.typeOf(t.Elem(), converting)
+		if err != nil {
+			return nil, err
+		}
+		return SliceType{SubType: sub}, nil
+	case reflect.Array:
+		sub, err := m.typeOf(t.Elem(), converting)
+		if err != nil {
+			return nil, err
+		}
+		return ArrayType{SubType: sub, Len: &IntegerLiteral{Val: int64(t.Len())}}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, errors.New("unsupported map key type " + t.Key().String())
+		}
+		if _, err := m.typeOf(t.Elem(), converting); err != nil {
+			return nil, err
+		}
+		return StructType{}, nil //the fields are the keys of each value
+	case reflect.Struct:
+		if converting[t] {
+			return nil, errors.New("unsupported recursive type " + t.String())
+		}
+		converting[t] = true
+		defer delete(converting, t)
+
+		st := StructType{Name: t.Name()}
+		for _, f := range structFields(t) {
+			ft, err := m.typeOf(f.field.Type, converting)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", f.field.Name, err)
+			}
+			st.Fields = append(st.Fields, NamedType{Ident: f.name, Type: ft, Embedded: f.field.Anonymous})
+		}
+		return st, nil
+	}
+	return nil, errors.New("unsupported type " + t.String())
+}
+
+// goField is an exported field of a Go struct, with the name of the field which represents it.
+type goField struct {
+	name  string
+	field reflect.StructField
+}
+
+// structFields returns the fields of the Go struct type t which are represented in harsh.
+func structFields(t reflect.Type) []goField {
+	var out []goField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { //unexported
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("harsh"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		out = append(out, goField{name: name, field: f})
+	}
+	return out
+}
+
+// Variant converts the Go value v to a Variant.
+func (m Marshaller) Variant(v reflect.Value) (*Variant, error) {
+	t, err := m.TypeOf(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	return m.variant(v, t)
+}
+
+// variant converts the Go value v to a Variant of type t, which represents the type of v.
+func (m Marshaller) variant(v reflect.Value, t TypeKind) (*Variant, error) {
+	if t == PrimitiveTypeError {
+		err, _ := v.Interface().(error)
+		return &Variant{Type: PrimitiveTypeError, ErrorData: err}, nil
+	}
+	if _, ok := t.(HandleType); ok {
+		ret := &Variant{Type: t}
+		if !IsNilValue(v) {
+			ret.HandleData = v.Interface()
+		}
+		return ret, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return MakeVariant(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > 1<<63-1 {
+			return nil, errors.New(strconv.FormatUint(v.Uint(), 10) + " overflows int")
+		}
+		return MakeVariant(int64(v.Uint())), nil
+	case reflect.String:
+		return MakeVariant(v.String()), nil
+	case reflect.Bool:
+		return MakeVariant(v.Bool()), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return DefaultVariantValue(t)
+		}
+		return m.variant(v.Elem(), t)
+	case reflect.Slice, reflect.Array:
+		ret := &Variant{Type: t}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return ret, nil
+		}
+		ret.VectorData = make([]*Variant, v.Len())
+		for i := range ret.VectorData {
+			elem, err := m.variant(v.Index(i), t.BaseType())
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %v", i, err)
+			}
+			ret.VectorData[i] = elem
+		}
+		return ret, nil
+	case reflect.Map:
+		sub, _ := m.TypeOf(v.Type().Elem())
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		st := StructType{}
+		ret := &Variant{NamedData: map[string]*Variant{}}
+		for _, k := range keys {
+			elem, err := m.variant(v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())), sub)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %v", k, err)
+			}
+			st.Fields = append(st.Fields, NamedType{Ident: k, Type: sub})
+			ret.NamedData[k] = elem
+		}
+		ret.Type = st
+		return ret, nil
+	case reflect.Struct:
+		st := t.(StructType)
+		ret := &Variant{Type: st, NamedData: map[string]*Variant{}, EmbeddedFields: st.EmbeddedFields()}
+		for i, f := range structFields(v.Type()) {
+			field, err := m.variant(v.FieldByIndex(f.field.Index), st.Fields[i].Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", f.field.Name, err)
+			}
+			ret.NamedData[f.name] = field
+		}
+		return ret, nil
+	}
+	return nil, errors.New("unsupported type " + v.Type().String())
+}
+
+// Value converts v to a Go value of type t. An error is returned if v is not of a type which represents t.
+func (m Marshaller) Value(v *Variant, t reflect.Type) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	if t == errorInterface {
+		if v.Type.Kind() != PrimitiveTypeError && v.Type != PrimitiveTypeUndefined {
+			return out, mismatch(v, "error")
+		}
+		if v.ErrorData != nil {
+			out.Set(reflect.ValueOf(v.ErrorData))
+		}
+		return out, nil
+	}
+	if h, ok := m.Handles[t]; ok {
+		if v.Type.Kind() != ComplexTypeHandle || v.Type.(HandleType).Name != h.Name {
+			return out, mismatch(v, h.Name)
+		}
+		if v.HandleData == nil {
+			return out, nil
+		}
+		value := reflect.ValueOf(v.HandleData)
+		if value.Type() != t {
+			return out, errors.New("handle holds " + value.Type().String() + ", not " + t.String())
+		}
+		return value, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type.Kind() != PrimitiveTypeInt {
+			return out, mismatch(v, "int")
+		}
+		if out.OverflowInt(v.Int) {
+			return out, errors.New(strconv.FormatInt(v.Int, 10) + " overflows " + t.String())
+		}
+		out.SetInt(v.Int)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Type.Kind() != PrimitiveTypeInt {
+			return out, mismatch(v, "int")
+		}
+		if v.Int < 0 || out.OverflowUint(uint64(v.Int)) {
+			return out, errors.New(strconv.FormatInt(v.Int, 10) + " overflows " + t.String())
+		}
+		out.SetUint(uint64(v.Int))
+	case reflect.String:
+		if v.Type.Kind() != PrimitiveTypeString {
+			return out, mismatch(v, "string")
+		}
+		out.SetString(v.String)
+	case reflect.Bool:
+		if v.Type.Kind() != PrimitiveTypeBool {
+			return out, mismatch(v, "bool")
+		}
+		out.SetBool(v.Bool)
+	case reflect.Ptr:
+		elem, err := m.Value(v, t.Elem())
+		if err != nil {
+			return out, err
+		}
+		out.Set(reflect.New(t.Elem()))
+		out.Elem().Set(elem)
+	case reflect.Slice, reflect.Array:
+		if v.Type.Kind() != ComplexTypeSlice && v.Type.Kind() != ComplexTypeArray {
+			return out, mismatch(v, "slice or array")
+		}
+		if t.Kind() == reflect.Slice {
+			if v.VectorData == nil {
+				return out, nil
+			}
+			out.Set(reflect.MakeSlice(t, len(v.VectorData), len(v.VectorData)))
+		} else if len(v.VectorData) != t.Len() {
+			return out, fmt.Errorf("cannot use %d elements as %s", len(v.VectorData), t)
+		}
+		for i, elem := range v.VectorData {
+			e, err := m.Value(elem, t.Elem())
+			if err != nil {
+				return out, fmt.Errorf("index %d: %v", i, err)
+			}
+			out.Index(i).Set(e)
+		}
+	case reflect.Map:
+		if v.Type.Kind() != ComplexTypeStruct || t.Key().Kind() != reflect.String {
+			return out, mismatch(v, t.String())
+		}
+		out.Set(reflect.MakeMapWithSize(t, len(v.NamedData)))
+		for k, elem := range v.NamedData {
+			e, err := m.Value(elem, t.Elem())
+			if err != nil {
+				return out, fmt.Errorf("key %q: %v", k, err)
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), e)
+		}
+	case reflect.Struct:
+		if v.Type.Kind() != ComplexTypeStruct {
+			return out, mismatch(v, t.String())
+		}
+		for _, f := range structFields(t) {
+			field, ok := v.NamedData[f.name]
+			if !ok {
+				continue //missing fields take the zero value
+			}
+			e, err := m.Value(field, f.field.Type)
+			if err != nil {
+				return out, fmt.Errorf("field %s: %v", f.name, err)
+			}
+			out.FieldByIndex(f.field.Index).Set(e)
+		}
+	default:
+		return out, errors.New("unsupported type " + t.String())
+	}
+	return out, nil
+}
+
+func mismatch(v *Variant, expected string) error {
+	return errors.New("cannot use " + v.Type.String() + " as " + expected)
+}
+
+// IsNilValue returns true if v holds a nil pointer, interface, map, slice, channel or function.
+func IsNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package ast
+
+import (
+	"strconv"
+	"unsafe"
+)
+
+// variantSize is the size of a Variant, excluding the data it references.
+var variantSize = int(unsafe.Sizeof(Variant{}))
+
+// SizeOf returns the approximate number of bytes of memory used by v, including the elements and fields it holds.
+// The elements of slices are included even if they are shared with other slices, and the members of packages are
+// excluded.
+func SizeOf(v *Variant) int {
+	if v == nil {
+		return 0
+	}
+	size := variantSize + len(v.String)
+	for _, elem := range v.VectorData {
+		size += SizeOf(elem)
+	}
+	if v.Type.Kind() != ComplexTypePackage {
+		for name, field := range v.NamedData {
+			size += len(name) + SizeOf(field)
+		}
+	}
+	return size
+}
+
+// vectorSize returns the approximate number of bytes of memory used by n elements, saturating instead of overflowing.
+func vectorSize(n int64) int {
+	if n > int64(^uint(0)>>1)/int64(variantSize) {
+		return int(^uint(0) >> 1)
+	}
+	return int(n) * variantSize
+}
+
+// reserve checks that bytes of memory can be allocated by node, aborting the program if it would exceed its memory
+// limit. Memory is accounted approximately, as the memory held by the values of variables: other values are only
+// accounted when they are allocated, by checking they fit within the limit alongside the memory held by variables.
+// Allocations which exceed the limit are never made, so they are not included in the peak usage.
+func (context *ExecContext) reserve(node Node, bytes int) {
+	s := context.Scheduler
+	if s == nil {
+		return
+	}
+	if s.maxMemory > 0 && bytes > s.maxMemory-s.memory {
+		s.abort(ExecutionError{
+			Class:        MemoryLimitErr,
+			CreatingNode: node,
+			Text:         "Execution exceeded the memory limit of " + strconv.Itoa(s.maxMemory) + " bytes",
+			Stack:        context.Stack.Trace(),
+		})
+	}
+	if used := s.memory + bytes; used > s.peakMemory {
+		s.peakMemory = used
+	}
+}
+
+// Replace records that the variable holding old was assigned v by node.
+func (context *ExecContext) Replace(node Node, old, v *Variant) {
+	s := context.Scheduler
+	if s == nil {
+		return
+	}
+	size := SizeOf(v)
+	context.reserve(node, size)
+	s.memory += size
+	s.free(SizeOf(old))
+}
+
+// release records that the variables in ns have gone out of scope.
+func (context *ExecContext) release(ns Namespace) {
+	s := context.Scheduler
+	if s == nil {
+		return
+	}
+	for _, v := range ns {
+		s.free(SizeOf(v))
+	}
+}
+
+// releaseFrame records that the variables in the frame of a resolved function have gone out of scope.
+func (context *ExecContext) releaseFrame(locals []*Variant) {
+	s := context.Scheduler
+	if s == nil {
+		return
+	}
+	for _, v := range locals {
+		s.free(SizeOf(v))
+	}
+}
+
+func (s *Scheduler) free(bytes int) {
+	s.memory -= bytes
+	if s.memory < 0 { //globals are not accounted until they are assigned
+		s.memory = 0
+	}
+}
@@ -102,6 +102,24 @@ func (node *ArrayLiteral) Print(level int, printContext *PrintContext) {
 		outputType("<"+node.Type.String()+">", printContext), level, printContext)
 }
 
+// Print writes a description of the node to standard output, at the specified indentation level.
+func (node *SliceLiteral) Print(level int, printContext *PrintContext) {
+	openSection("slice", level, printContext)
+	if len(node.Literal) > 0 {
+		openSection("values", level+1, printContext)
+		for _, v := range node.Literal {
+			if v == nil {
+				outputNil(level+2, printContext)
+			} else {
+				v.Print(level+2, printContext)
+			}
+		}
+		closeSection(level+1, printContext)
+	}
+	outputLeveled(ifColor(blue(), printContext)+"} "+ifColor(resetColor(), printContext)+
+		outputType("<"+node.Type.String()+">", printContext), level, printContext)
+}
+
 // Print writes a description of the struct to standard output, at the specified indentation level.
 func (node *StructLiteral) Print(level int, printContext *PrintContext) {
 	openSection("struct", level, printContext)
@@ -195,6 +213,31 @@ func (node *Assign) Print(level int, printContext *PrintContext) {
 	closeSection(level, printContext)
 }
 
+// Print writes a description of the node to standard output, at the specified indentation level.
+func (node *MultiAssign) Print(level int, printContext *PrintContext) {
+	openSection("assign", level, printContext)
+	for _, v := range node.Variables {
+		if v == nil {
+			outputLeveled(outputBaseSource("_", printContext), level+1, printContext)
+		} else {
+			v.Print(level+1, printContext)
+		}
+	}
+	openSection("value", level+1, printContext)
+	node.Value.Print(level+2, printContext)
+	closeSection(level+1, printContext)
+	closeSection(level, printContext)
+}
+
+// Print writes a description of the node to standard output, at the specified indentation level.
+func (node *TupleLiteral) Print(level int, printContext *PrintContext) {
+	openSection("tuple", level, printContext)
+	for _, v := range node.Values {
+		v.Print(level+1, printContext)
+	}
+	closeSection(level, printContext)
+}
+
 // Print writes a description of the node to standard output, at the specified indentation level.
 func (node *VariableReference) Print(level int, printContext *PrintContext) {
 	outputLeveled("{"+outputBaseSource(node.Name, printContext)+"} "+outputType("("+node.Type.String()+")", printContext), level, printContext)
@@ -260,6 +303,138 @@ func (node *ForStmt) Print(level int, printContext *PrintContext) {
 	closeSection(level, printContext)
 }
 
+// Print writes a description of the node to standard output, at the specified indentation level.
+func (node *GoStmt) Print(level int, printContext *PrintContext) {
+	openSection("go", level, printContext)
+	if node.Call == nil {
+		outputNil(level+1, printContext)
+	} else {
+		node.Call.Print(level+1, printContext)
+	}
+	closeSection(level, printContext)
+}
+
+// Print writes a description of the node to standard output, at the specified indentation level.
+func (node *SendStmt) Print(level int, printContext *PrintContext) {
+	openSection("send", level, printContext)
+	openSection("channel", level+1, printContext)
+	if node.Channel != nil {
+		node.Channel.Print(level+2, printContext)
+	} else {
+		outputNil(level+2, printContext)
+	}
+	closeSection(level+1, printContext)
+	openSection("value", level+1, printContext)
+	if node.Value != nil {
+		node.Value.Print(level+2, printContext)
+	} else {
+		outputNil(level+2, printContext)
+	}
+	closeSection(level+1, printContext)
+	closeSection(level, printContext)
+}
+
+// Print writes a description of the node to standard output, at the specified indentation level.
+func (node *Receive) Print(level int, printContext *PrintContext) {
+	openSection("<-", level, printContext)
+	if node.Channel != nil {
+		node.Channel.Print(level+1, printContext)
+	} else {
+		outputNil(level+1, printContext)
+	}
+	closeSection(level, printContext)
+}
+
+// Print writes a description of the node to standard output, at the specified indentation level.
+func (node *RangeStmt) Print(level int, printContext *PrintContext) {
+	openSection("range", level, printContext)
+	if node.Key != nil {
+		openSection("key", level+2, printContext)
+		node.Key.Print(level+3, printContext)
+		closeSection(level+2, printContext)
+	}
+	if node.Value != nil {
+		openSection("value", level+2, printContext)
+		node.Value.Print(level+3, printContext)
+		closeSection(level+2, printContext)
+	}
+	openSection("expr", level+2, printContext)
+	if node.Expr != nil {
+		node.Expr.Print(level+3, printContext)
+	} else {
+		outputNil(level+3, printContext)
+	}
+	closeSection(level+2, printContext)
+	openSection("code", level+2, printContext)
+	if node.Code != nil {
+		node.Code.Print(level+3, printContext)
+	} else {
+		outputNil(level+3, printContext)
+	}
+	closeSection(level+2, printContext)
+	closeSection(level, printContext)
+}
+
+// Print writes a description of the node to standard output, at the specified indentation level.
+func (node *SelectStmt) Print(level int, printContext *PrintContext) {
+	openSection("select", level, printContext)
+	for _, c := range node.Cases {
+		switch {
+		case c.IsDefault:
+			openSection("default", level+1, printContext)
+		case c.IsSend:
+			openSection("case send", level+1, printContext)
+			openSection("channel", level+2, printContext)
+			c.Channel.Print(level+3, printContext)
+			closeSection(level+2, printContext)
+			openSection("value", level+2, printContext)
+			c.Value.Print(level+3, printContext)
+			closeSection(level+2, printContext)
+		default:
+			openSection("case receive", level+1, printContext)
+			openSection("channel", level+2, printContext)
+			c.Channel.Print(level+3, printContext)
+			closeSection(level+2, printContext)
+			if c.Target != nil {
+				openSection("target", level+2, printContext)
+				c.Target.Print(level+3, printContext)
+				closeSection(level+2, printContext)
+			}
+			if c.OkTarget != nil {
+				openSection("ok", level+2, printContext)
+				c.OkTarget.Print(level+3, printContext)
+				closeSection(level+2, printContext)
+			}
+		}
+		openSection("code", level+2, printContext)
+		if c.Code != nil {
+			c.Code.Print(level+3, printContext)
+		} else {
+			outputNil(level+3, printContext)
+		}
+		closeSection(level+2, printContext)
+		closeSection(level+1, printContext)
+	}
+	closeSection(level, printContext)
+}
+
+// Print writes a description of the builtin invocation to standard output.
+func (node *BuiltinCall) Print(level int, printContext *PrintContext) {
+	name := node.Builtin.String()
+	if node.Type != nil {
+		name += " " + outputType("<"+node.Type.String()+">", printContext)
+	}
+	openSection(name, level, printContext)
+	for _, arg := range node.Args {
+		if arg == nil {
+			outputNil(level+1, printContext)
+		} else {
+			arg.Print(level+1, printContext)
+		}
+	}
+	closeSection(level, printContext)
+}
+
 func openSection(sectionName string, level int, printContext *PrintContext) {
 	joiner := " {"
 	if sectionName == "" {
@@ -367,15 +542,35 @@ func (op *BinOpType) String() string {
 	return "BINOP?"
 }
 
+func (b BuiltinType) String() string {
+	switch b {
+	case BuiltinMake:
+		return "make"
+	case BuiltinClose:
+		return "close"
+	case BuiltinLen:
+		return "len"
+	case BuiltinAppend:
+		return "append"
+	}
+	return "BUILTIN?"
+}
+
 //Type system
 
 func (t NamedType) String() string {
+	if t.Embedded {
+		return t.Type.String()
+	}
 	return t.Ident + " " + t.Type.String()
 }
 
 func (t FunctionType) String() string {
 	paramList := ""
 	for i, p := range t.Parameters {
+		if t.Variadic && i+1 == len(t.Parameters) {
+			paramList += "..."
+		}
 		paramList += p.String()
 		if i+1 < len(t.Parameters) {
 			paramList += ", "
@@ -384,6 +579,35 @@ func (t FunctionType) String() string {
 	return "(" + paramList + ")" + t.ReturnType.String()
 }
 
+func (t ChannelType) String() string {
+	switch t.Dir {
+	case ChanSend:
+		return "chan<- " + t.SubType.String()
+	case ChanRecv:
+		return "<-chan " + t.SubType.String()
+	}
+	return "chan " + t.SubType.String()
+}
+
+func (t TupleType) String() string {
+	out := "("
+	for i, elem := range t.Types {
+		out += elem.String()
+		if i+1 < len(t.Types) {
+			out += ", "
+		}
+	}
+	return out + ")"
+}
+
+func (t HandleType) String() string {
+	return t.Name
+}
+
+func (t PackageType) String() string {
+	return "package " + t.Path
+}
+
 func (tk TypeKindDescription) String() string {
 	switch tk {
 	case PrimitiveTypeInt:
@@ -394,6 +618,22 @@ func (tk TypeKindDescription) String() string {
 		return "bool"
 	case ComplexTypeArray:
 		return "[?]"
+	case ComplexTypeChannel:
+		return "chan"
+	case ComplexTypeSlice:
+		return "[]"
+	case ComplexTypePackage:
+		return "package"
+	case PrimitiveTypeError:
+		return "error"
+	case ComplexTypeTuple:
+		return "tuple"
+	case ComplexTypeHandle:
+		return "handle"
+	case ComplexTypeStruct:
+		return "struct"
+	case ComplexTypeFunction:
+		return "func"
 	case PrimitiveTypeUndefined:
 		return "undefined"
 	}
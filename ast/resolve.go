@@ -0,0 +1,210 @@
+package ast
+
+// Resolve resolves the variables of fn, so they are found by position rather than looked up by name at runtime. Each
+// parameter and local variable is assigned a slot in the frame of the function, where a slot is shared by variables
+// which are never in scope at the same time, and any other variable is global. The layout of the frame is recorded on
+// the body of the function. False is returned if the code of fn contains nodes which cannot be resolved, in which case
+// it is left unchanged.
+func Resolve(fn FunctionType) bool {
+	body, ok := fn.Code.(*StatementList)
+	if !ok {
+		return false
+	}
+	if body.Layout != nil {
+		return true
+	}
+
+	r := &resolver{ok: true}
+	r.pushScope()
+	layout := &FrameLayout{}
+	for _, param := range fn.Parameters {
+		name := ""
+		if nt, named := param.(NamedType); named { //unnamed parameters cannot be referenced
+			name = nt.Ident
+		}
+		r.declare(name)
+		layout.Params = append(layout.Params, name)
+	}
+	r.nodes(body.Stmts) // the body of a function shares the scope of its parameters
+	if !r.ok {
+		return false
+	}
+
+	for _, b := range r.bindings {
+		b.ref.Storage, b.ref.Slot = b.storage, b.slot
+	}
+	layout.Slots = r.slots
+	body.Layout = layout
+	return true
+}
+
+// resolver tracks the variables in scope while resolving a function. Bindings are applied once the whole function
+// has been resolved, so a function which cannot be resolved is left unchanged.
+type resolver struct {
+	scopes   []map[string]int
+	next     int // the next free slot
+	slots    int // the number of slots used
+	bindings []binding
+	ok       bool
+}
+
+// binding records where the variable referenced by ref is stored.
+type binding struct {
+	ref     *VariableReference
+	storage Storage
+	slot    int
+}
+
+func (r *resolver) pushScope() {
+	r.scopes = append(r.scopes, map[string]int{})
+}
+
+// popScope leaves the innermost scope, freeing the slots of its variables for reuse.
+func (r *resolver) popScope() {
+	scope := r.scopes[len(r.scopes)-1]
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	for _, slot := range scope {
+		if slot < r.next {
+			r.next = slot
+		}
+	}
+}
+
+// declare assigns a new slot to the named variable in the innermost scope, returning the slot.
+func (r *resolver) declare(name string) int {
+	slot := r.next
+	r.next++
+	if r.next > r.slots {
+		r.slots = r.next
+	}
+	if name != "" {
+		r.scopes[len(r.scopes)-1][name] = slot
+	}
+	return slot
+}
+
+// reference binds ref to the innermost variable with its name, or to a global if no local variable has the name.
+func (r *resolver) reference(ref *VariableReference) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if slot, ok := r.scopes[i][ref.Name]; ok {
+			r.bindings = append(r.bindings, binding{ref: ref, storage: StorageLocal, slot: slot})
+			return
+		}
+	}
+	r.bindings = append(r.bindings, binding{ref: ref, storage: StorageGlobal})
+}
+
+// target resolves the variable assigned by an assignment, which declares it if newLocal is set.
+func (r *resolver) target(n Node, newLocal bool) {
+	if ref, ok := n.(*VariableReference); ok && newLocal {
+		r.bindings = append(r.bindings, binding{ref: ref, storage: StorageLocal, slot: r.declare(ref.Name)})
+		return
+	}
+	r.node(n)
+}
+
+// node resolves the variables referenced within n, declaring variables in the scopes which the interpreter would.
+func (r *resolver) node(n Node) {
+	switch n := n.(type) {
+	case nil, *IntegerLiteral, *StringLiteral, *BoolLiteral, *NilLiteral:
+	case *VariableReference:
+		r.reference(n)
+	case *StatementList:
+		if !n.NoScope {
+			r.pushScope()
+			defer r.popScope()
+		}
+		for _, stmt := range n.Stmts {
+			r.node(stmt)
+		}
+	case *ArrayLiteral:
+		r.nodes(n.Literal) // the length is part of the type, which may be shared with other functions
+	case *SliceLiteral:
+		r.nodes(n.Literal)
+	case *StructLiteral:
+		for _, v := range n.Values {
+			r.node(v)
+		}
+	case *TupleLiteral:
+		r.nodes(n.Values)
+	case *ReturnStmt:
+		r.node(n.Expr)
+	case *NamedSelector:
+		r.node(n.Expr)
+	case *BinaryOp:
+		r.node(n.LHS)
+		r.node(n.RHS)
+	case *UnaryOp:
+		r.node(n.Expr)
+	case *Subscript:
+		r.node(n.Expr)
+		r.node(n.Subscript)
+	case *Assign:
+		r.node(n.Value) // the value cannot refer to the variable it declares
+		r.target(n.Variable, n.NewLocal)
+	case *MultiAssign:
+		r.node(n.Value)
+		for i, variable := range n.Variables {
+			r.target(variable, n.NewLocal[i])
+		}
+	case *IfStmt:
+		if n.Init != nil {
+			r.pushScope()
+			defer r.popScope()
+			r.node(n.Init)
+		}
+		r.node(n.Conditional)
+		r.node(n.Code)
+		r.node(n.Else)
+	case *ForStmt:
+		if n.Init != nil {
+			r.pushScope()
+			defer r.popScope()
+			r.node(n.Init)
+		}
+		r.node(n.Conditional)
+		r.node(n.Code)
+		r.node(n.PostIteration)
+	case *FunctionCall:
+		r.node(n.Function)
+		r.nodes(n.Args)
+	case *GoStmt:
+		r.node(n.Call)
+	case *SendStmt:
+		r.node(n.Channel)
+		r.node(n.Value)
+	case *Receive:
+		r.node(n.Channel)
+	case *RangeStmt:
+		r.node(n.Expr)
+		if n.NewLocal {
+			r.pushScope()
+			defer r.popScope()
+		}
+		r.target(n.Key, n.NewLocal)
+		r.target(n.Value, n.NewLocal)
+		r.node(n.Code)
+	case *SelectStmt:
+		for _, c := range n.Cases {
+			r.node(c.Channel)
+			r.node(c.Value)
+		}
+		for _, c := range n.Cases {
+			r.pushScope()
+			r.target(c.Target, c.NewLocal)
+			r.target(c.OkTarget, c.NewLocal)
+			r.node(c.Code)
+			r.popScope()
+		}
+	case *BuiltinCall:
+		r.nodes(n.Args)
+	default:
+		r.ok = false
+	}
+}
+
+func (r *resolver) nodes(nodes []Node) {
+	for _, n := range nodes {
+		r.node(n)
+	}
+}
@@ -0,0 +1,511 @@
+package ast
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Scheduler multiplexes the goroutines started by a program, running exactly one at a time. Goroutines only yield
+// when they block on a channel operation, and runnable goroutines are resumed in the order they became runnable, so
+// the execution of a program is always reproducible.
+type Scheduler struct {
+	main       *goroutine
+	current    *goroutine
+	goroutines []*goroutine
+	runQueue   []*goroutine
+	halted     bool
+	deadlock   *ExecutionError
+	aborted    *ExecutionError
+	errors     []ExecutionError
+	wg         sync.WaitGroup
+
+	steps    int
+	maxSteps int
+	ctx      context.Context
+
+	memory     int // bytes held by variables
+	peakMemory int
+	maxMemory  int
+
+	maxDepth int
+	failFast bool
+}
+
+type goroutineState int
+
+const (
+	goroutineRunning goroutineState = iota
+	goroutineRunnable
+	goroutineBlocked
+	goroutineFinished
+)
+
+type goroutine struct {
+	id          int
+	state       goroutineState
+	waitReason  string
+	blockedAt   Node
+	wake        chan bool // receives true if the goroutine should unwind instead of continuing
+	recoverable bool      // true if a halt can be unwound with a panic, which is caught by ExecMain() or spawn()
+}
+
+// haltSignal is panicked to unwind a goroutine once the program has been halted.
+type haltSignal struct{}
+
+func newScheduler(recoverable bool) *Scheduler {
+	s := &Scheduler{}
+	s.main = s.newGoroutine()
+	s.main.recoverable = recoverable
+	s.current = s.main
+	return s
+}
+
+func (s *Scheduler) newGoroutine() *goroutine {
+	g := &goroutine{
+		id:   len(s.goroutines) + 1,
+		wake: make(chan bool, 1),
+	}
+	s.goroutines = append(s.goroutines, g)
+	return g
+}
+
+// ExecMain executes node as the main goroutine of a program, scheduling any goroutines it starts. If every goroutine
+// becomes blocked, execution is halted and a DeadlockErr is added to context.Errors. Goroutines which are still running
+// when node returns are discarded. If the program exceeds context.MaxSteps or context.Ctx is done, it is aborted and a
+// BudgetExceededErr or CancelledErr is added to context.Errors, and likewise a MemoryLimitErr if it exceeds
+// context.MaxMemory or a StackOverflowErr if it exceeds context.MaxDepth. Errors are given the stack of the goroutine
+// which raised them. If context.FailFast is set, the program is aborted by the first error it raises.
+func ExecMain(node Node, context *ExecContext) (ret *Variant) {
+	s := newScheduler(true)
+	s.maxSteps, s.ctx, s.maxMemory, s.maxDepth = context.MaxSteps, context.Ctx, context.MaxMemory, context.MaxDepth
+	s.failFast = context.FailFast
+	context.Scheduler = s
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(haltSignal); !ok {
+				s.fail(internalError(node, r))
+			}
+			ret = &Variant{Type: PrimitiveTypeUndefined}
+		}
+		s.shutdown()
+		context.Errors = append(context.Errors, s.errors...)
+		if s.deadlock != nil {
+			context.Errors = append(context.Errors, *s.deadlock)
+		}
+		if s.aborted != nil {
+			context.Errors = append(context.Errors, *s.aborted)
+		}
+		context.PeakMemory = s.peakMemory
+		traceErrors(context.Errors, context.Stack)
+	}()
+	for _, arg := range context.FunctionNamespace {
+		context.Replace(node, nil, arg)
+	}
+	return node.Exec(context)
+}
+
+// scheduler returns the scheduler of the context, creating one if execution was not started with ExecMain().
+func (context *ExecContext) scheduler() *Scheduler {
+	if context.Scheduler == nil {
+		context.Scheduler = newScheduler(false)
+	}
+	return context.Scheduler
+}
+
+// Step records the evaluation of node, aborting the program if it has exceeded its step budget or been cancelled.
+func (context *ExecContext) Step(node Node) {
+	s := context.Scheduler
+	if s == nil {
+		return
+	}
+	s.steps++
+	if s.maxSteps > 0 && s.steps > s.maxSteps {
+		s.abort(ExecutionError{
+			Class:        BudgetExceededErr,
+			CreatingNode: node,
+			Text:         "Execution exceeded the budget of " + strconv.Itoa(s.maxSteps) + " steps",
+			Stack:        context.Stack.Trace(),
+		})
+	}
+	if s.ctx != nil {
+		select {
+		case <-s.ctx.Done():
+			s.abort(ExecutionError{
+				Class:        CancelledErr,
+				CreatingNode: node,
+				Text:         "Execution cancelled: " + s.ctx.Err().Error(),
+				Stack:        context.Stack.Trace(),
+			})
+		default:
+		}
+	}
+}
+
+// maxDepth returns the maximum depth of the call stack.
+func (context *ExecContext) maxDepth() int {
+	if s := context.Scheduler; s != nil && s.maxDepth > 0 {
+		return s.maxDepth
+	}
+	return DefaultMaxDepth
+}
+
+// canAbort returns true if the current goroutine can be unwound by abort().
+func (s *Scheduler) canAbort() bool {
+	return s.current != s.main || s.main.recoverable
+}
+
+// Raise reports err, which was raised while executing the program. If the program was started with FailFast set,
+// it is aborted with err, otherwise err is added to context.Errors and execution continues.
+func (context *ExecContext) Raise(err ExecutionError) {
+	if s := context.Scheduler; s != nil && s.failFast && s.canAbort() {
+		if err.Stack == nil {
+			err.Stack = context.Stack.Trace()
+		}
+		s.abort(err)
+	}
+	context.Errors = append(context.Errors, err)
+}
+
+// abort halts the program with err, unwinding every goroutine. The current goroutine is unwound first, after which
+// the main goroutine is woken so it can unwind.
+func (s *Scheduler) abort(err ExecutionError) {
+	s.fail(err)
+	panic(haltSignal{})
+}
+
+// fail halts the program with err without unwinding the current goroutine, which must return without executing any
+// further code.
+func (s *Scheduler) fail(err ExecutionError) {
+	s.aborted = &err
+	s.halted = true
+	if g := s.current; g != s.main {
+		g.state = goroutineFinished
+		s.current = s.main
+		s.main.wake <- true
+	}
+}
+
+// internalError returns the error reported when executing node panicked with r, which indicates a bug in the
+// interpreter or in a function implemented in Go.
+func internalError(node Node, r interface{}) ExecutionError {
+	return ExecutionError{
+		Class:        InternalErr,
+		CreatingNode: node,
+		Text:         "Internal error: " + fmt.Sprint(r),
+	}
+}
+
+// spawn queues fn to run on a new goroutine. fn returns any errors it encountered.
+func (s *Scheduler) spawn(fn func() []ExecutionError) {
+	g := s.newGoroutine()
+	g.state = goroutineRunnable
+	s.runQueue = append(s.runQueue, g)
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(haltSignal); !ok {
+					s.fail(internalError(nil, r))
+				}
+			}
+		}()
+
+		if halt := <-g.wake; halt {
+			return
+		}
+		s.errors = append(s.errors, fn()...)
+		s.exit(g)
+	}()
+}
+
+// exit is called by a goroutine when it finishes, transferring control to the next runnable goroutine.
+func (s *Scheduler) exit(g *goroutine) {
+	g.state = goroutineFinished
+	if next := s.dequeue(); next != nil {
+		s.switchTo(next)
+		return
+	}
+	// main must be blocked, as the program would have ended otherwise.
+	s.halt(g)
+}
+
+// park blocks the current goroutine until another goroutine makes it runnable. False is returned if the program was
+// halted while the goroutine was blocked, and the goroutine cannot be unwound.
+func (s *Scheduler) park(node Node, reason string) bool {
+	g := s.current
+	g.state = goroutineBlocked
+	g.waitReason = reason
+	g.blockedAt = node
+
+	if s.halted {
+		return s.unwind(g)
+	}
+	if next := s.dequeue(); next != nil {
+		s.switchTo(next)
+	} else {
+		s.halt(g)
+		return s.unwind(g)
+	}
+
+	if halt := <-g.wake; halt {
+		return s.unwind(g)
+	}
+	return true
+}
+
+// unwind aborts the execution of g after a halt.
+func (s *Scheduler) unwind(g *goroutine) bool {
+	if g.recoverable || g != s.main {
+		panic(haltSignal{})
+	}
+	return false
+}
+
+// halt records that every goroutine is blocked, and wakes the main goroutine so it can unwind. g is the goroutine
+// which detected the condition.
+func (s *Scheduler) halt(g *goroutine) {
+	var blocked []string
+	for _, routine := range s.goroutines {
+		if routine.state == goroutineBlocked {
+			blocked = append(blocked, "goroutine "+strconv.Itoa(routine.id)+" ["+routine.waitReason+"]")
+		}
+	}
+	sort.Strings(blocked)
+	s.halted = true
+	s.deadlock = &ExecutionError{
+		Class:        DeadlockErr,
+		CreatingNode: s.main.blockedAt,
+		Text:         "All goroutines are asleep - deadlock! Blocked: " + strings.Join(blocked, ", "),
+	}
+	if g != s.main {
+		s.current = s.main
+		s.main.wake <- true
+	}
+}
+
+// shutdown halts any goroutines which have not finished, and waits for them to unwind.
+func (s *Scheduler) shutdown() {
+	s.halted = true
+	for _, g := range s.goroutines {
+		if g != s.main && g.state != goroutineFinished {
+			g.state = goroutineFinished
+			g.wake <- true
+		}
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) dequeue() *goroutine {
+	if len(s.runQueue) == 0 {
+		return nil
+	}
+	g := s.runQueue[0]
+	s.runQueue = s.runQueue[1:]
+	return g
+}
+
+func (s *Scheduler) ready(g *goroutine) {
+	g.state = goroutineRunnable
+	s.runQueue = append(s.runQueue, g)
+}
+
+func (s *Scheduler) switchTo(g *goroutine) {
+	g.state = goroutineRunning
+	s.current = g
+	g.wake <- false
+}
+
+// Channel is the runtime state of a channel value.
+type Channel struct {
+	Type     ChannelType
+	capacity int
+	buffer   []*Variant
+	closed   bool
+	recvq    []*chanWaiter
+	sendq    []*chanWaiter
+}
+
+// NewChannel returns a channel carrying values of the given type, which can buffer up to capacity values.
+func NewChannel(t ChannelType, capacity int) *Channel {
+	return &Channel{
+		Type:     t,
+		capacity: capacity,
+	}
+}
+
+// Len returns the number of values buffered in the channel.
+func (c *Channel) Len() int {
+	return len(c.buffer)
+}
+
+// Cap returns the capacity of the channel.
+func (c *Channel) Cap() int {
+	return c.capacity
+}
+
+func (c *Channel) zeroValue() *Variant {
+	v, err := DefaultVariantValue(c.Type.SubType)
+	if err != nil {
+		return &Variant{Type: PrimitiveTypeUndefined}
+	}
+	return v
+}
+
+// waitState is shared by all the waiters of a blocked goroutine, and stores the result of the operation which woke it.
+type waitState struct {
+	g      *goroutine
+	done   bool
+	chosen int
+	value  *Variant
+	ok     bool
+	closed bool
+}
+
+type chanWaiter struct {
+	state *waitState
+	index int
+	value *Variant
+}
+
+func (w *chanWaiter) complete(s *Scheduler, value *Variant, ok, closed bool) {
+	w.state.done = true
+	w.state.chosen = w.index
+	w.state.value = value
+	w.state.ok = ok
+	w.state.closed = closed
+	s.ready(w.state.g)
+}
+
+func popWaiter(q *[]*chanWaiter) *chanWaiter {
+	for len(*q) > 0 {
+		w := (*q)[0]
+		*q = (*q)[1:]
+		if !w.state.done {
+			return w
+		}
+	}
+	return nil
+}
+
+func removeWaiters(q []*chanWaiter, state *waitState) []*chanWaiter {
+	out := q[:0]
+	for _, w := range q {
+		if w.state != state {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// commOp describes a single channel operation, as performed by a send, a receive or a case of a select statement.
+type commOp struct {
+	ch    *Channel
+	send  bool
+	value *Variant
+}
+
+// communicate performs the first of ops which can proceed. If none can, it blocks until one can (if block is set),
+// or returns -1. The index of the chosen operation is returned, along with the value and success of a receive.
+func (s *Scheduler) communicate(node Node, ops []commOp, block bool) (int, *Variant, bool, *ExecutionError) {
+	for i, op := range ops {
+		if op.ch == nil {
+			continue
+		}
+		if op.send {
+			if op.ch.closed {
+				return i, nil, false, &ExecutionError{Class: ChannelErr, CreatingNode: node, Text: "Send on closed channel"}
+			}
+			if w := popWaiter(&op.ch.recvq); w != nil {
+				w.complete(s, MakeVariant(op.value), true, false)
+				return i, nil, false, nil
+			}
+			if len(op.ch.buffer) < op.ch.capacity {
+				op.ch.buffer = append(op.ch.buffer, MakeVariant(op.value))
+				return i, nil, false, nil
+			}
+		} else {
+			if len(op.ch.buffer) > 0 {
+				v := op.ch.buffer[0]
+				op.ch.buffer = op.ch.buffer[1:]
+				if w := popWaiter(&op.ch.sendq); w != nil {
+					op.ch.buffer = append(op.ch.buffer, w.value)
+					w.complete(s, nil, false, false)
+				}
+				return i, v, true, nil
+			}
+			if w := popWaiter(&op.ch.sendq); w != nil {
+				w.complete(s, nil, false, false)
+				return i, w.value, true, nil
+			}
+			if op.ch.closed {
+				return i, op.ch.zeroValue(), false, nil
+			}
+		}
+	}
+	if !block {
+		return -1, nil, false, nil
+	}
+
+	state := &waitState{g: s.current}
+	reason := "select"
+	for i, op := range ops {
+		if op.ch == nil {
+			continue
+		}
+		w := &chanWaiter{state: state, index: i}
+		if op.send {
+			w.value = MakeVariant(op.value)
+			op.ch.sendq = append(op.ch.sendq, w)
+		} else {
+			op.ch.recvq = append(op.ch.recvq, w)
+		}
+	}
+	if len(ops) == 0 {
+		reason = "select (no cases)"
+	} else if len(ops) == 1 && ops[0].send {
+		reason = "chan send"
+	} else if len(ops) == 1 {
+		reason = "chan receive"
+	}
+	if len(ops) == 1 && ops[0].ch == nil {
+		reason += " (nil chan)"
+	}
+
+	if !s.park(node, reason) {
+		return -1, nil, false, s.deadlock
+	}
+	for _, op := range ops {
+		if op.ch != nil {
+			op.ch.recvq = removeWaiters(op.ch.recvq, state)
+			op.ch.sendq = removeWaiters(op.ch.sendq, state)
+		}
+	}
+	if state.closed {
+		return state.chosen, nil, false, &ExecutionError{Class: ChannelErr, CreatingNode: node, Text: "Send on closed channel"}
+	}
+	return state.chosen, state.value, state.ok, nil
+}
+
+// closeChannel closes c, waking all goroutines blocked on it.
+func (s *Scheduler) closeChannel(node Node, c *Channel) *ExecutionError {
+	if c == nil {
+		return &ExecutionError{Class: ChannelErr, CreatingNode: node, Text: "Close of nil channel"}
+	}
+	if c.closed {
+		return &ExecutionError{Class: ChannelErr, CreatingNode: node, Text: "Close of closed channel"}
+	}
+	c.closed = true
+	for w := popWaiter(&c.recvq); w != nil; w = popWaiter(&c.recvq) {
+		w.complete(s, c.zeroValue(), false, false)
+	}
+	for w := popWaiter(&c.sendq); w != nil; w = popWaiter(&c.sendq) {
+		w.complete(s, nil, false, true)
+	}
+	return nil
+}
@@ -30,6 +30,12 @@ const (
 	ComplexTypeArray
 	ComplexTypeStruct
 	ComplexTypeFunction
+	ComplexTypeChannel
+	ComplexTypeSlice
+	ComplexTypePackage
+	PrimitiveTypeError // the predeclared error interface, whose values hold a Go error
+	ComplexTypeTuple
+	ComplexTypeHandle
 	PrimitiveTypeUndefined
 	UnknownType //Used internally to signify the type could be valid but is currently unknown
 )
@@ -38,6 +44,8 @@ const (
 type NamedType struct {
 	Type  TypeKind
 	Ident string
+	// Embedded is set for struct fields declared without a name, whose fields and methods are promoted to the struct.
+	Embedded bool
 }
 
 // BaseType returns the underlying type of the value.
@@ -80,12 +88,37 @@ func (a ArrayType) BaseType() TypeKind {
 	return a.SubType
 }
 
+// SliceType represents a variable-length sequence of elements of type SubType. Slices refer to their elements, so a
+// copy of a slice shares the elements of the original.
+type SliceType struct {
+	SubType TypeKind
+}
+
+func (a SliceType) String() string {
+	return "[]" + a.SubType.String()
+}
+
+// Kind returns ComplexTypeSlice.
+func (a SliceType) Kind() TypeKindDescription {
+	return ComplexTypeSlice
+}
+
+// BaseType returns the type of the elements of the slice.
+func (a SliceType) BaseType() TypeKind {
+	return a.SubType
+}
+
 // StructType represents a named set of fields contained within one structure.
 type StructType struct {
-	Fields []NamedType
+	Fields  []NamedType
+	Name    string // set if the struct was declared with a type declaration
+	Package string // import path of the package which declared the struct, empty for the main package
 }
 
 func (a StructType) String() string {
+	if a.Name != "" {
+		return a.Name
+	}
 	out := "struct{"
 	for i, f := range a.Fields {
 		out += f.String()
@@ -106,13 +139,33 @@ func (a StructType) BaseType() TypeKind {
 	return ComplexTypeStruct //no real base type
 }
 
+// EmbeddedFields returns the names of the embedded fields of the struct.
+func (a StructType) EmbeddedFields() []string {
+	var out []string
+	for _, f := range a.Fields {
+		if f.Embedded {
+			out = append(out, f.Ident)
+		}
+	}
+	return out
+}
+
 // FunctionType represents the parameters, return type and code node of a function.
 type FunctionType struct {
 	Parameters []TypeKind
 	ReturnType TypeKind
 	Code       Node
+	// Variadic is set if the final parameter is a slice, which collects any arguments beyond the other parameters.
+	Variadic bool
+	// Native is set if the function is implemented in Go, in which case Code is nil. Parameters declared with
+	// UnknownType accept values of any type.
+	Native NativeFunc
 }
 
+// NativeFunc implements a function in Go. It is called with the arguments of the call, which invoked the function
+// from node, and returns the result. Errors are reported with context.Raise().
+type NativeFunc func(context *ExecContext, node Node, args []*Variant) *Variant
+
 // Kind returns ComplexTypeFunction.
 func (a FunctionType) Kind() TypeKindDescription {
 	return ComplexTypeFunction
@@ -122,3 +175,78 @@ func (a FunctionType) Kind() TypeKindDescription {
 func (a FunctionType) BaseType() TypeKind {
 	return ComplexTypeFunction //no real base type
 }
+
+// ChanDir represents the directions in which values may travel on a channel.
+type ChanDir int
+
+// Represents the possible channel directions.
+const (
+	ChanBoth ChanDir = iota
+	ChanSend
+	ChanRecv
+)
+
+// ChannelType represents a channel which transports values of type SubType.
+type ChannelType struct {
+	SubType TypeKind
+	Dir     ChanDir
+}
+
+// Kind returns ComplexTypeChannel.
+func (a ChannelType) Kind() TypeKindDescription {
+	return ComplexTypeChannel
+}
+
+// BaseType returns the type of values sent on the channel.
+func (a ChannelType) BaseType() TypeKind {
+	return a.SubType
+}
+
+// PackageType represents an imported package, whose members are the globals of the package.
+type PackageType struct {
+	Path    string
+	Members Namespace
+}
+
+// Kind returns ComplexTypePackage.
+func (a PackageType) Kind() TypeKindDescription {
+	return ComplexTypePackage
+}
+
+// BaseType returns ComplexTypePackage as there is no real base type.
+func (a PackageType) BaseType() TypeKind {
+	return ComplexTypePackage //no real base type
+}
+
+// TupleType represents the results of a function which returns more than one value, such as (int, error).
+type TupleType struct {
+	Types []TypeKind
+}
+
+// Kind returns ComplexTypeTuple.
+func (a TupleType) Kind() TypeKindDescription {
+	return ComplexTypeTuple
+}
+
+// BaseType returns ComplexTypeTuple as there is no real base type.
+func (a TupleType) BaseType() TypeKind {
+	return ComplexTypeTuple //no real base type
+}
+
+// HandleType represents an opaque value owned by the host, such as a database connection. Harsh code can hold handles,
+// pass them to functions and call their methods, but cannot construct them or inspect their contents. Methods are
+// functions implemented in Go, whose first parameter is the receiver.
+type HandleType struct {
+	Name    string
+	Methods Namespace
+}
+
+// Kind returns ComplexTypeHandle.
+func (a HandleType) Kind() TypeKindDescription {
+	return ComplexTypeHandle
+}
+
+// BaseType returns ComplexTypeHandle as there is no real base type.
+func (a HandleType) BaseType() TypeKind {
+	return ComplexTypeHandle //no real base type
+}
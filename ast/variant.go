@@ -1,6 +1,9 @@
 package ast
 
-import "errors"
+import (
+	"errors"
+	"reflect"
+)
 
 // Variant represents a value at runtime.
 type Variant struct {
@@ -12,9 +15,15 @@ type Variant struct {
 	VariableReferenceFailed bool
 	VectorData              []*Variant
 	NamedData               map[string]*Variant
+	EmbeddedFields          []string // names of the struct fields in NamedData whose fields are promoted
+	ChannelData             *Channel
+	Globals                 Namespace   // for functions, the globals of the package which declared the function
+	ErrorData               error       // for errors, the error value - nil if the error is nil
+	HandleData              interface{} // for handles, the Go value owned by the host
 }
 
-// MakeVariant takes a value of type *Variant or a go primitive (int/int64/bool/string) and constructs a *Variant.
+// MakeVariant takes a value of type *Variant, a go primitive (int/int64/bool/string) or an error and constructs a
+// *Variant. If a *Variant is given, a copy is returned as if it were assigned - see Copy().
 func MakeVariant(in interface{}) *Variant {
 	switch v := in.(type) {
 	case TypeKind:
@@ -22,10 +31,7 @@ func MakeVariant(in interface{}) *Variant {
 			Type: v,
 		}
 	case *Variant:
-		temp := *v
-		temp.IsReturn = false
-		temp.VariableReferenceFailed = false
-		return &temp
+		return v.Copy()
 	case int:
 		return &Variant{
 			Type: PrimitiveTypeInt,
@@ -46,6 +52,11 @@ func MakeVariant(in interface{}) *Variant {
 			Type:   PrimitiveTypeString,
 			String: v,
 		}
+	case error:
+		return &Variant{
+			Type:      PrimitiveTypeError,
+			ErrorData: v,
+		}
 	}
 
 	return &Variant{
@@ -53,8 +64,136 @@ func MakeVariant(in interface{}) *Variant {
 	}
 }
 
+// Copy returns a copy of the value with Go assignment semantics. Arrays and structs are values, so their elements are
+// copied recursively, whereas channels, slices and packages are references and the copy refers to the same underlying
+// data.
+func (v *Variant) Copy() *Variant {
+	temp := *v
+	temp.IsReturn = false
+	temp.VariableReferenceFailed = false
+
+	if v.VectorData != nil && v.Type.Kind() != ComplexTypeSlice {
+		temp.VectorData = make([]*Variant, len(v.VectorData))
+		for i, elem := range v.VectorData {
+			if elem != nil {
+				temp.VectorData[i] = elem.Copy()
+			}
+		}
+	}
+	if v.NamedData != nil && v.Type.Kind() != ComplexTypePackage {
+		temp.NamedData = make(map[string]*Variant, len(v.NamedData))
+		for name, field := range v.NamedData {
+			if field != nil {
+				temp.NamedData[name] = field.Copy()
+			}
+		}
+	}
+	return &temp
+}
+
+// Equal returns true if v and o hold the same value, as compared by the == operator. Arrays are compared element-wise,
+// structs field-wise, channels are equal if they refer to the same underlying channel, and errors and handles if they
+// hold equal Go values.
+func (v *Variant) Equal(o *Variant) bool {
+	if v.Type.Kind() != o.Type.Kind() {
+		return false
+	}
+
+	switch v.Type.Kind() {
+	case PrimitiveTypeInt:
+		return v.Int == o.Int
+	case PrimitiveTypeString:
+		return v.String == o.String
+	case PrimitiveTypeBool:
+		return v.Bool == o.Bool
+	case ComplexTypeChannel:
+		return v.ChannelData == o.ChannelData
+	case PrimitiveTypeError:
+		return ErrorsEqual(v.ErrorData, o.ErrorData)
+	case ComplexTypeHandle:
+		return goValuesEqual(v.HandleData, o.HandleData)
+	case ComplexTypeArray:
+		if len(v.VectorData) != len(o.VectorData) {
+			return false
+		}
+		for i := range v.VectorData {
+			if v.VectorData[i] == nil || o.VectorData[i] == nil || !v.VectorData[i].Equal(o.VectorData[i]) {
+				return false
+			}
+		}
+		return true
+	case ComplexTypeStruct:
+		if len(v.NamedData) != len(o.NamedData) {
+			return false
+		}
+		for name, field := range v.NamedData {
+			other, ok := o.NamedData[name]
+			if !ok || field == nil || other == nil || !field.Equal(other) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// ErrorsEqual returns true if a and b are equal Go errors, as compared by the == operator. Errors holding values of
+// the same type which cannot be compared are never equal, rather than causing a panic.
+func ErrorsEqual(a, b error) bool {
+	return goValuesEqual(a, b)
+}
+
+// goValuesEqual compares Go values with the == operator, returning false if the values cannot be compared.
+func goValuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if t := reflect.TypeOf(a); t != reflect.TypeOf(b) || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// SelectField returns the named field of a struct value, which may be promoted from an embedded struct. Nil is
+// returned if no field exists with the name, and ambiguous is set if more than one field is promoted with the name
+// from the same depth.
+func (v *Variant) SelectField(name string) (field *Variant, ambiguous bool) {
+	level := []*Variant{v}
+	for len(level) > 0 {
+		var next []*Variant
+		for _, s := range level {
+			if f, ok := s.NamedData[name]; ok {
+				if field != nil {
+					return nil, true
+				}
+				field = f
+			}
+			for _, embedded := range s.EmbeddedFields {
+				if e := s.NamedData[embedded]; e != nil {
+					next = append(next, e)
+				}
+			}
+		}
+		if field != nil {
+			return field, false
+		}
+		level = next
+	}
+	return nil, false
+}
+
 // DefaultVariantValue returns a valid *Variant setup with the given type, and the appropriate default values.
 func DefaultVariantValue(t TypeKind) (*Variant, error) {
+	return defaultValue(nil, nil, t)
+}
+
+// DefaultValue returns the default value of type t like DefaultVariantValue, reserving the memory of any arrays it
+// holds as allocated by node, so that exceeding the memory limit is reported at the declaration of the value.
+func (context *ExecContext) DefaultValue(node Node, t TypeKind) (*Variant, error) {
+	return defaultValue(context, node, t)
+}
+
+func defaultValue(context *ExecContext, node Node, t TypeKind) (*Variant, error) {
 	ret := &Variant{
 		Type: t,
 	}
@@ -65,31 +204,44 @@ func DefaultVariantValue(t TypeKind) (*Variant, error) {
 	case PrimitiveTypeString:
 	case PrimitiveTypeUndefined:
 	case PrimitiveTypeBool:
+	case PrimitiveTypeError:
+		//default value is a nil error
+	case ComplexTypeHandle:
+		//default value is a nil handle
 	case ComplexTypeArray:
-		context := &ExecContext{}
+		lenContext := &ExecContext{}
 		arrayLen := 0
-		lenEval := t.(ArrayType).Len.Exec(context)
+		lenEval := t.(ArrayType).Len.Exec(lenContext)
 
-		if len(context.Errors) == 0 && lenEval.Type == PrimitiveTypeInt {
+		if len(lenContext.Errors) == 0 && lenEval.Type == PrimitiveTypeInt {
 			arrayLen = int(lenEval.Int)
+			if context != nil {
+				context.reserve(node, vectorSize(lenEval.Int))
+			}
 			ret.VectorData = make([]*Variant, arrayLen)
 			for i := 0; i < arrayLen; i++ {
-				v, e := DefaultVariantValue(t.BaseType())
+				v, e := defaultValue(context, node, t.BaseType())
 				if e != nil {
 					return ret, errors.New("Array basetype error: " + e.Error())
 				}
 				ret.VectorData[i] = v
 			}
-		} else if len(context.Errors) > 0 || lenEval.VariableReferenceFailed {
+		} else if len(lenContext.Errors) > 0 || lenEval.VariableReferenceFailed {
 			return ret, errors.New("Could not statically resolve the length of the given array")
 		} else {
 			return ret, errors.New("Resolved length of array was not an integer")
 		}
 
+	case ComplexTypeChannel:
+		//default value is a nil channel
+	case ComplexTypeSlice:
+		//default value is a nil slice
+
 	case ComplexTypeStruct:
 		ret.NamedData = map[string]*Variant{}
+		ret.EmbeddedFields = t.(StructType).EmbeddedFields()
 		for _, field := range t.(StructType).Fields {
-			fv, err := DefaultVariantValue(field.BaseType())
+			fv, err := defaultValue(context, node, field.BaseType())
 			if err != nil {
 				return ret, err
 			}
@@ -1,6 +1,9 @@
 package ast
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestMakeVariantString(t *testing.T) {
 	v := MakeVariant("abc")
@@ -212,3 +215,139 @@ func TestDefaultVariantValueBasicStruct(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCopyIsDeep(t *testing.T) {
+	inner := &Variant{Type: ComplexTypeArray, VectorData: []*Variant{MakeVariant(1), MakeVariant(2)}}
+	v := &Variant{Type: ComplexTypeStruct, NamedData: map[string]*Variant{"Arr": inner, "Str": MakeVariant("abc")}, IsReturn: true}
+
+	c := v.Copy()
+	c.NamedData["Arr"].VectorData[0].Int = 9
+	c.NamedData["Str"].String = "def"
+
+	if c.IsReturn {
+		t.Error("Expected copy to not be a return value")
+	}
+	if inner.VectorData[0].Int != 1 {
+		t.Errorf("Nested array element modified through copy, got %d", inner.VectorData[0].Int)
+	}
+	if v.NamedData["Str"].String != "abc" {
+		t.Error("Struct field modified through copy")
+	}
+}
+
+func TestCopySharesChannel(t *testing.T) {
+	v := &Variant{ChannelData: NewChannel(ChannelType{SubType: PrimitiveTypeInt}, 1)}
+	if v.Copy().ChannelData != v.ChannelData {
+		t.Error("Expected copy to refer to the same channel")
+	}
+}
+
+func TestEqualComparesElements(t *testing.T) {
+	a := &Variant{Type: ComplexTypeArray, VectorData: []*Variant{MakeVariant(1), MakeVariant("a")}}
+	b := a.Copy()
+	if !a.Equal(b) {
+		t.Error("Expected copies to be equal")
+	}
+	b.VectorData[1].String = "b"
+	if a.Equal(b) {
+		t.Error("Expected arrays with different elements to be unequal")
+	}
+	if MakeVariant(false).Equal(MakeVariant(true)) || !MakeVariant(false).Equal(MakeVariant(false)) {
+		t.Error("Incorrect bool equality")
+	}
+}
+
+type testAddress struct {
+	Street string
+	Zip    uint16 `harsh:"zip"`
+}
+
+type testUser struct {
+	Name     string
+	Tags     []string
+	Scores   [2]int
+	Home     *testAddress
+	Extra    map[string]int
+	Password string `harsh:"-"`
+	age      int
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	in := testUser{
+		Name:     "alice",
+		Tags:     []string{"a", "b"},
+		Scores:   [2]int{1, 2},
+		Home:     &testAddress{Street: "Main St", Zip: 1234},
+		Extra:    map[string]int{"x": 5},
+		Password: "hunter2",
+		age:      3,
+	}
+	v, err := ToVariant(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Type.Kind() != ComplexTypeStruct {
+		t.Fatalf("Expected struct, got %v", v.Type)
+	}
+	if _, ok := v.NamedData["Password"]; ok {
+		t.Error("Expected Password to be ignored")
+	}
+	if _, ok := v.NamedData["age"]; ok {
+		t.Error("Expected unexported field to be ignored")
+	}
+	if zip := v.NamedData["Home"].NamedData["zip"]; zip == nil || zip.Int != 1234 {
+		t.Errorf("Expected Home.zip = 1234, got %v", zip)
+	}
+	if x := v.NamedData["Extra"].NamedData["x"]; x == nil || x.Int != 5 {
+		t.Errorf("Expected Extra.x = 5, got %v", x)
+	}
+
+	var out testUser
+	if err := FromVariant(v, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Password, in.age = "", 0
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Round trip mismatch: got %+v, want %+v", out, in)
+	}
+}
+
+func TestMarshalNilPointerIsZeroValue(t *testing.T) {
+	v, err := ToVariant(testUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := v.NamedData["Home"]
+	if home.Type.Kind() != ComplexTypeStruct || home.NamedData["Street"].String != "" {
+		t.Errorf("Expected zero address, got %+v", home)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	if _, err := ToVariant(struct{ F float64 }{}); err == nil || err.Error() != "field F: unsupported type float64" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	type node struct{ Children []node }
+	if _, err := ToVariant(node{}); err == nil {
+		t.Error("Expected an error for a recursive type")
+	}
+
+	v, err := ToVariant(map[string]interface{}{})
+	if err == nil {
+		t.Errorf("Expected an error for interface{} values, got %v", v)
+	}
+
+	v, _ = ToVariant(testAddress{Street: "Main St", Zip: 1})
+	v.NamedData["zip"] = MakeVariant("abc")
+	var out testAddress
+	if err := FromVariant(v, &out); err == nil || err.Error() != "field zip: cannot use string as int" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	v.NamedData["zip"] = MakeVariant(70000)
+	if err := FromVariant(v, &out); err == nil || err.Error() != "field zip: 70000 overflows uint16" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := FromVariant(v, out); err == nil {
+		t.Error("Expected an error for a non-pointer")
+	}
+}
@@ -0,0 +1,186 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+var errorInterface = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterFunc makes the Go function fn callable from harsh code as name. The signature of the function is derived from
+// the type of fn: parameters and results may be of any type supported by ast.Marshaller, including handles registered
+// with RegisterHandle(). If the final result of fn is an error, it is not returned to harsh code - a non-nil error
+// instead raises an ExecutionError with class HostErr. Calls are typechecked against the signature if fn is registered
+// before the code which calls it is parsed - see NewContext().
+func (c *Context) RegisterFunc(name string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("Cannot register %s: %T is not a function", name, fn)
+	}
+	fnType, err := c.hostFuncType(v.Type())
+	if err != nil {
+		return fmt.Errorf("Cannot register %s: %v", name, err)
+	}
+	fnType.Native = c.hostFunc(v, fnType)
+
+	if c.Globals == nil {
+		c.Globals = ast.Namespace{}
+	}
+	c.Globals[name] = &ast.Variant{Type: fnType}
+	return nil
+}
+
+// RegisterHandle declares name as an opaque handle type, whose values hold Go values of the same type as sample. Harsh
+// code can hold handles and call the listed methods of the Go type, but cannot construct or inspect them. Methods are
+// bound like functions registered with RegisterFunc(). Handles are passed to harsh code as arguments of CallFunc(), or
+// by registered functions which accept or return the Go type. Handle types must be registered before the code which
+// uses them is parsed - see NewContext().
+func (c *Context) RegisterHandle(name string, sample interface{}, methods ...string) (ast.HandleType, error) {
+	t := reflect.TypeOf(sample)
+	h := ast.HandleType{Name: name, Methods: ast.Namespace{}}
+	if t == nil {
+		return h, errors.New("Cannot register " + name + ": sample is nil")
+	}
+	if _, ok := c.handleNamed(name); ok {
+		return h, errors.New("Cannot register " + name + ": a handle with the same name is already registered")
+	}
+
+	if c.handles == nil {
+		c.handles = map[reflect.Type]ast.HandleType{}
+	}
+	c.handles[t] = h //registered before methods are bound, so methods can accept and return the handle
+	for _, method := range methods {
+		m, ok := t.MethodByName(method)
+		if !ok || m.PkgPath != "" {
+			delete(c.handles, t)
+			return h, fmt.Errorf("Cannot register %s: %s has no exported method %s", name, t, method)
+		}
+		fnType, err := c.hostFuncType(m.Type)
+		if err != nil {
+			delete(c.handles, t)
+			return h, fmt.Errorf("Cannot register %s: method %s: %v", name, method, err)
+		}
+		fnType.Parameters[0] = ast.NamedType{Ident: "_", Type: h}
+		fnType.Native = c.hostFunc(m.Func, fnType)
+		h.Methods[method] = &ast.Variant{Type: fnType}
+	}
+	return h, nil
+}
+
+// handleNamed returns the handle type registered with the given name.
+func (c *Context) handleNamed(name string) (ast.HandleType, bool) {
+	for _, h := range c.handles {
+		if h.Name == name {
+			return h, true
+		}
+	}
+	return ast.HandleType{}, false
+}
+
+// marshaller returns the Marshaller used to convert values passed between harsh code and the host.
+func (c *Context) marshaller() ast.Marshaller {
+	return ast.Marshaller{Handles: c.handles}
+}
+
+// hostFuncType returns the harsh signature of a Go function of type t.
+func (c *Context) hostFuncType(t reflect.Type) (ast.FunctionType, error) {
+	fnType := ast.FunctionType{
+		ReturnType: ast.PrimitiveTypeUndefined,
+		Variadic:   t.IsVariadic(),
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		p, err := c.marshaller().TypeOf(t.In(i))
+		if err != nil {
+			return fnType, fmt.Errorf("parameter %d: %v", i, err)
+		}
+		fnType.Parameters = append(fnType.Parameters, ast.NamedType{Ident: "p" + strconv.Itoa(i), Type: p})
+	}
+
+	numOut := t.NumOut()
+	if numOut > 0 && t.Out(numOut-1) == errorInterface {
+		numOut-- //errors are raised as execution errors
+	}
+	var results []ast.TypeKind
+	for i := 0; i < numOut; i++ {
+		r, err := c.marshaller().TypeOf(t.Out(i))
+		if err != nil {
+			return fnType, fmt.Errorf("result %d: %v", i, err)
+		}
+		results = append(results, r)
+	}
+	if len(results) == 1 {
+		fnType.ReturnType = results[0]
+	} else if len(results) > 1 {
+		fnType.ReturnType = ast.TupleType{Types: results}
+	}
+	return fnType, nil
+}
+
+// hostFunc returns the native implementation of a function registered with RegisterFunc, which converts its
+// arguments to Go values, calls fn, and converts the results to Variants.
+func (c *Context) hostFunc(fn reflect.Value, fnType ast.FunctionType) ast.NativeFunc {
+	t := fn.Type()
+	return func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			v, err := c.marshaller().Value(arg, t.In(i))
+			if err != nil {
+				return hostError(context, node, "Invalid argument "+strconv.Itoa(i)+": "+err.Error())
+			}
+			in[i] = v
+		}
+
+		out, panicked := callHost(fn, in)
+		if panicked != nil {
+			return hostError(context, node, fmt.Sprint("Host function panicked: ", panicked))
+		}
+
+		if n := len(out); n > 0 && t.Out(n-1) == errorInterface {
+			if err, _ := out[n-1].Interface().(error); err != nil {
+				return hostError(context, node, err.Error())
+			}
+			out = out[:n-1]
+		}
+		if len(out) == 0 {
+			return &ast.Variant{Type: ast.PrimitiveTypeUndefined}
+		}
+		ret := &ast.Variant{Type: fnType.ReturnType}
+		for i, v := range out {
+			r, err := c.marshaller().Variant(v)
+			if err != nil {
+				return hostError(context, node, "Invalid result "+strconv.Itoa(i)+": "+err.Error())
+			}
+			ret.VectorData = append(ret.VectorData, r)
+		}
+		if len(out) == 1 {
+			return ret.VectorData[0]
+		}
+		return ret
+	}
+}
+
+// callHost calls fn with the arguments in, returning the value fn panicked with if it panics. Errors are raised once
+// the panic is recovered, as raising an error may itself panic to halt the program.
+func callHost(fn reflect.Value, in []reflect.Value) (out []reflect.Value, panicked interface{}) {
+	defer func() {
+		panicked = recover()
+	}()
+	if fn.Type().IsVariadic() {
+		return fn.CallSlice(in), nil //the variadic arguments are collected into a slice by the caller
+	}
+	return fn.Call(in), nil
+}
+
+// hostError reports an error raised by a host function, returning an undefined value.
+func hostError(context *ast.ExecContext, node ast.Node, text string) *ast.Variant {
+	context.Raise(ast.ExecutionError{
+		Class:        ast.HostErr,
+		CreatingNode: node,
+		Text:         text,
+	})
+	return &ast.Variant{Type: ast.PrimitiveTypeUndefined}
+}
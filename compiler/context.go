@@ -1,7 +1,10 @@
 package compiler
 
 import (
+	goast "go/ast"
 	"go/token"
+	"io"
+	"reflect"
 
 	"github.com/twitchyliquid64/harsh/ast"
 )
@@ -9,12 +12,85 @@ import (
 // Context represents a parsed Go module.
 type Context struct {
 	Name          string
+	Path          string // import path of the package, empty unless it was loaded by an Importer
 	ConType       conType
 	Declarations  []ast.NamedType
 	ChildContexts []*Context
 	Debug         bool
 	Globals       ast.Namespace
 	Errors        []TranslateError
+	Output        io.Writer // receives anything printed by functions called with CallFunc(), os.Stdout if nil
+	MaxSteps      int       // limits the number of nodes evaluated by each call of CallFunc(), if non-zero
+	MaxMemory     int       // limits the approximate bytes of memory used by each call of CallFunc(), if non-zero
+	PeakMemory    int       // the approximate peak bytes of memory used by the last call of CallFunc()
+	MaxDepth      int       // limits the depth of the call stack, ast.DefaultMaxDepth if zero
+	// ContinueOnError makes CallFunc() collect every error raised by the function and continue executing, rather than
+	// stopping at the first. This suits generating and scoring many programs, which may raise errors along the way.
+	ContinueOnError bool
+
+	methods        map[string]map[string]*goast.FuncDecl // method declarations, keyed by receiver type then method name
+	resolvingTypes map[*goast.TypeSpec]bool              // type declarations currently being converted
+	typeArgs       map[*goast.Object]ast.TypeKind        // type arguments of the generic declaration being instantiated
+	instances      map[string]bool                       // names of generic functions which have been instantiated
+	importer       *Importer                             // loads imported packages, nil if imports are not supported
+	imports        map[string]*Context                   // imported packages, keyed by the name they are imported as
+	scope          map[string]*goast.Object              // package-level declarations, for qualified identifiers
+	handles        map[reflect.Type]ast.HandleType       // handle types registered with RegisterHandle(), keyed by Go type
+}
+
+// newFileContext returns a context for translating one file of the package represented by c. Files share the globals,
+// methods, imports and generic instances of their package.
+func (c *Context) newFileContext() *Context {
+	if c.Globals == nil {
+		c.Globals = ast.Namespace(map[string]*ast.Variant{})
+	}
+	if c.methods == nil {
+		c.methods = map[string]map[string]*goast.FuncDecl{}
+	}
+	if c.instances == nil {
+		c.instances = map[string]bool{}
+	}
+	return &Context{
+		ConType:   ContextFile,
+		Path:      c.Path,
+		Debug:     c.Debug,
+		Globals:   c.Globals,
+		methods:   c.methods,
+		instances: c.instances,
+		importer:  c.importer,
+		imports:   c.imports,
+		scope:     c.scope,
+		handles:   c.handles,
+	}
+}
+
+// AllDeclarations returns the declarations of the context, followed by those of any child contexts.
+func (c *Context) AllDeclarations() []ast.NamedType {
+	out := append([]ast.NamedType{}, c.Declarations...)
+	for _, child := range c.ChildContexts {
+		out = append(out, child.AllDeclarations()...)
+	}
+	return out
+}
+
+// hasMethod returns true if a method with the given name is declared on the named struct type.
+func (c *Context) hasMethod(st ast.StructType, method string) bool {
+	return c.methodDecl(st, method) != nil
+}
+
+// methodDecl returns the declaration of the named method of a struct type, which may be declared by an imported
+// package. Nil is returned if no such method exists.
+func (c *Context) methodDecl(st ast.StructType, method string) *goast.FuncDecl {
+	pkg := c.packageOf(st.Package)
+	if pkg == nil {
+		return nil
+	}
+	return pkg.methods[st.Name][method]
+}
+
+// methodName returns the name under which a method is stored in the globals of a Context.
+func methodName(typeName, method string) string {
+	return typeName + "." + method
 }
 
 type declaration struct {
@@ -48,6 +124,8 @@ const (
 	InternalErr
 	//NotDeclared
 	NotDeclaredErr
+	// ImportErr indicates an imported package could not be loaded, or could not be translated.
+	ImportErr
 )
 
 // TranslateError represents any issue translating the go.ast format into harsh's native AST format.
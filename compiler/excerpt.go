@@ -0,0 +1,42 @@
+package compiler
+
+import (
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Excerpt returns the line of source at pos, followed by a line with a caret under the column of pos, for showing
+// where an error occurred. The source is read from pos.Filename. An empty string is returned if pos is invalid or
+// the line cannot be read.
+func Excerpt(pos token.Position) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	src, err := os.ReadFile(pos.Filename)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(src), "\n")
+	if pos.Line > len(lines) {
+		return ""
+	}
+	return excerptLine(strings.TrimRight(lines[pos.Line-1], "\r"), pos)
+}
+
+// excerptLine formats line, which is the source at pos, with a caret under the column of pos. Tabs before the
+// column are kept so the caret lines up with the source.
+func excerptLine(line string, pos token.Position) string {
+	var indent strings.Builder
+	for i := 0; i < pos.Column-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			indent.WriteByte('\t')
+		} else {
+			indent.WriteByte(' ')
+		}
+	}
+	number := strconv.Itoa(pos.Line)
+	gutter := strings.Repeat(" ", len(number))
+	return " " + number + " | " + line + "\n " + gutter + " | " + indent.String() + "^\n"
+}
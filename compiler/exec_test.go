@@ -1,7 +1,14 @@
 package compiler
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/twitchyliquid64/harsh/ast"
 )
@@ -803,3 +810,2319 @@ func TestMultiFunctionDeclAndCall(t *testing.T) {
 		t.Error("Incorrect value")
 	}
 }
+
+func TestGoroutineProducerConsumer(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		var total int
+
+		func producer(ch chan int, n int) {
+			for _, v := range [3]int{n, n * 2, n * 3} {
+				ch <- v
+			}
+			close(ch)
+		}
+
+    func Test() int {
+			ch := make(chan int)
+			go producer(ch, 2)
+			for v := range ch {
+				total = total + v
+			}
+			return total
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Type != ast.PrimitiveTypeInt {
+		t.Error("Expected PrimitiveTypeInt")
+	}
+	if r.Int != 12 {
+		t.Error("Incorrect value")
+	}
+}
+
+func TestBufferedChannelWithoutGoroutines(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+    func Test() int {
+			ch := make(chan int, 2)
+			ch <- 3
+			ch <- 4
+			return <-ch * 10 + <-ch
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 34 {
+		t.Error("Incorrect value")
+	}
+}
+
+func TestGoroutineSchedulingIsDeterministic(t *testing.T) {
+	code := `
+    package test
+
+		var out string
+
+		func worker(name string, in chan int, done chan bool) {
+			for range in {
+				out = out + name
+			}
+			done <- true
+		}
+
+    func Test() string {
+			in := make(chan int)
+			done := make(chan bool)
+			go worker("a", in, done)
+			go worker("b", in, done)
+			for _, v := range [6]int{1, 2, 3, 4, 5, 6} {
+				in <- v
+			}
+			close(in)
+			<-done
+			<-done
+			return out
+    }
+    `
+
+	for i := 0; i < 20; i++ {
+		c, err := ParseLiteral("test.go", code)
+		if err != nil {
+			t.Error("ParseLiteral(): Error")
+			t.Error(err)
+			t.FailNow()
+		}
+
+		r, er := c.CallFunc("Test", map[string]interface{}{})
+		if er != nil {
+			t.Error("Errors when executing")
+			t.Error(er)
+			t.FailNow()
+		}
+		if r.String != "aaabab" {
+			t.Error("Incorrect value: " + r.String)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDeadlockReportsBlockedGoroutines(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		func stuck(ch chan int) {
+			ch <- 1
+		}
+
+    func Test() int {
+			ch := make(chan int)
+			unused := make(chan int)
+			go stuck(unused)
+			return <-ch
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	_, er := c.CallFunc("Test", map[string]interface{}{})
+	execErr, ok := er.(ExecutionError)
+	if !ok {
+		t.Error("Expected ExecutionError")
+		t.FailNow()
+	}
+	if len(execErr.Errors) != 1 || execErr.Errors[0].Class != ast.DeadlockErr {
+		t.Error("Expected a single DeadlockErr")
+		t.FailNow()
+	}
+	if !strings.Contains(execErr.Errors[0].Text, "goroutine 1 [chan receive]") ||
+		!strings.Contains(execErr.Errors[0].Text, "goroutine 2 [chan send]") {
+		t.Error("Expected both goroutines to be listed, got: " + execErr.Errors[0].Text)
+	}
+}
+
+func TestSelectChoosesReadyCase(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+    func Test() int {
+			a := make(chan int, 1)
+			b := make(chan int, 1)
+			b <- 5
+			select {
+			case v := <-a:
+				return v
+			case v := <-b:
+				return v * 2
+			}
+			return 0
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 10 {
+		t.Error("Incorrect value")
+	}
+}
+
+func TestSelectDefaultAndClosedReceive(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+    func Test() int {
+			a := make(chan int)
+			select {
+			case a <- 1:
+				return 1
+			default:
+			}
+			close(a)
+			select {
+			case v, ok := <-a:
+				if ok {
+					return 2
+				}
+				return v + 3
+			}
+			return 0
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 3 {
+		t.Error("Incorrect value")
+	}
+}
+
+func TestSendOnClosedChannelErrors(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+    func Test() {
+			a := make(chan int, 1)
+			close(a)
+			a <- 1
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	_, er := c.CallFunc("Test", map[string]interface{}{})
+	execErr, ok := er.(ExecutionError)
+	if !ok {
+		t.Error("Expected ExecutionError")
+		t.FailNow()
+	}
+	if len(execErr.Errors) != 1 || execErr.Errors[0].Class != ast.ChannelErr {
+		t.Error("Expected a single ChannelErr")
+	}
+}
+
+func TestBlockShadowingDoesNotAffectOuterVariable(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+    func Test() int {
+			x := 1
+			if true {
+				x := 2
+				x = x + 40
+			}
+			return x
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 1 {
+		t.Errorf("Incorrect value, got %d", r.Int)
+	}
+}
+
+func TestInnerBlockAssignsOuterVariable(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+    func Test() int {
+			sum := 0
+			for i := 0; i != 5; i = i + 1 {
+				sum = sum + i
+			}
+			if sum == 10 {
+				sum = sum * 2
+			}
+			return sum
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 20 {
+		t.Errorf("Incorrect value, got %d", r.Int)
+	}
+	if _, leaked := c.Globals["sum"]; leaked {
+		t.Error("Local variable written to globals")
+	}
+}
+
+func TestLoopBodyShadowingPerIteration(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		var out string
+
+    func Test() string {
+			x := "outer"
+			for _, v := range [3]string{"a", "b", "c"} {
+				x := v
+				out = out + x
+			}
+			return out + x
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.String != "abcouter" {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+func TestArrayAssignmentCopies(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+    func Test() int {
+			a := [3]int{1, 2, 3}
+			b := a
+			b[0] = 9
+			a[2] = 7
+			return a[0] + b[0] + b[2]
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 13 {
+		t.Errorf("Incorrect value, got %d", r.Int)
+	}
+}
+
+func TestStructAssignmentCopies(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+    func Test() string {
+			a := struct{
+				Name string
+				Inner [2]int
+			}{
+				Name: "abc",
+			}
+			b := a
+			b.Name = "def"
+			b.Inner[1] = 4
+			if a.Inner[1] != 0 {
+				return "inner modified"
+			}
+			return a.Name + b.Name
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.String != "abcdef" {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+func TestArrayArgumentPassedByValue(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		func modify(arr [2]int) int {
+			arr[0] = 5
+			return arr[0]
+		}
+
+    func Test() int {
+			a := [2]int{1, 2}
+			m := modify(a)
+			return m + a[0]
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 6 {
+		t.Errorf("Incorrect value, got %d", r.Int)
+	}
+}
+
+func TestArrayAndStructEquality(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+    func Test() string {
+			out := ""
+			a := [3]int{1, 2, 3}
+			b := a
+			if a == b {
+				out = out + "a"
+			}
+			b[1] = 5
+			if a != b {
+				out = out + "b"
+			}
+			s1 := struct{
+				Name string
+				Vals [2]bool
+			}{
+				Name: "abc",
+			}
+			s2 := s1
+			if s1 == s2 {
+				out = out + "c"
+			}
+			s2.Vals[1] = true
+			if s1 == s2 {
+				out = out + "!"
+			}
+			s1.Vals[1] = true
+			if s1 == s2 {
+				out = out + "d"
+			}
+			return out
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.String != "abcd" {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+func TestEmbeddedStructPromotesFieldsAndMethods(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		type Base struct {
+			ID   int
+			Name string
+		}
+
+		func (b Base) Describe() string {
+			return b.Name
+		}
+
+		type Derived struct {
+			Base
+			Extra string
+		}
+
+    func Test() string {
+			d := Derived{
+				Base:  Base{ID: 1, Name: "base"},
+				Extra: "x",
+			}
+			d.ID = 5
+			if d.Base.ID != 5 {
+				return "promoted field not assigned"
+			}
+			return d.Describe() + d.Extra
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.String != "basex" {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+func TestShallowerFieldShadowsPromotedField(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		type Inner struct {
+			Name string
+		}
+
+		type Outer struct {
+			Inner
+			Name string
+		}
+
+		var o Outer
+
+    func Test() string {
+			o.Name = "outer"
+			o.Inner.Name = "inner"
+			return o.Name
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.String != "outer" {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+func TestVariadicFunctionCalls(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		func sum(base int, xs ...int) int {
+			total := base
+			for _, x := range xs {
+				total = total + x
+			}
+			return total
+		}
+
+    func Test() int {
+			xs := []int{10, 20}
+			return sum(1) + sum(0, 1, 2) + sum(0, xs...)
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 34 {
+		t.Errorf("Incorrect value, got %d", r.Int)
+	}
+}
+
+func TestSpreadSliceSharesElements(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		func zero(xs ...int) {
+			xs[0] = 0
+		}
+
+    func Test() int {
+			xs := []int{5, 6}
+			ys := xs
+			ys[1] = 7
+			zero(xs...)
+			return xs[0] + xs[1]
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 7 {
+		t.Errorf("Incorrect value, got %d", r.Int)
+	}
+}
+
+func TestLenAndAppend(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		type point struct {
+			X int
+		}
+
+    func Test() int {
+			var xs []int
+			xs = append(xs, 1, 2)
+			ys := append(xs, xs...)
+			ys[0] = 5
+			p := point{X: 3}
+			ps := append([]point{}, p)
+			p.X = 4
+			n := len(xs) + len(ys) + len([3]int{1, 2, 3}) + len("harsh")
+			return n*100 + xs[0]*10 + ps[0].X
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 1413 {
+		t.Errorf("Incorrect value, got %d", r.Int)
+	}
+}
+
+func TestGenericFunctionsAndTypes(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		type Number interface {
+			~int | string
+		}
+
+		type Pair[K comparable, V any] struct {
+			Key K
+			Val V
+		}
+
+		func Sum[T Number](xs ...T) T {
+			var total T
+			for _, x := range xs {
+				total = total + x
+			}
+			return total
+		}
+
+		func Contains[T comparable](xs []T, v T) bool {
+			for _, x := range xs {
+				if x == v {
+					return true
+				}
+			}
+			return false
+		}
+
+		func MakePair[K comparable, V any](k K, v V) Pair[K, V] {
+			return Pair[K, V]{Key: k, Val: v}
+		}
+
+    func Test() string {
+			p := MakePair("a", 5)
+			out := Sum("x", "y") + p.Key
+			if Contains([]int{1, 2, 3}, Sum[int](1, 1)) {
+				out = out + "c"
+			}
+			if !Contains([]string{"q"}, "z") {
+				out = out + "d"
+			}
+			if p.Val != 5 {
+				return "incorrect pair value"
+			}
+			return out
+    }
+    `)
+
+	if err != nil {
+		t.Error("ParseLiteral(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+	if len(c.Errors) != 0 {
+		t.Errorf("Unexpected translation errors: %v", c.Errors)
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.String != "xyacd" {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+func TestGenericFunctionParameters(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		import "strconv"
+
+		func Map[T, U any](xs []T, f func(T) U) []U {
+			var out []U
+			for _, x := range xs {
+				out = append(out, f(x))
+			}
+			return out
+		}
+
+		func Filter[T any](xs []T, keep func(T) bool) []T {
+			var out []T
+			for _, x := range xs {
+				if keep(x) {
+					out = append(out, x)
+				}
+			}
+			return out
+		}
+
+		func double(x int) int {
+			return x * 2
+		}
+
+		func odd(x int) bool {
+			return x % 2 == 1
+		}
+
+		func notThree(s string) bool {
+			return s != "3"
+		}
+
+    func Test() string {
+			inferred := Map(Filter([]int{1, 2, 3, 5}, odd), strconv.Itoa)
+			explicit := Map[int, int]([]int{1, 2}, double)
+			out := ""
+			for _, s := range Filter[string](inferred, notThree) {
+				out = out + s
+			}
+			for _, n := range explicit {
+				out = out + strconv.Itoa(n)
+			}
+			return out
+    }
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) != 0 {
+		t.Fatalf("Unexpected translation errors: %v", c.Errors)
+	}
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Fatal(er.(ExecutionError).Errors)
+	}
+	if r.String != "1524" {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+func TestParsePackageResolvesAcrossFiles(t *testing.T) {
+	c, err := ParsePackage(map[string]string{
+		"a.go": `
+    package test
+
+		type Point struct {
+			X int
+		}
+
+    func Test() int {
+			return double(Point{X: 4}) + offset
+    }
+    `,
+		"b.go": `
+    package test
+
+		var offset int
+
+		func double(p Point) int {
+			return p.X + p.X
+		}
+    `,
+		"b_test.go": `
+    package test
+
+		func double(p Point) int {
+			return 0
+		}
+    `,
+		"c_other.go": `//go:build harshtestexclude
+
+    package test
+
+		func double(p Point) int {
+			return 0
+		}
+    `,
+	})
+
+	if err != nil {
+		t.Error("ParsePackage(): Error")
+		t.Error(err)
+		t.FailNow()
+	}
+	if len(c.Errors) != 0 {
+		t.Errorf("Unexpected translation errors: %v", c.Errors)
+	}
+	if len(c.ChildContexts) != 2 {
+		t.Errorf("Expected 2 file contexts, got %d", len(c.ChildContexts))
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error("Errors when executing")
+		t.Error(er)
+	}
+	if r.Int != 8 {
+		t.Errorf("Incorrect value, got %d", r.Int)
+	}
+}
+
+func TestParsePackageBuildTags(t *testing.T) {
+	files := map[string]string{
+		"a.go": `
+    package test
+
+    func Test() int {
+			return value()
+    }
+    `,
+		"b.go": `//go:build !harshtest
+
+    package test
+
+		func value() int {
+			return 1
+		}
+    `,
+		"c.go": `//go:build harshtest
+
+    package test
+
+		func value() int {
+			return 2
+		}
+    `,
+	}
+
+	for tag, want := range map[string]int64{"": 1, "harshtest": 2} {
+		c, err := ParsePackage(files, tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, er := c.CallFunc("Test", map[string]interface{}{})
+		if er != nil {
+			t.Error(er)
+		}
+		if r.Int != want {
+			t.Errorf("Tag %q: expected %d, got %d", tag, want, r.Int)
+		}
+	}
+}
+
+func TestParsePackageRejectsMixedPackages(t *testing.T) {
+	_, err := ParsePackage(map[string]string{
+		"a.go": "package a\n",
+		"b.go": "package b\n",
+	})
+	if err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestParseDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package test\n\nfunc Test() string {\n\treturn name()\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "name.go"), []byte("package test\n\nfunc name() string {\n\treturn \"abc\"\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ParseDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error(er)
+	}
+	if r.String != "abc" {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+// writeModule writes the given files, keyed by their slash-separated path, below a temporary directory.
+func writeModule(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, code := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestImportedPackages(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"main.go": `package main
+
+import (
+	"example.com/app/geo"
+	u "example.com/app/util"
+)
+
+func Test() int {
+	geo.SetOffset(100)
+	p := geo.Point{X: 1, Y: 2}
+	u.Calls = 5
+	var q geo.Point
+	q.X = geo.First(u.Calls, 0)
+	return p.Sum() + q.Sum()
+}
+`,
+		"geo/geo.go": `package geo
+
+import "example.com/app/util"
+
+var offset int
+
+type Point struct {
+	X int
+	Y int
+}
+
+func (p Point) Sum() int {
+	return util.Add(p.X, p.Y) + offset
+}
+
+func SetOffset(v int) {
+	offset = v
+}
+
+func First[T any](a T, b T) T {
+	return a
+}
+`,
+		"util/util.go": `package util
+
+var Calls int
+
+func Add(a int, b int) int {
+	return a + b
+}
+`,
+	})
+
+	c, err := NewImporter(root, "example.com/app").Import("example.com/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error(er)
+	}
+	if r.Int != 208 {
+		t.Error("Incorrect value: ", r.Int)
+	}
+}
+
+func TestImportDir(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"cmd/main.go":  "package main\n\nimport \"example.com/app/util\"\n\nfunc Test() string {\n\treturn util.Name()\n}\n",
+		"util/util.go": "package util\n\nfunc Name() string {\n\treturn name\n}\n\nvar name string\n",
+	})
+	c, err := NewImporter(root, "example.com/app").ImportDir(filepath.Join(root, "cmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Path != "example.com/app/cmd" {
+		t.Error("Incorrect import path: " + c.Path)
+	}
+	if _, er := c.CallFunc("Test", map[string]interface{}{}); er != nil {
+		t.Error(er)
+	}
+	if _, err := NewImporter(root, "example.com/app").Import("example.com/other"); err == nil {
+		t.Error("Expected error importing a package outside the module")
+	}
+}
+
+func TestImportUnexportedProducesError(t *testing.T) {
+	for _, code := range []string{
+		"util.helper()",
+		"v := util.T{x: 1}\n\tv = v",
+		"var v util.T\n\tv.x = 1",
+		"var v util.T\n\tv.get()",
+	} {
+		root := writeModule(t, map[string]string{
+			"main.go":      "package main\n\nimport \"example.com/app/util\"\n\nfunc Test() {\n\t" + code + "\n}\n",
+			"util/util.go": "package util\n\ntype T struct {\n\tx int\n}\n\nfunc (t T) get() int {\n\treturn t.x\n}\n\nfunc helper() {\n}\n",
+		})
+		c, err := NewImporter(root, "example.com/app").Import("example.com/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Errors) == 0 {
+			t.Error("Expected error for " + code)
+			continue
+		}
+		if c.Errors[0].Class != NotDeclaredErr || !strings.Contains(c.Errors[0].Text, "unexported") {
+			t.Error("Incorrect error for "+code+": ", c.Errors[0])
+		}
+	}
+}
+
+func TestImportCycleProducesError(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"a/a.go": "package a\n\nimport \"m/b\"\n\nfunc A() int {\n\treturn b.B()\n}\n",
+		"b/b.go": "package b\n\nimport \"m/a\"\n\nfunc B() int {\n\treturn a.A()\n}\n",
+	})
+	c, err := NewImporter(root, "m").Import("m/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) == 0 {
+		t.Fatal("Expected error")
+	}
+	if c.Errors[0].Class != ImportErr || !strings.Contains(c.Errors[0].Text, "Import cycle not allowed: m/a imports m/b imports m/a") {
+		t.Error("Incorrect error: ", c.Errors[0])
+	}
+}
+
+func TestStandardLibrary(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import (
+		"math"
+		"sort"
+		"strconv"
+		"strings"
+		"unicode"
+	)
+
+	var words []string
+
+	func byLength(i int, j int) bool {
+		a := strings.Count(words[i], "")
+		b := strings.Count(words[j], "")
+		return a != b && math.Min(a, b) == a
+	}
+
+	func Test() string {
+		words = strings.Split("ccc,a,bb", ",")
+		sort.Slice(words, byLength)
+		nums := []int{3, 1, 2}
+		sort.Ints(nums)
+		out := strings.Join(words, "-") + strconv.Itoa(nums[0]*100+nums[1]*10+nums[2])
+		if unicode.IsUpper('A') && !unicode.IsUpper('a') {
+			out = out + strings.ToUpper("x")
+		}
+		if _, err := strconv.Atoi("x"); err == nil {
+			return "no error"
+		}
+		n, err := strconv.Atoi("7")
+		if err != nil {
+			return err.Error()
+		}
+		return out + strconv.Itoa(math.Pow(2, 10)+n)
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error(er)
+	}
+	if r.String != "a-bb-ccc123X1031" {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+func TestStandardLibraryErrorsAreExecutionErrors(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import "strconv"
+
+	func Test() string {
+		return strconv.FormatInt(10, 1)
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, er := c.CallFunc("Test", map[string]interface{}{})
+	execErr, ok := er.(ExecutionError)
+	if !ok {
+		t.Fatal("Expected ExecutionError, got ", er)
+	}
+	if execErr.Errors[0].Class != ast.HostErr {
+		t.Error("Incorrect error class: ", execErr.Errors[0])
+	}
+}
+
+func TestImportUnknownPackageProducesError(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import "os"
+
+	func Test() {
+		os.Exit(1)
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) == 0 || c.Errors[0].Class != ImportErr {
+		t.Error("Expected ImportErr, got ", c.Errors)
+	}
+}
+
+func TestFmtPrintsToContextOutput(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import "fmt"
+
+	type point struct {
+		X int
+		Y int
+	}
+
+	type label struct {
+		X    int
+		Name string
+	}
+
+	func worker(done chan bool) {
+		fmt.Print("goroutine;")
+		done <- true
+	}
+
+	func Test() string {
+		var p point
+		p.X = 3
+		fmt.Println("p is", p)
+		fmt.Printf("%+v %q\n", p, "s")
+		fmt.Printf("%+v\n", label{X: 3})
+		done := make(chan bool)
+		go worker(done)
+		<-done
+		return fmt.Sprintf("%03d|%-3s|%t", 7, "a", true)
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	var out strings.Builder
+	c.Output = &out
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Error(er)
+	}
+	if r.String != "007|a  |true" {
+		t.Error("Incorrect value: " + r.String)
+	}
+	if out.String() != "p is {3 0}\n{X:3 Y:0} \"s\"\n{X:3 Name:}\ngoroutine;" {
+		t.Errorf("Incorrect output: %q", out.String())
+	}
+}
+
+func TestErrorsAndMultipleResults(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import (
+		"errors"
+		"fmt"
+	)
+
+	func find(notFound error, key string) (int, error) {
+		if key == "" {
+			return 0, notFound
+		}
+		return len2(key), nil
+	}
+
+	func len2(s string) int {
+		if s == "ab" {
+			return 2
+		}
+		return 1
+	}
+
+	func lookup(notFound error, key string) (int, error) {
+		n, err := find(notFound, key)
+		if err != nil {
+			return 0, fmt.Errorf("lookup %q: %w", key, err)
+		}
+		return n, nil
+	}
+
+	func Test() string {
+		notFound := errors.New("not found")
+		var out string
+		n, err := lookup(notFound, "ab")
+		if err == nil {
+			out = out + fmt.Sprint(n)
+		}
+		_, err = lookup(notFound, "")
+		if err != nil && errors.Is(err, notFound) && errors.Unwrap(err) == notFound {
+			out = out + "|" + err.Error()
+		}
+		var zero error
+		if zero == nil && errors.New("x") != errors.New("x") {
+			out = out + "|" + fmt.Sprint(zero)
+		}
+		a, b := 1, 2
+		a, b = b, a
+		return out + fmt.Sprintf("|%d%d", a, b)
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Fatal(er)
+	}
+	if r.String != `2|lookup "": not found|<nil>|21` {
+		t.Error("Incorrect value: " + r.String)
+	}
+}
+
+func TestSentinelErrorGlobals(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import "errors"
+
+	var ErrNotFound error = errors.New("not found")
+	var ErrInvalid = errors.New("invalid")
+	var none error
+	var limit = 2 * 5
+
+	func pair() (int, string) {
+		return 1, "a"
+	}
+
+	var n, s = pair()
+
+	func find(key int) error {
+		if key == 0 {
+			return ErrInvalid
+		}
+		if key != limit {
+			return ErrNotFound
+		}
+		return none
+	}
+
+	func Test() string {
+		var found = find(limit)
+		if errors.Is(find(1), ErrNotFound) && !errors.Is(find(0), ErrNotFound) && found == nil {
+			return ErrInvalid.Error() + s
+		}
+		return ""
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Fatal(er)
+	}
+	if r.String != "invalida" {
+		t.Error("Incorrect value: " + r.String)
+	}
+	if c.Globals["limit"].Int != 10 || c.Globals["n"].Int != 1 {
+		t.Errorf("Incorrect globals: limit=%d n=%d", c.Globals["limit"].Int, c.Globals["n"].Int)
+	}
+}
+
+func TestGroupedSentinelErrorGlobals(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import "errors"
+
+	var (
+		ErrA = errors.New("a")
+		ErrB = errors.New("b")
+	)
+
+	var (
+		count int
+		label string
+	)
+
+	func Test() string {
+		count = count + 1
+		label = ErrA.Error() + ErrB.Error()
+		if errors.Is(ErrB, ErrA) {
+			return ""
+		}
+		return label
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Fatal(er)
+	}
+	if r.String != "ab" || c.Globals["count"].Int != 1 {
+		t.Errorf("Incorrect value %q with count %d", r.String, c.Globals["count"].Int)
+	}
+}
+
+func TestReceiveWithOk(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	func Test() int {
+		ch := make(chan int, 1)
+		ch <- 4
+		close(ch)
+		v, ok := <-ch
+		w, closed := <-ch
+		if ok && !closed {
+			return v + w
+		}
+		return 0
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Fatal(er)
+	}
+	if r.Int != 4 {
+		t.Errorf("Incorrect value: %d", r.Int)
+	}
+}
+
+type testHostError struct {
+	code int
+}
+
+func (e *testHostError) Error() string {
+	return "host error " + strconv.Itoa(e.code)
+}
+
+func TestCallFuncReturnsHarshErrors(t *testing.T) {
+	errSentinel := errors.New("sentinel")
+	RegisterPackage("example.com/hosterrors", ast.Namespace{
+		"Sentinel": {
+			Type: ast.FunctionType{
+				ReturnType: ast.PrimitiveTypeError,
+				Native: func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+					return ast.MakeVariant(errSentinel)
+				},
+			},
+		},
+		"Coded": {
+			Type: ast.FunctionType{
+				ReturnType: ast.PrimitiveTypeError,
+				Native: func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+					return ast.MakeVariant(&testHostError{code: 7})
+				},
+			},
+		},
+	})
+	defer delete(hostPackages, "example.com/hosterrors")
+
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import (
+		"example.com/hosterrors"
+		"fmt"
+	)
+
+	func Wrapped() (int, error) {
+		return 1, fmt.Errorf("wrapped %w and %w", hosterrors.Sentinel(), hosterrors.Coded())
+	}
+
+	func Success() (int, error) {
+		return 2, nil
+	}
+
+	func Single() error {
+		return hosterrors.Sentinel()
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+
+	r, er := c.CallFunc("Wrapped", map[string]interface{}{})
+	if er == nil || er.Error() != "wrapped sentinel and host error 7" {
+		t.Fatal("Incorrect error: ", er)
+	}
+	if !errors.Is(er, errSentinel) {
+		t.Error("Expected error to wrap the sentinel")
+	}
+	var hostErr *testHostError
+	if !errors.As(er, &hostErr) || hostErr.code != 7 {
+		t.Error("Expected error to wrap a *testHostError")
+	}
+	if r.Type.Kind() != ast.ComplexTypeTuple || r.VectorData[0].Int != 1 {
+		t.Error("Incorrect result: ", r.Type)
+	}
+
+	r, er = c.CallFunc("Success", map[string]interface{}{})
+	if er != nil || r.VectorData[0].Int != 2 {
+		t.Error("Expected success, got ", er)
+	}
+	if _, er = c.CallFunc("Single", map[string]interface{}{}); er != errSentinel {
+		t.Error("Expected the sentinel, got ", er)
+	}
+}
+
+func TestCallErrorMethodOnNilErrorProducesError(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	func Test() string {
+		var err error
+		return err.Error()
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, er := c.CallFunc("Test", map[string]interface{}{})
+	execErr, ok := er.(ExecutionError)
+	if !ok {
+		t.Fatal("Expected ExecutionError, got ", er)
+	}
+	if execErr.Errors[0].Class != ast.NilErr {
+		t.Error("Incorrect error class: ", execErr.Errors[0])
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	c := NewContext()
+	users := map[int]string{1: "alice"}
+	if err := c.RegisterFunc("lookupUser", func(id int) (string, error) {
+		if name, ok := users[id]; ok {
+			return name, nil
+		}
+		return "", errors.New("no user " + strconv.Itoa(id))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterFunc("sum", func(xs ...uint8) (int, bool) {
+		total := 0
+		for _, x := range xs {
+			total += int(x)
+		}
+		return total, total > 10
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterFunc("split", func(s string) []string { return strings.Split(s, ",") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterFunc("explode", func() { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.Parse("test.go", `
+	package test
+
+	func Test() string {
+		n, big := sum(4, 5, 6)
+		parts := split("a,b")
+		name := lookupUser(1)
+		if big {
+			return name + parts[1] + lookupUser(n)
+		}
+		return name
+	}
+
+	func Missing() string {
+		return lookupUser(2)
+	}
+
+	func Overflow() int {
+		n, _ := sum(300)
+		return n
+	}
+
+	func Panics() {
+		explode()
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	tc := &TypecheckContext{}
+	tc.ReturnType = ast.PrimitiveTypeString
+	Typecheck(tc, c.Globals["Test"].Type.(ast.FunctionType).Code)
+	if len(tc.Errors) > 0 {
+		t.Fatal(tc.Errors)
+	}
+
+	users[15] = "bob"
+	r, er := c.CallFunc("Test", map[string]interface{}{})
+	if er != nil {
+		t.Fatal(er)
+	}
+	if r.String != "alicebbob" {
+		t.Error("Incorrect value: " + r.String)
+	}
+	// errors are reported the same way whether or not execution stops at the first error.
+	for _, continueOnError := range []bool{false, true} {
+		c.ContinueOnError = continueOnError
+		for fn, text := range map[string]string{
+			"Missing":  "no user 2",
+			"Overflow": "Invalid argument 0: index 0: 300 overflows uint8",
+			"Panics":   "Host function panicked: boom",
+		} {
+			_, er = c.CallFunc(fn, map[string]interface{}{})
+			execErr, ok := er.(ExecutionError)
+			if !ok {
+				t.Fatal("Expected ExecutionError from "+fn+", got ", er)
+			}
+			if execErr.Errors[0].Class != ast.HostErr || execErr.Errors[0].Text != text {
+				t.Errorf("%s: got error %v, want %q (ContinueOnError=%v)", fn, execErr.Errors[0], text, continueOnError)
+			}
+		}
+	}
+}
+
+func TestRegisterFuncSignatureIsTypechecked(t *testing.T) {
+	c := NewContext()
+	if err := c.RegisterFunc("double", func(i int) int { return i * 2 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterFunc("bad", func(f float64) {}); err == nil {
+		t.Error("Expected error registering a function with a float64 parameter")
+	}
+	if err := c.RegisterFunc("notFunc", 4); err == nil {
+		t.Error("Expected error registering a non-function")
+	}
+
+	err := c.Parse("test.go", `
+	package test
+
+	func Test() string {
+		return double("a")
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &TypecheckContext{}
+	tc.ReturnType = ast.PrimitiveTypeString
+	Typecheck(tc, c.Globals["Test"].Type.(ast.FunctionType).Code)
+	if len(tc.Errors) == 0 {
+		t.Error("Expected type errors")
+	}
+}
+
+type testDB struct {
+	name string
+	data map[string]string
+}
+
+func (db *testDB) Name() string {
+	return db.name
+}
+
+func (db *testDB) Get(key string) (string, error) {
+	if v, ok := db.data[key]; ok {
+		return v, nil
+	}
+	return "", errors.New("missing key " + key)
+}
+
+func (db *testDB) Child(name string) *testDB {
+	return &testDB{name: db.name + "/" + name, data: db.data}
+}
+
+func (db *testDB) secret() string {
+	return "secret"
+}
+
+func TestHandles(t *testing.T) {
+	c := NewContext()
+	if _, err := c.RegisterHandle("DB", &testDB{}, "Name", "Get", "Child"); err != nil {
+		t.Fatal(err)
+	}
+	db := &testDB{name: "main", data: map[string]string{"a": "1"}}
+	if err := c.RegisterFunc("same", func(a, b *testDB) bool { return a == b }); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.Parse("test.go", `
+	package test
+
+	import "fmt"
+
+	func describe(db DB) string {
+		return fmt.Sprint(db) + " " + db.Name()
+	}
+
+	func Test(db DB) string {
+		child := db.Child("c")
+		var none DB
+		if none == nil && db != nil && db == db && db != child && same(db, db) {
+			return describe(child) + " " + child.Get("a")
+		}
+		return "wrong"
+	}
+
+	func Missing(db DB) string {
+		return db.Get("b")
+	}
+
+	func NilHandle() string {
+		var db DB
+		return db.Name()
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	tc := &TypecheckContext{}
+	tc.ReturnType = ast.PrimitiveTypeString
+	Typecheck(tc, c.Globals["Test"].Type.(ast.FunctionType).Code)
+	if len(tc.Errors) > 0 {
+		t.Fatal(tc.Errors)
+	}
+
+	r, er := c.CallFunc("Test", map[string]interface{}{"db": db})
+	if er != nil {
+		t.Fatal(er)
+	}
+	if r.String != "<DB> main/c 1" {
+		t.Error("Incorrect value: " + r.String)
+	}
+	for fn, class := range map[string]interface{}{"Missing": ast.HostErr, "NilHandle": ast.NilErr} {
+		_, er = c.CallFunc(fn, map[string]interface{}{"db": db})
+		execErr, ok := er.(ExecutionError)
+		if !ok {
+			t.Fatal("Expected ExecutionError from "+fn+", got ", er)
+		}
+		if execErr.Errors[0].Class != class {
+			t.Error("Incorrect error class: ", execErr.Errors[0])
+		}
+	}
+}
+
+func TestHandlesCannotBeConstructedOrInspected(t *testing.T) {
+	c := NewContext()
+	if _, err := c.RegisterHandle("DB", &testDB{}, "secret"); err == nil {
+		t.Error("Expected error registering an unexported method")
+	}
+	if _, err := c.RegisterHandle("DB", &testDB{}, "Name"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RegisterHandle("DB", 1); err == nil {
+		t.Error("Expected error registering a duplicate handle name")
+	}
+
+	err := c.Parse("test.go", `
+	package test
+
+	func Construct() {
+		db := DB{}
+		db = db
+	}
+
+	func Inspect(db DB) string {
+		if db + db == db {
+		}
+		return db.name
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) != 1 || c.Errors[0].Class != TypeErrorFound {
+		t.Errorf("Expected a translate error for constructing a handle, got %v", c.Errors)
+	}
+	tc := &TypecheckContext{}
+	tc.ReturnType = ast.PrimitiveTypeString
+	Typecheck(tc, c.Globals["Inspect"].Type.(ast.FunctionType).Code)
+	if len(tc.Errors) < 2 {
+		t.Errorf("Expected type errors for inspecting the handle, got %v", tc.Errors)
+	}
+}
+
+func TestCallFuncMarshalsArguments(t *testing.T) {
+	type address struct {
+		City string `harsh:"city"`
+	}
+	type user struct {
+		Name string `harsh:"name"`
+		Home address
+		Ids  []int
+	}
+
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	type Address struct {
+		city string
+	}
+
+	type User struct {
+		name string
+		Home Address
+		Ids []int
+	}
+
+	func Test(u User) string {
+		if u.Ids[1] != 2 {
+			return ""
+		}
+		return u.name + "@" + u.Home.city
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := c.CallFunc("Test", map[string]interface{}{
+		"u": user{Name: "alice", Home: address{City: "Paris"}, Ids: []int{1, 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String != "alice@Paris" {
+		t.Errorf("Expected \"alice@Paris2\", got %q", v.String)
+	}
+
+	_, err = c.CallFunc("Test", map[string]interface{}{
+		"u": map[string]interface{}{},
+	})
+	if err == nil {
+		t.Error("Expected an error for an unsupported argument")
+	}
+	_, err = c.CallFunc("Test", map[string]interface{}{
+		"u": struct {
+			Name string `harsh:"name"`
+			Home struct{ City int }
+			Ids  []int
+		}{},
+	})
+	if err == nil || err.Error() != "Invalid argument u: field Home: missing field city" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	_, err = c.CallFunc("Test", map[string]interface{}{
+		"u": struct {
+			Name int `harsh:"name"`
+			Home address
+			Ids  []int
+		}{},
+	})
+	if err == nil || err.Error() != "Invalid argument u: field name: expected string, got int" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestRegisterFuncMarshalsStructs(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	c := NewContext()
+	if err := c.RegisterFunc("mid", func(a, b *point) point {
+		return point{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Parse("test.go", `
+	package test
+
+	type Point struct {
+		X int
+		Y int
+	}
+
+	func Test() int {
+		p := mid(Point{X: 2, Y: 4}, Point{X: 4, Y: 8})
+		return p.X * 10 + p.Y
+	}
+	`); err != nil {
+		t.Fatal(err)
+	}
+	v, err := c.CallFunc("Test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Int != 36 {
+		t.Errorf("Expected 36, got %d", v.Int)
+	}
+
+	var p point
+	if err := ast.FromVariant(v, &p); err == nil {
+		t.Error("Expected an error converting an int to a struct")
+	}
+}
+
+func TestStepBudget(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	func spin() {
+		for true {}
+	}
+
+	func Test() int {
+		x := 0
+		for i := 0; i != 10; i = i + 1 {
+			x = x + i
+		}
+		return x
+	}
+
+	func Forever() {
+		spin()
+	}
+
+	func ForeverInGoroutine() {
+		ch := make(chan int)
+		go spin()
+		<-ch
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MaxSteps = 1000
+
+	v, err := c.CallFunc("Test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Int != 45 {
+		t.Errorf("Expected 45, got %d", v.Int)
+	}
+
+	for _, fn := range []string{"Forever", "ForeverInGoroutine"} {
+		_, err = c.CallFunc(fn, nil)
+		errs, ok := err.(ExecutionError)
+		if !ok || len(errs.Errors) != 1 || errs.Errors[0].Class != ast.BudgetExceededErr {
+			t.Errorf("%s: expected a BudgetExceededErr, got %v", fn, err)
+		}
+	}
+}
+
+func TestCallFuncContextCancellation(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	func Forever() {
+		for true {}
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.CallFuncContext(ctx, "Forever", nil)
+	errs, ok := err.(ExecutionError)
+	if !ok || len(errs.Errors) != 1 || errs.Errors[0].Class != ast.CancelledErr {
+		t.Fatalf("Expected a CancelledErr, got %v", err)
+	}
+	if errs.Errors[0].Text != "Execution cancelled: context deadline exceeded" {
+		t.Errorf("Unexpected error text: %q", errs.Errors[0].Text)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	func Concat(n int) string {
+		s := ""
+		for i := 0; i != n; i = i + 1 {
+			s = s + "abcdefghij"
+		}
+		return s
+	}
+
+	func BigArray(n int) int {
+		var a [n]int
+		return 1
+	}
+
+	type big struct {
+		a [100000]int
+	}
+
+	func BigStruct(n int) int {
+		var b big
+		return n
+	}
+
+	func InGoroutine(n int) {
+		ch := make(chan int)
+		go Concat(n)
+		<-ch
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MaxMemory = 100000
+
+	v, err := c.CallFunc("Concat", map[string]interface{}{"n": 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.String) != 10000 {
+		t.Errorf("Expected a string of length 10000, got %d", len(v.String))
+	}
+	if c.PeakMemory < 20000 || c.PeakMemory > 100000 {
+		t.Errorf("Expected peak memory between 20000 and 100000 bytes, got %d", c.PeakMemory)
+	}
+
+	for _, tc := range []struct {
+		fn  string
+		n   int
+		pos string
+	}{
+		{"Concat", 1000000, "test.go:7:4"},
+		{"BigArray", 1000000, "test.go:13:7"},
+		{"BigArray", 100000000, "test.go:13:7"},
+		{"BigStruct", 0, "test.go:22:7"},
+		{"InGoroutine", 1000000, "test.go:7:4"},
+	} {
+		_, err = c.CallFunc(tc.fn, map[string]interface{}{"n": tc.n})
+		errs, ok := err.(ExecutionError)
+		if !ok || len(errs.Errors) != 1 || errs.Errors[0].Class != ast.MemoryLimitErr {
+			t.Errorf("%s(%d): expected a MemoryLimitErr, got %v", tc.fn, tc.n, err)
+		} else if want := tc.pos + ": Execution exceeded the memory limit of 100000 bytes"; errs.Errors[0].Error() != want {
+			t.Errorf("%s(%d): got error %q, want %q", tc.fn, tc.n, errs.Errors[0].Error(), want)
+		}
+		// the allocation which exceeded the limit is not counted.
+		if c.PeakMemory > c.MaxMemory {
+			t.Errorf("%s(%d): expected peak memory within the limit, got %d", tc.fn, tc.n, c.PeakMemory)
+		}
+	}
+}
+
+func TestRecursionAndStackTraces(t *testing.T) {
+	c, err := ParseLiteral("test.go", `package test
+
+func fact(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return n * fact(n - 1)
+}
+
+func Fact() int {
+	return fact(5)
+}
+
+func fail(n int) int {
+	if n == 0 {
+		return [1]int{1}[n + 1]
+	}
+	return fail(n - 1)
+}
+
+func Fail() int {
+	return fail(1)
+}
+
+func forever(n int) int {
+	return forever(n + 1)
+}
+
+func Forever() int {
+	return forever(0)
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := c.CallFunc("Fact", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Int != 120 {
+		t.Errorf("Expected 120, got %d", v.Int)
+	}
+
+	_, err = c.CallFunc("Fail", nil)
+	errs, ok := err.(ExecutionError)
+	if !ok || len(errs.Errors) != 1 {
+		t.Fatalf("Expected one execution error, got %v", err)
+	}
+	var names []string
+	for _, frame := range errs.Errors[0].Stack {
+		names = append(names, frame.Function)
+	}
+	if strings.Join(names, " ") != "fail fail Fail" {
+		t.Errorf("Expected stack \"fail fail Fail\", got %q", names)
+	}
+	want := "fail()\n\ttest.go:16:10\nfail()\n\ttest.go:18:9\nFail()\n\ttest.go:22:9\n"
+	if trace := errs.Errors[0].StackTrace(); trace != want {
+		t.Errorf("Expected stack trace %q, got %q", want, trace)
+	}
+
+	c.MaxDepth = 100
+	_, err = c.CallFunc("Forever", nil)
+	errs, ok = err.(ExecutionError)
+	if !ok || len(errs.Errors) != 1 || errs.Errors[0].Class != ast.StackOverflowErr {
+		t.Fatalf("Expected a StackOverflowErr, got %v", err)
+	}
+	if len(errs.Errors[0].Stack) != 100 {
+		t.Errorf("Expected a stack of 100 frames, got %d", len(errs.Errors[0].Stack))
+	}
+}
+
+func TestExecutionErrorsHavePositions(t *testing.T) {
+	c, err := ParseLiteral("test.go", `package test
+
+func Test() int {
+	return [1]int{1}[1]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CallFunc("Test", nil)
+	errs, ok := err.(ExecutionError)
+	if !ok || len(errs.Errors) != 1 {
+		t.Fatalf("Expected one execution error, got %v", err)
+	}
+	if got := errs.Errors[0].Error(); got != "test.go:4:9: Subscript out of bounds" {
+		t.Errorf("Unexpected error: %q", got)
+	}
+}
+
+func TestRuntimePanicsBecomeErrors(t *testing.T) {
+	c := NewContext()
+	c.Globals["boom"] = &ast.Variant{Type: ast.FunctionType{
+		ReturnType: ast.PrimitiveTypeUndefined,
+		Native: func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+			panic("boom")
+		},
+	}}
+	c.Globals["nilFunc"] = &ast.Variant{Type: ast.FunctionType{ReturnType: ast.PrimitiveTypeInt}}
+	err := c.Parse("test.go", `package test
+
+func Div(d int) int {
+	return 1 / d
+}
+
+func Mod(d int) int {
+	return 1 % d
+}
+
+func Index(i int) int {
+	return [2]int{1, 2}[i]
+}
+
+func Nil() int {
+	return nilFunc()
+}
+
+func Panics() {
+	boom()
+}
+
+func PanicsInGoroutine() int {
+	ch := make(chan int)
+	go boom()
+	return <-ch
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+
+	for _, tc := range []struct {
+		fn    string
+		args  map[string]interface{}
+		class interface{}
+		text  string
+	}{
+		{"Div", map[string]interface{}{"d": 0}, ast.DivideByZeroErr, "test.go:4:9: Integer divide by zero"},
+		{"Mod", map[string]interface{}{"d": 0}, ast.DivideByZeroErr, "test.go:8:9: Integer divide by zero"},
+		{"Index", map[string]interface{}{"i": -1}, ast.BoundsErr, "test.go:12:9: Subscript out of bounds"},
+		{"Nil", nil, ast.NilErr, "test.go:16:9: Call of nil function nilFunc"},
+		{"Panics", nil, ast.InternalErr, "test.go:19:15: Internal error: boom"},
+		{"PanicsInGoroutine", nil, ast.InternalErr, "Internal error: boom"},
+	} {
+		_, err := c.CallFunc(tc.fn, tc.args)
+		errs, ok := err.(ExecutionError)
+		if !ok || len(errs.Errors) != 1 {
+			t.Errorf("%s: expected one execution error, got %v", tc.fn, err)
+			continue
+		}
+		if errs.Errors[0].Class != tc.class {
+			t.Errorf("%s: expected class %v, got %v", tc.fn, tc.class, errs.Errors[0].Class)
+		}
+		if got := errs.Errors[0].Error(); got != tc.text {
+			t.Errorf("%s: unexpected error %q", tc.fn, got)
+		}
+	}
+
+	if v, err := c.CallFunc("Div", map[string]interface{}{"d": 2}); err != nil || v.Int != 0 {
+		t.Errorf("Div(2) = %v, %v", v, err)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	c, err := ParseLiteral("test.go", `package test
+
+var after int
+
+func Test() int {
+	x := 0
+	y := [1]int{1}[x + 1]
+	after = after + 1
+	return x + y
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.CallFunc("Test", nil)
+	errs, ok := err.(ExecutionError)
+	if !ok || len(errs.Errors) != 1 || errs.Errors[0].Class != ast.BoundsErr {
+		t.Fatalf("Expected a single BoundsErr, got %v", err)
+	}
+	if c.Globals["after"].Int != 0 {
+		t.Error("Expected execution to stop at the first error")
+	}
+	if len(errs.Errors[0].Stack) != 1 || errs.Errors[0].Stack[0].Function != "Test" {
+		t.Errorf("Unexpected stack: %v", errs.Errors[0].Stack)
+	}
+
+	c.ContinueOnError = true
+	_, err = c.CallFunc("Test", nil)
+	errs, ok = err.(ExecutionError)
+	if !ok || len(errs.Errors) != 2 || errs.Errors[0].Class != ast.BoundsErr || errs.Errors[1].Class != ast.TypeErr {
+		t.Fatalf("Expected every error to be collected, got %v", err)
+	}
+	if c.Globals["after"].Int != 1 {
+		t.Error("Expected execution to continue after the error")
+	}
+}
+
+func TestResolvedVariables(t *testing.T) {
+	c, err := ParseLiteral("test.go", `package test
+
+var x int
+var calls int
+
+func set(x int) {
+	x = x + 1
+	calls = calls + x
+}
+
+func Test() int {
+	set(5)
+	if true {
+		x := 3
+		x = x + 1
+	}
+	for i := 0; i != 2; i = i + 1 {
+		x = x + i
+	}
+	x = x + 10
+	return x
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	for _, decl := range c.Declarations {
+		if fn, ok := decl.Type.(ast.FunctionType); ok && fn.Code.(*ast.StatementList).Layout == nil {
+			t.Errorf("Expected %s to be resolved", decl.Ident)
+		}
+	}
+
+	v, err := c.CallFunc("Test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Int != 11 {
+		t.Errorf("Expected 11, got %d", v.Int)
+	}
+	if c.Globals["x"].Int != 11 || c.Globals["calls"].Int != 6 {
+		t.Errorf("Expected globals x = 11 and calls = 6, got %d and %d", c.Globals["x"].Int, c.Globals["calls"].Int)
+	}
+}
@@ -0,0 +1,407 @@
+package compiler
+
+import (
+	goast "go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+// Generic functions and types are instantiated during translation. Each distinct set of type arguments produces an
+// ordinary function or struct type, which is named after the generic declaration and its type arguments - IE:
+// Max[int]. Within the declaration, references to type parameters are resolved through Context.typeArgs.
+
+// genericFunc returns the generic function declaration referenced by expr, along with any explicit type arguments and
+// the package which declares it. Nil is returned if expr does not reference a generic function.
+func genericFunc(context *Context, expr goast.Expr) (*goast.FuncDecl, []goast.Expr, *Context) {
+	var explicit []goast.Expr
+	switch e := expr.(type) {
+	case *goast.IndexExpr:
+		explicit = []goast.Expr{e.Index}
+		expr = e.X
+	case *goast.IndexListExpr:
+		explicit = e.Indices
+		expr = e.X
+	}
+
+	obj, owner := genericObject(context, expr)
+	if obj == nil {
+		return nil, nil, nil
+	}
+	decl, ok := obj.Decl.(*goast.FuncDecl)
+	if !ok || decl.Type.TypeParams == nil {
+		return nil, nil, nil
+	}
+	return decl, explicit, owner
+}
+
+// genericObject returns the declaration referenced by an identifier, or an exported qualified identifier, along with
+// the package which declares it. Unexported qualified identifiers are reported when they are translated.
+func genericObject(context *Context, expr goast.Expr) (*goast.Object, *Context) {
+	switch e := expr.(type) {
+	case *goast.Ident:
+		return e.Obj, context
+	case *goast.SelectorExpr:
+		if pkg := context.importedPackage(e); pkg != nil && goast.IsExported(e.Sel.Name) {
+			return pkg.scope[e.Sel.Name], pkg
+		}
+	}
+	return nil, nil
+}
+
+// typeParams returns the objects declared by a type parameter list, in order, with the constraint of each.
+func typeParams(list *goast.FieldList) ([]*goast.Object, []goast.Expr) {
+	var params []*goast.Object
+	var constraints []goast.Expr
+	for _, field := range list.List {
+		for _, name := range field.Names {
+			params = append(params, name.Obj)
+			constraints = append(constraints, field.Type)
+		}
+	}
+	return params, constraints
+}
+
+// translateGenericCall instantiates the generic function decl, declared by the package owner, for the call. Any type
+// arguments which are not given explicitly are inferred from the types of the arguments.
+func translateGenericCall(fset *token.FileSet, context *Context, owner *Context, call goast.CallExpr, decl *goast.FuncDecl, explicit []goast.Expr) ast.Node {
+	params, _ := typeParams(decl.Type.TypeParams)
+	bindings := map[*goast.Object]ast.TypeKind{}
+	if len(explicit) > len(params) {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(call.Pos()),
+			Text:  "Too many type arguments for " + decl.Name.Name,
+		})
+		return &ast.NilLiteral{}
+	}
+	for i, typeArg := range explicit {
+		bindings[params[i]] = convertTypeToTypeKind(fset, typeArg, context)
+	}
+
+	var args []ast.Node
+	for _, astArg := range call.Args {
+		args = append(args, translateGoNode(fset, context, reflect.ValueOf(astArg)))
+	}
+	if len(explicit) < len(params) {
+		inferTypeArgs(fset, context, call, decl, args, bindings)
+	}
+
+	name, ok := instantiateFunc(fset, context, owner, call.Pos(), decl, bindings)
+	if !ok {
+		return &ast.NilLiteral{}
+	}
+	return &ast.FunctionCall{
+		Function: funcReference(context, owner, name),
+		Args:     args,
+		Spread:   call.Ellipsis.IsValid(),
+	}
+}
+
+// inferTypeArgs binds the type parameters of decl by unifying the declared type of each parameter with the type of
+// the argument passed to it.
+func inferTypeArgs(fset *token.FileSet, context *Context, call goast.CallExpr, decl *goast.FuncDecl, args []ast.Node, bindings map[*goast.Object]ast.TypeKind) {
+	var paramTypes []goast.Expr
+	for _, field := range decl.Type.Params.List {
+		for range field.Names {
+			paramTypes = append(paramTypes, field.Type)
+		}
+		if len(field.Names) == 0 {
+			paramTypes = append(paramTypes, field.Type)
+		}
+	}
+
+	for i, arg := range args {
+		var paramType goast.Expr
+		if i < len(paramTypes) {
+			paramType = paramTypes[i]
+		} else if len(paramTypes) > 0 {
+			paramType = paramTypes[len(paramTypes)-1] //trailing arguments to a variadic parameter
+		}
+		argType := Typecheck(&TypecheckContext{}, arg)
+		if paramType == nil || argType == ast.UnknownType {
+			continue
+		}
+
+		if ellipsis, isVariadic := paramType.(*goast.Ellipsis); isVariadic && !call.Ellipsis.IsValid() {
+			paramType = ellipsis.Elt
+		}
+		if !unifyType(paramType, argType, bindings) {
+			context.Errors = append(context.Errors, TranslateError{
+				Class: TypeErrorFound,
+				Pos:   fset.Position(call.Args[i].Pos()),
+				Text:  "Type " + argType.String() + " of argument does not match inferred type parameters of " + decl.Name.Name,
+			})
+		}
+	}
+}
+
+// unifyType binds any type parameters referenced by expr, by matching expr against the type t. False is returned if
+// a type parameter was already bound to a different type.
+func unifyType(expr goast.Expr, t ast.TypeKind, bindings map[*goast.Object]ast.TypeKind) bool {
+	if named, isNamed := t.(ast.NamedType); isNamed {
+		t = named.Type
+	}
+
+	switch e := expr.(type) {
+	case *goast.Ident:
+		if e.Obj == nil {
+			return true
+		}
+		if _, isTypeParam := e.Obj.Decl.(*goast.Field); !isTypeParam || e.Obj.Kind != goast.Typ {
+			return true
+		}
+		if bound, ok := bindings[e.Obj]; ok {
+			return TypeEqual(bound, t)
+		}
+		bindings[e.Obj] = t
+	case *goast.ArrayType:
+		if t.Kind() == ast.ComplexTypeArray || t.Kind() == ast.ComplexTypeSlice {
+			return unifyType(e.Elt, t.BaseType(), bindings)
+		}
+	case *goast.Ellipsis:
+		if t.Kind() == ast.ComplexTypeSlice {
+			return unifyType(e.Elt, t.BaseType(), bindings)
+		}
+	case *goast.ChanType:
+		if t.Kind() == ast.ComplexTypeChannel {
+			return unifyType(e.Value, t.BaseType(), bindings)
+		}
+	case *goast.FuncType:
+		if fnType, ok := ast.FunctionTypeOf(t); ok {
+			return unifyFields(e.Params, fnType.Parameters, bindings) && unifyFields(e.Results, results(fnType), bindings)
+		}
+	}
+	return true
+}
+
+// unifyFields unifies the types of a parameter or result list with the types of a function signature. False is
+// returned if the number of types differs.
+func unifyFields(list *goast.FieldList, types []ast.TypeKind, bindings map[*goast.Object]ast.TypeKind) bool {
+	var exprs []goast.Expr
+	if list != nil {
+		for _, field := range list.List {
+			for range field.Names {
+				exprs = append(exprs, field.Type)
+			}
+			if len(field.Names) == 0 {
+				exprs = append(exprs, field.Type)
+			}
+		}
+	}
+	if len(exprs) != len(types) {
+		return false
+	}
+	for i, expr := range exprs {
+		if !unifyType(expr, types[i], bindings) {
+			return false
+		}
+	}
+	return true
+}
+
+// results returns the types of the results of a function.
+func results(fnType ast.FunctionType) []ast.TypeKind {
+	switch r := fnType.ReturnType.(type) {
+	case ast.TupleType:
+		return r.Types
+	case nil:
+		return nil
+	}
+	if fnType.ReturnType == ast.PrimitiveTypeUndefined {
+		return nil
+	}
+	return []ast.TypeKind{fnType.ReturnType}
+}
+
+// instantiateFunc translates decl with the given type arguments, if it has not already been instantiated with them,
+// saving it as a global of the package owner which declares it. The name of the instance is returned. Errors are
+// reported in context.
+func instantiateFunc(fset *token.FileSet, context *Context, owner *Context, pos token.Pos, decl *goast.FuncDecl, bindings map[*goast.Object]ast.TypeKind) (name string, ok bool) {
+	context.inPackage(owner, func() { name, ok = instantiate(fset, owner, pos, decl, bindings) })
+	return name, ok
+}
+
+func instantiate(fset *token.FileSet, context *Context, pos token.Pos, decl *goast.FuncDecl, bindings map[*goast.Object]ast.TypeKind) (string, bool) {
+	params, constraints := typeParams(decl.Type.TypeParams)
+	typeArgs, ok := checkTypeArgs(fset, context, pos, decl.Name.Name, params, constraints, bindings)
+	if !ok {
+		return "", false
+	}
+	name := instanceName(decl.Name.Name, typeArgs)
+	if context.instances[name] {
+		return name, true
+	}
+	if context.instances == nil {
+		context.instances = map[string]bool{}
+	}
+	context.instances[name] = true
+
+	outer := context.withTypeArgs(params, typeArgs)
+	defer func() { context.typeArgs = outer }()
+
+	// the signature is saved first, so recursive calls within the body can resolve the instance.
+	saveFunc(context, name, translateGoFuncType(fset, context, decl))
+	instance := translateGoFuncDecl(fset, context, decl)
+	instance.Ident = name
+	context.Declarations = append(context.Declarations, instance)
+	saveFunc(context, name, instance.Type)
+	return name, true
+}
+
+// instantiateType returns the type declared by the generic type declaration spec of the package owner, with the given
+// type arguments.
+func instantiateType(fset *token.FileSet, context *Context, owner *Context, pos token.Pos, spec *goast.TypeSpec, args []goast.Expr) (t ast.TypeKind) {
+	params, constraints := typeParams(spec.TypeParams)
+	if len(args) != len(params) {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(pos),
+			Text:  "Incorrect number of type arguments for " + spec.Name.Name,
+		})
+		return ast.PrimitiveTypeUndefined
+	}
+	bindings := map[*goast.Object]ast.TypeKind{}
+	for i, typeArg := range args {
+		bindings[params[i]] = convertTypeToTypeKind(fset, typeArg, context)
+	}
+
+	context.inPackage(owner, func() {
+		typeArgs, ok := checkTypeArgs(fset, owner, pos, spec.Name.Name, params, constraints, bindings)
+		if !ok {
+			t = ast.PrimitiveTypeUndefined
+			return
+		}
+		outer := owner.withTypeArgs(params, typeArgs)
+		defer func() { owner.typeArgs = outer }()
+
+		t = convertNamedType(fset, spec, owner)
+		if st, isStruct := t.(ast.StructType); isStruct {
+			st.Name = instanceName(spec.Name.Name, typeArgs)
+			t = st
+		}
+	})
+	return t
+}
+
+// withTypeArgs binds the given type parameters for the translation of a generic declaration, returning the previous
+// bindings so they can be restored.
+func (c *Context) withTypeArgs(params []*goast.Object, typeArgs []ast.TypeKind) map[*goast.Object]ast.TypeKind {
+	outer := c.typeArgs
+	c.typeArgs = map[*goast.Object]ast.TypeKind{}
+	for obj, t := range outer {
+		c.typeArgs[obj] = t
+	}
+	for i, obj := range params {
+		c.typeArgs[obj] = typeArgs[i]
+	}
+	return outer
+}
+
+// checkTypeArgs returns the bound type arguments in order, checking every type parameter is bound and satisfies its
+// constraint.
+func checkTypeArgs(fset *token.FileSet, context *Context, pos token.Pos, name string, params []*goast.Object, constraints []goast.Expr, bindings map[*goast.Object]ast.TypeKind) ([]ast.TypeKind, bool) {
+	typeArgs := make([]ast.TypeKind, len(params))
+	for i, obj := range params {
+		t, ok := bindings[obj]
+		if !ok {
+			context.Errors = append(context.Errors, TranslateError{
+				Class: TypeErrorFound,
+				Pos:   fset.Position(pos),
+				Text:  "Cannot infer type parameter " + obj.Name + " of " + name,
+			})
+			return nil, false
+		}
+		if !satisfiesConstraint(fset, context, constraints[i], t) {
+			context.Errors = append(context.Errors, TranslateError{
+				Class: TypeErrorFound,
+				Pos:   fset.Position(pos),
+				Text:  "Type " + t.String() + " does not satisfy the constraint of type parameter " + obj.Name + " of " + name,
+			})
+			return nil, false
+		}
+		typeArgs[i] = t
+	}
+	return typeArgs, true
+}
+
+// satisfiesConstraint returns true if t satisfies the constraint expression. any, comparable and unions of types are
+// supported, either directly or as the elements of an interface.
+func satisfiesConstraint(fset *token.FileSet, context *Context, constraint goast.Expr, t ast.TypeKind) bool {
+	switch c := constraint.(type) {
+	case *goast.Ident:
+		if c.Obj == nil && c.Name == "any" {
+			return true
+		}
+		if c.Obj == nil && c.Name == "comparable" {
+			return IsComparable(t)
+		}
+		if c.Obj != nil {
+			if spec, ok := c.Obj.Decl.(*goast.TypeSpec); ok {
+				if iface, isInterface := spec.Type.(*goast.InterfaceType); isInterface {
+					return satisfiesConstraint(fset, context, iface, t)
+				}
+			}
+		}
+	case *goast.InterfaceType:
+		for _, elem := range c.Methods.List {
+			if len(elem.Names) > 0 {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: NotSupported,
+					Pos:   fset.Position(elem.Pos()),
+					Text:  "Constraints with methods are not supported",
+				})
+				return false
+			}
+			if !satisfiesConstraint(fset, context, elem.Type, t) {
+				return false
+			}
+		}
+		return true
+	case *goast.BinaryExpr:
+		if c.Op == token.OR {
+			return satisfiesConstraint(fset, context, c.X, t) || satisfiesConstraint(fset, context, c.Y, t)
+		}
+	case *goast.UnaryExpr:
+		if c.Op == token.TILDE { //all types have their own underlying type, as there are no named non-struct types.
+			return satisfiesConstraint(fset, context, c.X, t)
+		}
+	}
+	return TypeEqual(convertTypeToTypeKind(fset, constraint, context), t)
+}
+
+func instanceName(name string, typeArgs []ast.TypeKind) string {
+	args := make([]string, len(typeArgs))
+	for i, t := range typeArgs {
+		args[i] = t.String()
+	}
+	return name + "[" + strings.Join(args, ",") + "]"
+}
+
+// genericType returns the generic type declaration and type arguments of an instantiated type expression, along with
+// the package which declares it. Nil is returned if expr does not instantiate a generic type.
+func genericType(context *Context, expr goast.Expr) (*goast.TypeSpec, []goast.Expr, *Context) {
+	var args []goast.Expr
+	switch e := expr.(type) {
+	case *goast.IndexExpr:
+		args = []goast.Expr{e.Index}
+		expr = e.X
+	case *goast.IndexListExpr:
+		args = e.Indices
+		expr = e.X
+	default:
+		return nil, nil, nil
+	}
+
+	obj, owner := genericObject(context, expr)
+	if obj == nil {
+		return nil, nil, nil
+	}
+	spec, ok := obj.Decl.(*goast.TypeSpec)
+	if !ok || spec.TypeParams == nil {
+		return nil, nil, nil
+	}
+	return spec, args, owner
+}
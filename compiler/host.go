@@ -0,0 +1,51 @@
+package compiler
+
+import (
+	goast "go/ast"
+	"strings"
+
+	"github.com/twitchyliquid64/harsh/ast"
+	"github.com/twitchyliquid64/harsh/stdlib"
+)
+
+// hostPackages contains the packages implemented in Go, keyed by import path.
+var hostPackages = map[string]ast.Namespace{}
+
+func init() {
+	for path, members := range stdlib.Packages {
+		RegisterPackage(path, members)
+	}
+}
+
+// RegisterPackage makes a package implemented in Go available to be imported by harsh code, replacing any package
+// with the same import path. Members are typically functions with a native implementation, whose FunctionType
+// declares the signature which calls are typechecked against. The packages of the standard library are registered
+// by default - see the stdlib package.
+func RegisterPackage(path string, members ast.Namespace) {
+	hostPackages[path] = members
+}
+
+// hostPackage returns a package implemented in Go, or nil if no package is registered with the import path. Each
+// call returns a new instance of the package, so variables are not shared between programs.
+func hostPackage(path string) *Context {
+	members, ok := hostPackages[path]
+	if !ok {
+		return nil
+	}
+	c := &Context{
+		ConType: ContextFile,
+		Name:    path[strings.LastIndex(path, "/")+1:],
+		Path:    path,
+		Globals: ast.Namespace{},
+		scope:   map[string]*goast.Object{},
+	}
+	for name, member := range members {
+		c.Globals[name] = member.Copy()
+		if member.Type.Kind() == ast.ComplexTypeFunction {
+			c.scope[name] = goast.NewObj(goast.Fun, name)
+		} else {
+			c.scope[name] = goast.NewObj(goast.Var, name)
+		}
+	}
+	return c
+}
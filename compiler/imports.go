@@ -0,0 +1,295 @@
+package compiler
+
+import (
+	"errors"
+	goast "go/ast"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+// Importer loads the packages of a module, which are stored in directories below Root. The import path of a package
+// is ModulePath, followed by the path of its directory relative to Root. Each package is loaded once, and shared by
+// every package which imports it. Packages registered with RegisterPackage() take precedence over the module.
+type Importer struct {
+	Root       string
+	ModulePath string
+	Tags       []string // additional build tags, see ParsePackage()
+
+	fset     *token.FileSet
+	packages map[string]*Context
+	loading  []string // import paths of the packages currently being loaded, in the order they were imported
+}
+
+// NewImporter returns an Importer for the module with the given import path, stored in the directory root.
+func NewImporter(root, modulePath string, tags ...string) *Importer {
+	return &Importer{
+		Root:       root,
+		ModulePath: modulePath,
+		Tags:       tags,
+		fset:       token.NewFileSet(),
+		packages:   map[string]*Context{},
+	}
+}
+
+// Import loads the package with the given import path, along with any packages it imports. An error is returned if
+// the package cannot be found or parsed, or if it imports itself through a chain of imports.
+func (imp *Importer) Import(path string) (*Context, error) {
+	if c, ok := imp.packages[path]; ok {
+		return c, nil
+	}
+	if c := hostPackage(path); c != nil {
+		imp.packages[path] = c
+		return c, nil
+	}
+	for i, loading := range imp.loading {
+		if loading == path {
+			cycle := append(append([]string{}, imp.loading[i:]...), path)
+			return nil, errors.New("Import cycle not allowed: " + strings.Join(cycle, " imports "))
+		}
+	}
+	dir, err := imp.dir(path)
+	if err != nil {
+		return nil, err
+	}
+	files, err := readGoFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	imp.loading = append(imp.loading, path)
+	defer func() { imp.loading = imp.loading[:len(imp.loading)-1] }()
+	c, err := parsePackage(imp.fset, files, imp.Tags, imp, path)
+	if err != nil {
+		return nil, err
+	}
+	imp.packages[path] = c
+	return c, nil
+}
+
+// ImportDir loads the package in the directory dir, which must be within the module. See Import().
+func (imp *Importer) ImportDir(dir string) (*Context, error) {
+	rel, err := filepath.Rel(imp.Root, dir)
+	if err != nil {
+		return nil, err
+	}
+	if rel == "." {
+		return imp.Import(imp.ModulePath)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, errors.New("Directory " + dir + " is not within the module root " + imp.Root)
+	}
+	return imp.Import(imp.ModulePath + "/" + filepath.ToSlash(rel))
+}
+
+// dir returns the directory containing the package with the given import path.
+func (imp *Importer) dir(path string) (string, error) {
+	if imp.ModulePath != "" && path == imp.ModulePath {
+		return imp.Root, nil
+	}
+	if imp.ModulePath == "" || !strings.HasPrefix(path, imp.ModulePath+"/") {
+		return "", errors.New("Cannot find package " + path)
+	}
+	return filepath.Join(imp.Root, filepath.FromSlash(strings.TrimPrefix(path, imp.ModulePath+"/"))), nil
+}
+
+// resolveImports loads the packages imported by the files of the package represented by context. Imports are shared
+// by every file of the package, so the same name cannot refer to different packages in different files.
+func resolveImports(fset *token.FileSet, context *Context, files []*goast.File) {
+	for _, f := range files {
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: InternalErr,
+					Pos:   fset.Position(spec.Pos()),
+					Text:  "Could not parse import path: " + spec.Path.Value,
+				})
+				continue
+			}
+			if spec.Name != nil && spec.Name.Name == "." {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: NotSupported,
+					Pos:   fset.Position(spec.Pos()),
+					Text:  "Dot imports are not supported: " + path,
+				})
+				continue
+			}
+
+			pkg, err := context.importer.Import(path)
+			if err != nil {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: ImportErr,
+					Pos:   fset.Position(spec.Pos()),
+					Text:  "Could not import " + path + ": " + err.Error(),
+				})
+				continue
+			}
+			if len(pkg.Errors) > 0 {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: ImportErr,
+					Pos:   fset.Position(spec.Pos()),
+					Text:  "Imported package " + path + " has errors: " + pkg.Errors[0].Text,
+				})
+				continue
+			}
+
+			name := pkg.Name
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			if name == "_" {
+				continue
+			}
+			if existing, ok := context.imports[name]; ok && existing != pkg {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: NotSupported,
+					Pos:   fset.Position(spec.Pos()),
+					Text:  name + " refers to both " + existing.Path + " and " + path + " in different files of the package",
+				})
+				continue
+			}
+			context.imports[name] = pkg
+		}
+	}
+}
+
+// importedPackage returns the package which qualifies the identifier sel, or nil if sel is not a qualified identifier.
+func (c *Context) importedPackage(sel *goast.SelectorExpr) *Context {
+	ident, ok := sel.X.(*goast.Ident)
+	if !ok || ident.Obj != nil { //local declarations shadow imports
+		return nil
+	}
+	return c.imports[ident.Name]
+}
+
+// packageOf returns the package with the given import path, which is either the package being translated or a package
+// it has loaded.
+func (c *Context) packageOf(path string) *Context {
+	if path == c.Path {
+		return c
+	}
+	if c.importer == nil {
+		return nil
+	}
+	return c.importer.packages[path]
+}
+
+// referencePackage returns a reference to the package pkg, which is saved in the globals of c under its quoted import
+// path. Members of the package are selected from the reference.
+func (c *Context) referencePackage(pkg *Context) ast.Node {
+	name := strconv.Quote(pkg.Path)
+	t := ast.PackageType{Path: pkg.Path, Members: pkg.Globals}
+	if _, ok := c.Globals[name]; !ok {
+		c.Globals[name] = &ast.Variant{Type: t, NamedData: pkg.Globals}
+	}
+	return &ast.VariableReference{Name: name, Type: t}
+}
+
+// inPackage calls fn, which translates a declaration of the imported package pkg. Any errors encountered are reported
+// in c rather than pkg, which has already been translated.
+func (c *Context) inPackage(pkg *Context, fn func()) {
+	n := len(pkg.Errors)
+	fn()
+	if c != pkg {
+		c.Errors = append(c.Errors, pkg.Errors[n:]...)
+		pkg.Errors = pkg.Errors[:n]
+	}
+}
+
+// lookupQualified returns the declaration named by the qualified identifier sel, which must be exported by pkg. Nil is
+// returned if the declaration cannot be referenced.
+func lookupQualified(fset *token.FileSet, context *Context, pkg *Context, sel *goast.SelectorExpr) *goast.Object {
+	qualified := pkg.Name + "." + sel.Sel.Name
+	if !goast.IsExported(sel.Sel.Name) {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: NotDeclaredErr,
+			Pos:   fset.Position(sel.Pos()),
+			Text:  "Cannot refer to unexported name " + qualified,
+		})
+		return nil
+	}
+	obj, ok := pkg.scope[sel.Sel.Name]
+	if !ok {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: NotDeclaredErr,
+			Pos:   fset.Position(sel.Pos()),
+			Text:  "Undefined: " + qualified,
+		})
+		return nil
+	}
+	return obj
+}
+
+// translateQualified returns a node selecting the function or global named by the qualified identifier sel from pkg.
+func translateQualified(fset *token.FileSet, context *Context, pkg *Context, sel *goast.SelectorExpr) ast.Node {
+	obj := lookupQualified(fset, context, pkg, sel)
+	if obj == nil {
+		return &ast.NilLiteral{}
+	}
+	if decl, ok := obj.Decl.(*goast.FuncDecl); ok && decl.Type.TypeParams != nil {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(sel.Pos()),
+			Text:  "Cannot use generic function " + pkg.Name + "." + sel.Sel.Name + " without instantiation",
+		})
+		return &ast.NilLiteral{}
+	}
+	if obj.Kind != goast.Fun && obj.Kind != goast.Var {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: NotSupported,
+			Pos:   fset.Position(sel.Pos()),
+			Text:  pkg.Name + "." + sel.Sel.Name + " is not a function or variable",
+		})
+		return &ast.NilLiteral{}
+	}
+	return &ast.NamedSelector{
+		Name: sel.Sel.Name,
+		Expr: context.referencePackage(pkg),
+	}
+}
+
+// translateQualifiedType returns the type named by the qualified identifier sel, which is declared by pkg.
+func translateQualifiedType(fset *token.FileSet, context *Context, pkg *Context, sel *goast.SelectorExpr) ast.TypeKind {
+	obj := lookupQualified(fset, context, pkg, sel)
+	if obj == nil {
+		return ast.PrimitiveTypeUndefined
+	}
+	spec, ok := obj.Decl.(*goast.TypeSpec)
+	if !ok || obj.Kind != goast.Typ {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(sel.Pos()),
+			Text:  pkg.Name + "." + sel.Sel.Name + " is not a type",
+		})
+		return ast.PrimitiveTypeUndefined
+	}
+	if spec.TypeParams != nil {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(sel.Pos()),
+			Text:  "Cannot use generic type " + pkg.Name + "." + sel.Sel.Name + " without instantiation",
+		})
+		return ast.PrimitiveTypeUndefined
+	}
+	var t ast.TypeKind
+	context.inPackage(pkg, func() { t = convertNamedType(fset, spec, pkg) })
+	return t
+}
+
+// checkExported adds an error if the field or method name is selected from the struct st outside the package which
+// declared it, and is not exported.
+func checkExported(fset *token.FileSet, context *Context, pos token.Pos, st ast.StructType, name string) bool {
+	if st.Package == context.Path || goast.IsExported(name) {
+		return true
+	}
+	context.Errors = append(context.Errors, TranslateError{
+		Class: NotDeclaredErr,
+		Pos:   fset.Position(pos),
+		Text:  "Cannot refer to unexported field or method " + name + " of type " + st.String(),
+	})
+	return false
+}
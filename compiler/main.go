@@ -1,12 +1,20 @@
 package compiler
 
 import (
-	//goast "go/ast"
+	"context"
 	"errors"
+	"fmt"
+	goast "go/ast"
+	"go/build"
 	"go/parser"
 	"go/token"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/twitchyliquid64/harsh/ast"
 )
@@ -14,6 +22,9 @@ import (
 // ErrFuncNotFound is returned if Context.CallFunc() is called with a function that is not known in the context.
 var ErrFuncNotFound = errors.New("No function found")
 
+// ErrNoFiles is returned if a package has no Go files which are built on the current platform.
+var ErrNoFiles = errors.New("No buildable Go source files")
+
 // ParseFile parses a Go source file and returns the root node, a AST Context, and any translation / parse errors.
 func ParseFile(fname string) (ast.Node, *Context, error) {
 	fset := token.NewFileSet()
@@ -30,27 +41,162 @@ func ParseFile(fname string) (ast.Node, *Context, error) {
 
 // ParseLiteral takes a string of Go code, returning an AST context and any translation/parse errors.
 func ParseLiteral(fname, inCode string) (context *Context, err error) {
+	context = NewContext()
+	if err := context.Parse(fname, inCode); err != nil {
+		return nil, err
+	}
+	return context, nil
+}
+
+// NewContext returns an empty context, which code can be parsed into with Parse(). Host functions registered with
+// RegisterFunc() before the code is parsed can be called by the code.
+func NewContext() *Context {
+	return &Context{
+		ConType:  ContextAdhoc,
+		Globals:  ast.Namespace(map[string]*ast.Variant{}),
+		importer: NewImporter("", ""),
+		imports:  map[string]*Context{},
+	}
+}
+
+// Parse parses a string of Go code into the context, which must have been created with NewContext(). Parse errors
+// are returned, and translation errors are added to c.Errors.
+func (c *Context) Parse(fname, inCode string) error {
 	fset := token.NewFileSet()
 	goAst, err := parser.ParseFile(fset, fname, inCode, 0)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	ns := ast.Namespace(map[string]*ast.Variant{})
-	context = &Context{
-		ConType: ContextAdhoc,
-		Globals: ns,
+	resolveImports(fset, c, []*goast.File{goAst})
+	translateGoNode(fset, c, reflect.ValueOf(goAst))
+	return nil
+}
+
+// ParseDir parses the Go package in the directory dir, returning an AST Context for the package. See ParsePackage().
+// Packages which import packages other than those registered with RegisterPackage() must be loaded with an Importer.
+func ParseDir(dir string, tags ...string) (*Context, error) {
+	files, err := readGoFiles(dir)
+	if err != nil {
+		return nil, err
 	}
+	return ParsePackage(files, tags...)
+}
 
+// readGoFiles returns the contents of the Go source files in dir, keyed by their path.
+func readGoFiles(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
-	a := translateGoNode(fset, context, reflect.ValueOf(goAst))
-	if a != nil {
+	files := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Join(dir, entry.Name())] = string(data)
+	}
+	return files, nil
+}
+
+// ParsePackage parses and translates the Go source files of a single package, keyed by filename. Files excluded by
+// their build constraints (evaluated for the current platform with the given additional build tags), and test files,
+// are ignored. The returned Context has a child context for each file, and the errors of every file.
+func ParsePackage(files map[string]string, tags ...string) (*Context, error) {
+	return parsePackage(token.NewFileSet(), files, tags, NewImporter("", ""), "")
+}
+
+// parsePackage parses and translates a package with the given import path, loading any packages it imports with
+// importer.
+func parsePackage(fset *token.FileSet, files map[string]string, tags []string, importer *Importer, path string) (*Context, error) {
+	buildContext := build.Default
+	buildContext.BuildTags = tags
+	buildContext.OpenFile = func(path string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(files[path])), nil
+	}
+
+	var names []string
+	for name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if match, err := buildContext.MatchFile(filepath.Dir(name), filepath.Base(name)); err != nil {
+			return nil, err
+		} else if match {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, ErrNoFiles
+	}
+	sort.Strings(names)
+
+	var goFiles []*goast.File
+	for _, name := range names {
+		goAst, err := parser.ParseFile(fset, name, files[name], 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(goFiles) > 0 && goAst.Name.Name != goFiles[0].Name.Name {
+			return nil, errors.New("Found packages " + goFiles[0].Name.Name + " and " + goAst.Name.Name + " in the same package")
+		}
+		goFiles = append(goFiles, goAst)
+	}
+	scope, err := resolvePackageScope(fset, goFiles)
+	if err != nil {
 		return nil, err
 	}
+
+	context := &Context{
+		ConType:  ContextFile,
+		Name:     goFiles[0].Name.Name,
+		Path:     path,
+		Globals:  ast.Namespace(map[string]*ast.Variant{}),
+		importer: importer,
+		imports:  map[string]*Context{},
+		scope:    scope,
+	}
+	if importer != nil {
+		resolveImports(fset, context, goFiles)
+	}
+	for _, f := range goFiles { //methods may be declared in a different file to their use.
+		collectMethods(context, f.Decls)
+	}
+	for _, f := range goFiles {
+		translateGoNode(fset, context, reflect.ValueOf(f))
+	}
+	for _, child := range context.ChildContexts {
+		context.Errors = append(context.Errors, child.Errors...)
+	}
 	return context, nil
 }
 
+// resolvePackageScope resolves identifiers which refer to declarations in other files of the package, as go/parser
+// only resolves identifiers within a single file. The declarations of the package are returned.
+func resolvePackageScope(fset *token.FileSet, files []*goast.File) (map[string]*goast.Object, error) {
+	scope := map[string]*goast.Object{}
+	for _, f := range files {
+		for name, obj := range f.Scope.Objects {
+			if existing, ok := scope[name]; ok {
+				return nil, errors.New(name + " redeclared in this package: " + fset.Position(obj.Pos()).String() +
+					", previous declaration at " + fset.Position(existing.Pos()).String())
+			}
+			scope[name] = obj
+		}
+	}
+	for _, f := range files {
+		for _, ident := range f.Unresolved {
+			if obj, ok := scope[ident.Name]; ok {
+				ident.Obj = obj
+			}
+		}
+	}
+	return scope, nil
+}
+
 // ExecutionError represents a problem that arose when executing a function.
 type ExecutionError struct {
 	Errors []ast.ExecutionError
@@ -60,29 +206,85 @@ func (e ExecutionError) Error() string {
 	return strconv.Itoa(len(e.Errors)) + " execution errors"
 }
 
-// CallFunc executes the named function in Context, with args, and returning a value. If the function does not exist
-// or execution raises an error, an error is returned.
+// argVariant converts an argument of CallFunc() to a Variant, checking it against the type of the parameter if the
+// function declares one with the same name. Values of a type registered with RegisterHandle() become handles.
+func (c *Context) argVariant(fnType ast.FunctionType, name string, arg interface{}) (*ast.Variant, error) {
+	v, err := c.marshaller().ToVariant(arg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid argument %s: %v", name, err)
+	}
+	for _, param := range fnType.Parameters {
+		if named, isNamed := param.(ast.NamedType); isNamed && named.Ident == name {
+			if err := typecheckValue(param, v); err != nil {
+				return nil, fmt.Errorf("Invalid argument %s: %v", name, err)
+			}
+		}
+	}
+	return v, nil
+}
+
+// returnedError returns the error held by the final result of a function, or nil if the result is not a non-nil error.
+func returnedError(v *ast.Variant) error {
+	if v.Type.Kind() == ast.ComplexTypeTuple && len(v.VectorData) > 0 {
+		v = v.VectorData[len(v.VectorData)-1]
+	}
+	if v.Type.Kind() != ast.PrimitiveTypeError {
+		return nil
+	}
+	return v.ErrorData
+}
+
+// CallFunc executes the named function in Context, with args, and returning a value. Arguments are converted to
+// Variants by ast.Marshaller, and must conform to the type of the parameter with the same name. If the function does
+// not exist, an argument is invalid or execution raises an error, an error is returned. If the function returns a
+// non-nil error as its final result, the Go error it holds is returned, so it can be inspected with errors.Is() and
+// errors.As(). Execution stops at the first error raised, unless ContinueOnError is set. CallFunc never panics: a panic
+// while executing the function is returned as an error of class InternalErr.
 func (c *Context) CallFunc(name string, args map[string]interface{}) (*ast.Variant, error) {
-	for _, decl := range c.Declarations {
+	return c.CallFuncContext(context.Background(), name, args)
+}
+
+// CallFuncContext is like CallFunc(), but aborts execution with an error of class CancelledErr once ctx is done.
+func (c *Context) CallFuncContext(ctx context.Context, name string, args map[string]interface{}) (ret *ast.Variant, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ret = &ast.Variant{Type: ast.PrimitiveTypeUndefined}
+			err = ExecutionError{Errors: []ast.ExecutionError{{
+				Class: ast.InternalErr,
+				Text:  "Internal error: " + fmt.Sprint(r),
+			}}}
+		}
+	}()
+	for _, decl := range c.AllDeclarations() {
 		if decl.Ident == name {
 			execContext := &ast.ExecContext{
 				IsFuncContext:     true,
 				FunctionNamespace: map[string]*ast.Variant{},
 				GlobalNamespace:   c.Globals,
+				Output:            c.Output,
+				MaxSteps:          c.MaxSteps,
+				MaxMemory:         c.MaxMemory,
+				Ctx:               ctx,
+				Stack:             &ast.Frame{Function: name, Depth: 1},
+				MaxDepth:          c.MaxDepth,
+				FailFast:          !c.ContinueOnError,
 			}
-			if args != nil {
-				for name, arg := range args {
-					execContext.FunctionNamespace[name] = ast.MakeVariant(arg)
-				}
-			}
-
-			if _, ok := decl.Type.(ast.FunctionType); !ok {
+			fnType, ok := decl.Type.(ast.FunctionType)
+			if !ok {
 				return &ast.Variant{Type: ast.PrimitiveTypeUndefined}, errors.New("Declaration is not a function")
 			}
+			for name, arg := range args {
+				v, err := c.argVariant(fnType, name, arg)
+				if err != nil {
+					return &ast.Variant{Type: ast.PrimitiveTypeUndefined}, err
+				}
+				execContext.FunctionNamespace[name] = v
+			}
 
-			retValue := decl.Type.(ast.FunctionType).Code.Exec(execContext)
+			retValue := ast.ExecMain(fnType.Code, execContext)
+			c.PeakMemory = execContext.PeakMemory
 			if len(execContext.Errors) == 0 {
-				return retValue, nil
+				return retValue, returnedError(retValue)
 			}
 			return retValue, ExecutionError{Errors: execContext.Errors}
 		}
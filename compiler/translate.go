@@ -14,14 +14,50 @@ func translateGoAST(fset *token.FileSet, inp *goast.File) (ast.Node, *Context) {
 	ns := ast.Namespace(map[string]*ast.Variant{})
 
 	context := &Context{
-		ConType: ContextAdhoc,
-		Globals: ns,
-		Debug:   true,
+		ConType:  ContextAdhoc,
+		Globals:  ns,
+		Debug:    true,
+		importer: NewImporter("", ""),
+		imports:  map[string]*Context{},
 	}
+	resolveImports(fset, context, []*goast.File{inp})
 	return translateGoNode(fset, context, reflect.ValueOf(inp)), context
 }
 
+// translateGoNode returns the node representing the go/ast node t, or nil if t does not translate to a node. The
+// position of t is recorded on the node, unless a position was already recorded by translating a child of t.
 func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast.Node {
+	n := translateGoValue(fset, context, t)
+	if n == nil {
+		return nil
+	}
+	if pos := n.Position(); pos.IsValid() {
+		return n
+	}
+	if p, ok := n.(interface{ SetPosition(token.Position) }); ok && goPos(t).IsValid() {
+		p.SetPosition(fset.Position(goPos(t)))
+	}
+	return n
+}
+
+// goPos returns the position of the go/ast node held by t, or token.NoPos if t does not hold a node.
+func goPos(t reflect.Value) token.Pos {
+	if t.Kind() == reflect.Struct && t.CanAddr() {
+		t = t.Addr()
+	}
+	if t.IsValid() && t.CanInterface() {
+		if n, ok := t.Interface().(goast.Node); ok && !isNilPtr(t) {
+			return n.Pos()
+		}
+	}
+	return token.NoPos
+}
+
+func isNilPtr(t reflect.Value) bool {
+	return t.Kind() == reflect.Ptr && t.IsNil()
+}
+
+func translateGoValue(fset *token.FileSet, context *Context, t reflect.Value) ast.Node {
 	if context.Debug {
 		fmt.Println("translateGoNode(): ", t.Kind(), t.Type().String())
 	}
@@ -37,8 +73,7 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 			if context.ConType == ContextAdhoc {
 				// do nothing - filecontext is the current context as it should be
 			} else {
-				fileContext = &Context{}
-				fileContext.Globals = map[string]*ast.Variant{}
+				fileContext = context.newFileContext()
 				context.ChildContexts = append(context.ChildContexts, fileContext)
 			}
 			fileContext.Name = v.Name.Name
@@ -70,28 +105,28 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 					Val: b,
 				}
 			}
+			if v.Name == "nil" && v.Obj == nil {
+				return &ast.NilLiteral{}
+			}
 			if v.Obj != nil {
 				var t ast.TypeKind = ast.UnknownType
 				switch n := v.Obj.Decl.(type) {
 				case *goast.ValueSpec:
-					t = convertTypeToTypeKind(fset, n.Type, context)
+					t = valueSpecType(fset, context, n, v.Name)
 				case *goast.AssignStmt:
-					//try inferring type by typechecking the RHS of the assignment.
-					assignRHSNode := translateGoNode(fset, context, reflect.ValueOf(n.Rhs[0]))
-					tc := &TypecheckContext{}
-					t = Typecheck(tc, assignRHSNode)
-					if len(tc.Errors) > 0 {
+					t = inferAssignedType(fset, context, n, v.Name, v.Pos())
+				case *goast.Field:
+					t = convertTypeToTypeKind(fset, n.Type, context)
+				case *goast.FuncDecl:
+					if n.Type.TypeParams != nil {
 						context.Errors = append(context.Errors, TranslateError{
 							Class: TypeErrorFound,
 							Pos:   fset.Position(v.Pos()),
-							Text:  "Could not typecheck RHS of assignment to " + v.Name,
+							Text:  "Cannot use generic function " + v.Name + " without instantiation",
 						})
+						break
 					}
-				case *goast.Field:
-					t = convertTypeToTypeKind(fset, n.Type, context)
-				case *goast.FuncDecl:
-					nt := translateGoFuncDecl(fset, context, n)
-					t = nt.Type //unwrap Named node - all we want is the function type
+					t = translateGoFuncType(fset, context, n) //only the signature, so recursive functions terminate
 				default:
 					context.Errors = append(context.Errors, TranslateError{
 						Class: NotSupported,
@@ -104,12 +139,28 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 					Type: t,
 				}
 			}
+			if host, ok := context.Globals[v.Name]; ok { //registered with RegisterFunc()
+				return &ast.VariableReference{
+					Name: v.Name,
+					Type: host.Type,
+				}
+			}
 			return &ast.VariableReference{
 				Name: v.Name,
 				Type: ast.PrimitiveTypeUndefined,
 			}
 
 		case goast.AssignStmt:
+			if v.Tok == token.DEFINE && !declaresVariable(&v) {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: TypeErrorFound,
+					Pos:   fset.Position(v.Pos()),
+					Text:  "No new variables on left side of :=",
+				})
+			}
+			if len(v.Lhs) > 1 {
+				return translateMultiAssign(fset, context, &v)
+			}
 			for _, l := range v.Lhs {
 				if ident, ok := l.(*goast.Ident); ok {
 					if ident.Obj == nil {
@@ -118,9 +169,10 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 							Pos:   fset.Position(v.Pos()),
 							Text:  "Variable not declared.",
 						})
-					} else if _, ok := ident.Obj.Decl.(*goast.AssignStmt); ok { //new local variable
+					} else if decl, ok := ident.Obj.Decl.(*goast.AssignStmt); ok {
+						//only a new local if declared by this statement - otherwise it is an assignment to an outer variable.
 						return &ast.Assign{
-							NewLocal: true,
+							NewLocal: v.Tok == token.DEFINE && decl.TokPos == v.TokPos,
 							Variable: translateGoNode(fset, context, reflect.ValueOf(l)),
 							Value:    translateGoNode(fset, context, reflect.ValueOf(v.Rhs[0])),
 						}
@@ -130,6 +182,12 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 							Variable: translateGoNode(fset, context, reflect.ValueOf(l)),
 							Value:    translateGoNode(fset, context, reflect.ValueOf(v.Rhs[0])),
 						}
+					} else if _, ok := ident.Obj.Decl.(*goast.Field); ok { //function parameter
+						return &ast.Assign{
+							NewLocal: false,
+							Variable: translateGoNode(fset, context, reflect.ValueOf(l)),
+							Value:    translateGoNode(fset, context, reflect.ValueOf(v.Rhs[0])),
+						}
 					}
 					context.Errors = append(context.Errors, TranslateError{
 						Class: NotSupported,
@@ -162,23 +220,47 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 					Expr: translateGoNode(fset, context, reflect.ValueOf(v.X)),
 				}
 			}
+			if v.Op == token.ARROW {
+				return &ast.Receive{
+					Channel: translateGoNode(fset, context, reflect.ValueOf(v.X)),
+				}
+			}
 
 		case goast.SelectorExpr:
+			if pkg := context.importedPackage(&v); pkg != nil {
+				return translateQualified(fset, context, pkg, &v)
+			}
+			expr := translateGoNode(fset, context, reflect.ValueOf(v.X))
+			if st, isStruct := Typecheck(&TypecheckContext{}, expr).(ast.StructType); isStruct {
+				if s := selectMember(st, v.Sel.Name, nil); s.found {
+					checkExported(fset, context, v.Sel.Pos(), s.owner, v.Sel.Name)
+				}
+			}
 			return &ast.NamedSelector{
 				Name: v.Sel.Name,
-				Expr: translateGoNode(fset, context, reflect.ValueOf(v.X)),
+				Expr: expr,
 			}
 
 		case goast.DeclStmt:
 			switch d := v.Decl.(type) {
 			case *goast.GenDecl:
-				ln := ast.StatementList{}
+				ln := ast.StatementList{NoScope: true}
 				for _, spec := range d.Specs {
-					if s, ok := spec.(*goast.ValueSpec); ok {
+					if s, ok := spec.(*goast.ValueSpec); ok && len(s.Names) > 1 && len(s.Values) == 1 {
+						//the variables are declared by the results of a function call: var a, err = f()
+						multi := &ast.MultiAssign{Value: translateGoNode(fset, context, reflect.ValueOf(s.Values[0]))}
+						for _, ident := range s.Names {
+							multi.Variables = append(multi.Variables, assignTarget(fset, context, ident))
+							multi.NewLocal = append(multi.NewLocal, true)
+						}
+						ln.Stmts = append(ln.Stmts, multi)
+					} else if s, ok := spec.(*goast.ValueSpec); ok {
 						for i, ident := range s.Names {
-							assignNode := defaultValue(convertTypeToTypeKind(fset, s.Type, context), context)
+							var assignNode ast.Node
 							if i < len(s.Values) {
 								assignNode = translateGoNode(fset, context, reflect.ValueOf(s.Values[i]))
+							} else {
+								assignNode = defaultValue(convertTypeToTypeKind(fset, s.Type, context), context, fset.Position(s.Pos()))
 							}
 							ln.Stmts = append(ln.Stmts, &ast.Assign{
 								NewLocal: true,
@@ -186,6 +268,9 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 								Value:    assignNode,
 							})
 						}
+					} else if s, ok := spec.(*goast.TypeSpec); ok {
+						//types are resolved where they are referenced, so only check the declaration is valid.
+						convertNamedType(fset, s, context)
 					} else {
 						context.Errors = append(context.Errors, TranslateError{
 							Class: NotSupported,
@@ -201,8 +286,24 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 			if function, ok := v.X.(*goast.CallExpr); ok {
 				return translateGoNode(fset, context, reflect.ValueOf(function))
 			}
+			if recv, ok := v.X.(*goast.UnaryExpr); ok && recv.Op == token.ARROW {
+				return translateGoNode(fset, context, reflect.ValueOf(recv))
+			}
 
 		case goast.CallExpr:
+			if decl, explicit, owner := genericFunc(context, v.Fun); decl != nil {
+				return translateGenericCall(fset, context, owner, v, decl, explicit)
+			}
+			if ident, ok := v.Fun.(*goast.Ident); ok && ident.Obj == nil {
+				if builtin := translateGoBuiltin(fset, context, v, ident.Name); builtin != nil {
+					return builtin
+				}
+			}
+			if sel, ok := v.Fun.(*goast.SelectorExpr); ok {
+				if call := translateMethodCall(fset, context, v, sel); call != nil {
+					return call
+				}
+			}
 			var args []ast.Node
 			for _, astArg := range v.Args {
 				args = append(args, translateGoNode(fset, context, reflect.ValueOf(astArg)))
@@ -210,6 +311,7 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 			return &ast.FunctionCall{
 				Function: translateGoNode(fset, context, reflect.ValueOf(v.Fun)),
 				Args:     args,
+				Spread:   v.Ellipsis.IsValid(),
 			}
 
 		case goast.CompositeLit: //composite literal: <type>{<values>...}
@@ -234,7 +336,22 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 				}
 			}
 
-			if _, ok := v.Type.(*goast.StructType); ok {
+			if handle, ok := subTypeOfComposite.(ast.HandleType); ok {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: TypeErrorFound,
+					Pos:   fset.Position(v.Pos()),
+					Text:  "Cannot construct a value of handle type " + handle.Name,
+				})
+				return &ast.NilLiteral{}
+			}
+			if structType, ok := subTypeOfComposite.(ast.StructType); ok {
+				for _, n := range v.Elts {
+					if kv, ok := n.(*goast.KeyValueExpr); ok {
+						if key, ok := kv.Key.(*goast.Ident); ok {
+							checkExported(fset, context, key.Pos(), structType, key.Name)
+						}
+					}
+				}
 				if len(orderedLiterals) > 0 {
 					context.Errors = append(context.Errors, TranslateError{
 						Class: NotSupported,
@@ -243,7 +360,7 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 					})
 				}
 				return &ast.StructLiteral{
-					Type:   subTypeOfComposite.(ast.StructType),
+					Type:   structType,
 					Values: namedLiterals,
 				}
 			}
@@ -254,6 +371,15 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 					Text:  "Cannot have key-value pairs for non-struct composite literal of subtype: " + reflect.TypeOf(v.Type).String(),
 				})
 			}
+			if sliceType, ok := subTypeOfComposite.(ast.SliceType); ok {
+				return &ast.SliceLiteral{
+					Type:    sliceType,
+					Literal: orderedLiterals,
+				}
+			}
+			if arrayType, ok := subTypeOfComposite.(ast.ArrayType); ok {
+				subTypeOfComposite = arrayType.SubType
+			}
 			return &ast.ArrayLiteral{
 				Type: ast.ArrayType{
 					SubType: subTypeOfComposite,
@@ -265,6 +391,17 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 			}
 
 		case goast.IndexExpr:
+			if decl, explicit, owner := genericFunc(context, &v); decl != nil { //explicit instantiation
+				params, _ := typeParams(decl.Type.TypeParams)
+				bindings := map[*goast.Object]ast.TypeKind{}
+				for i := 0; i < len(explicit) && i < len(params); i++ {
+					bindings[params[i]] = convertTypeToTypeKind(fset, explicit[i], context)
+				}
+				if name, ok := instantiateFunc(fset, context, owner, v.Pos(), decl, bindings); ok {
+					return funcReference(context, owner, name)
+				}
+				return &ast.NilLiteral{}
+			}
 			return &ast.Subscript{
 				Expr:      translateGoNode(fset, context, reflect.ValueOf(v.X)),
 				Subscript: translateGoNode(fset, context, reflect.ValueOf(v.Index)),
@@ -276,6 +413,11 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 				return &ast.IntegerLiteral{
 					Val: int64(v),
 				}
+			} else if v.Kind == token.CHAR {
+				r, _, _, _ := strconv.UnquoteChar(v.Value[1:len(v.Value)-1], '\'')
+				return &ast.IntegerLiteral{
+					Val: int64(r),
+				}
 			} else if v.Kind == token.STRING {
 				s, _ := strconv.Unquote(v.Value)
 				return &ast.StringLiteral{
@@ -298,12 +440,13 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 				return &ast.ReturnStmt{
 					Expr: &ast.NilLiteral{},
 				}
-			} else {
-				context.Errors = append(context.Errors, TranslateError{
-					Class: NotYetSupported,
-					Pos:   fset.Position(v.Pos()),
-					Text:  "Returning multiple values is not supported.",
-				})
+			}
+			tuple := &ast.TupleLiteral{}
+			for _, result := range v.Results {
+				tuple.Values = append(tuple.Values, translateGoNode(fset, context, reflect.ValueOf(result)))
+			}
+			return &ast.ReturnStmt{
+				Expr: tuple,
 			}
 
 		case goast.IfStmt:
@@ -332,12 +475,88 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 			}
 			return forOut
 
+		case goast.RangeStmt:
+			rangeOut := &ast.RangeStmt{
+				NewLocal: v.Tok == token.DEFINE,
+				Expr:     translateGoNode(fset, context, reflect.ValueOf(v.X)),
+				Code:     translateGoNode(fset, context, reflect.ValueOf(v.Body)),
+			}
+			if v.Key != nil && !isBlankIdent(v.Key) {
+				rangeOut.Key = translateGoNode(fset, context, reflect.ValueOf(v.Key))
+			}
+			if v.Value != nil && !isBlankIdent(v.Value) {
+				rangeOut.Value = translateGoNode(fset, context, reflect.ValueOf(v.Value))
+			}
+			return rangeOut
+
+		case goast.GoStmt:
+			if call, ok := translateGoNode(fset, context, reflect.ValueOf(v.Call)).(*ast.FunctionCall); ok {
+				return &ast.GoStmt{
+					Call: call,
+				}
+			}
+			context.Errors = append(context.Errors, TranslateError{
+				Class: NotSupported,
+				Pos:   fset.Position(v.Pos()),
+				Text:  "Only function calls can be started on a new goroutine",
+			})
+
+		case goast.SendStmt:
+			return &ast.SendStmt{
+				Channel: translateGoNode(fset, context, reflect.ValueOf(v.Chan)),
+				Value:   translateGoNode(fset, context, reflect.ValueOf(v.Value)),
+			}
+
+		case goast.SelectStmt:
+			selectOut := &ast.SelectStmt{}
+			for _, stmt := range v.Body.List {
+				clause := stmt.(*goast.CommClause)
+				selectCase := ast.SelectCase{
+					Code: translateGoNode(fset, context, reflect.ValueOf(&goast.BlockStmt{List: clause.Body})),
+				}
+				var recv goast.Expr
+				switch comm := clause.Comm.(type) {
+				case nil:
+					selectCase.IsDefault = true
+				case *goast.SendStmt:
+					selectCase.IsSend = true
+					selectCase.Channel = translateGoNode(fset, context, reflect.ValueOf(comm.Chan))
+					selectCase.Value = translateGoNode(fset, context, reflect.ValueOf(comm.Value))
+				case *goast.ExprStmt:
+					recv = comm.X
+				case *goast.AssignStmt:
+					recv = comm.Rhs[0]
+					selectCase.NewLocal = comm.Tok == token.DEFINE
+					if !isBlankIdent(comm.Lhs[0]) {
+						selectCase.Target = translateGoNode(fset, context, reflect.ValueOf(comm.Lhs[0]))
+					}
+					if len(comm.Lhs) > 1 && !isBlankIdent(comm.Lhs[1]) {
+						selectCase.OkTarget = translateGoNode(fset, context, reflect.ValueOf(comm.Lhs[1]))
+					}
+				}
+				if recv != nil {
+					if u, ok := recv.(*goast.UnaryExpr); ok && u.Op == token.ARROW {
+						selectCase.Channel = translateGoNode(fset, context, reflect.ValueOf(u.X))
+					} else {
+						context.Errors = append(context.Errors, TranslateError{
+							Class: NotSupported,
+							Pos:   fset.Position(clause.Pos()),
+							Text:  "Select case must be a send or receive operation",
+						})
+						continue
+					}
+				}
+				selectOut.Cases = append(selectOut.Cases, selectCase)
+			}
+			return selectOut
+
 		case goast.SwitchStmt:
 			fmt.Println("Not implemented - SWITCH: ", len(v.Body.List))
 
 		default:
 			context.Errors = append(context.Errors, TranslateError{
 				Class: NotSupported,
+				Pos:   fset.Position(goPos(t)),
 				Text:  "Translation of go/ast node not supported: " + t.Type().Name(),
 			})
 		}
@@ -346,6 +565,284 @@ func translateGoNode(fset *token.FileSet, context *Context, t reflect.Value) ast
 	return nil
 }
 
+func isBlankIdent(e goast.Expr) bool {
+	ident, ok := e.(*goast.Ident)
+	return ok && ident.Name == "_"
+}
+
+// builtinsByName maps the names of the builtin functions which take only value arguments to their BuiltinType.
+var builtinsByName = map[string]ast.BuiltinType{
+	"close":  ast.BuiltinClose,
+	"len":    ast.BuiltinLen,
+	"append": ast.BuiltinAppend,
+}
+
+// translateGoBuiltin returns a node representing the invocation of a builtin function, or nil if name is not a builtin.
+func translateGoBuiltin(fset *token.FileSet, context *Context, call goast.CallExpr, name string) ast.Node {
+	switch name {
+	case "make":
+		if len(call.Args) == 0 {
+			context.Errors = append(context.Errors, TranslateError{
+				Class: TypeErrorFound,
+				Pos:   fset.Position(call.Pos()),
+				Text:  "make() requires a type argument",
+			})
+			return &ast.NilLiteral{}
+		}
+		builtin := &ast.BuiltinCall{
+			Builtin: ast.BuiltinMake,
+			Type:    convertTypeToTypeKind(fset, call.Args[0], context),
+		}
+		for _, astArg := range call.Args[1:] {
+			builtin.Args = append(builtin.Args, translateGoNode(fset, context, reflect.ValueOf(astArg)))
+		}
+		return builtin
+
+	case "close", "len", "append":
+		builtin := &ast.BuiltinCall{
+			Builtin: builtinsByName[name],
+			Spread:  call.Ellipsis.IsValid(),
+		}
+		for _, astArg := range call.Args {
+			builtin.Args = append(builtin.Args, translateGoNode(fset, context, reflect.ValueOf(astArg)))
+		}
+		return builtin
+	}
+	return nil
+}
+
+// translateMethodCall returns a call to the method selected by sel, or nil if sel does not select a method. Methods
+// are stored as functions taking the receiver as their first parameter, so the receiver is passed as an argument,
+// selecting the embedded field which declares the method if it is promoted.
+func translateMethodCall(fset *token.FileSet, context *Context, call goast.CallExpr, sel *goast.SelectorExpr) ast.Node {
+	recv := translateGoNode(fset, context, reflect.ValueOf(sel.X))
+	recvType, ok := Typecheck(&TypecheckContext{}, recv).(ast.StructType)
+	if !ok {
+		return nil
+	}
+	s := selectMember(recvType, sel.Sel.Name, context.hasMethod)
+	if s.ambiguous {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(sel.Pos()),
+			Text:  "Ambiguous selector " + sel.Sel.Name + " on type " + recvType.String(),
+		})
+		return nil
+	}
+	if !s.isMethod {
+		return nil
+	}
+	checkExported(fset, context, sel.Sel.Pos(), s.owner, sel.Sel.Name)
+
+	for _, embedded := range s.path {
+		recv = &ast.NamedSelector{Name: embedded, Expr: recv}
+	}
+	args := []ast.Node{recv}
+	for _, astArg := range call.Args {
+		args = append(args, translateGoNode(fset, context, reflect.ValueOf(astArg)))
+	}
+	return &ast.FunctionCall{
+		Function: funcReference(context, context.packageOf(s.owner.Package), methodName(s.owner.Name, sel.Sel.Name)),
+		Args:     args,
+		Spread:   call.Ellipsis.IsValid(),
+	}
+}
+
+// funcReference returns a reference to the function saved as name in the globals of pkg, which is either the package
+// being translated or an imported package.
+func funcReference(context *Context, pkg *Context, name string) ast.Node {
+	if pkg.Path == context.Path {
+		return &ast.VariableReference{
+			Name: name,
+			Type: context.Globals[name].Type,
+		}
+	}
+	return &ast.NamedSelector{
+		Name: name,
+		Expr: context.referencePackage(pkg),
+	}
+}
+
+// inferAssignedType determines the type of the variable name, which is declared by the short variable declaration n.
+func inferAssignedType(fset *token.FileSet, context *Context, n *goast.AssignStmt, name string, pos token.Pos) ast.TypeKind {
+	index := 0
+	for i, l := range n.Lhs {
+		if lhsIdent, ok := l.(*goast.Ident); ok && lhsIdent.Name == name {
+			index = i
+		}
+	}
+	rhs := n.Rhs[0]
+	if len(n.Rhs) == len(n.Lhs) {
+		rhs = n.Rhs[index]
+	}
+
+	// range clauses and receives can declare a second variable, with a different type to the RHS expression.
+	var tc *TypecheckContext
+	var t ast.TypeKind
+	if len(n.Rhs) != len(n.Lhs) && !isRangeOrReceive(rhs) {
+		//the variables are assigned the results of a function call.
+		tc = &TypecheckContext{}
+		t = Typecheck(tc, translateForType(fset, context, rhs))
+		if tuple, ok := t.(ast.TupleType); ok && index < len(tuple.Types) {
+			t = tuple.Types[index]
+		} else if t != ast.UnknownType {
+			tc.Errors = append(tc.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Assignment mismatch: value of type " + t.String() + " is not a tuple",
+			})
+		}
+	} else if u, ok := rhs.(*goast.UnaryExpr); ok && (u.Op == token.RANGE || (u.Op == token.ARROW && index > 0)) {
+		tc = &TypecheckContext{}
+		operandType := Typecheck(tc, translateForType(fset, context, u.X))
+		switch {
+		case u.Op == token.ARROW:
+			t = ast.PrimitiveTypeBool
+		case (operandType.Kind() == ast.ComplexTypeArray || operandType.Kind() == ast.ComplexTypeSlice) && index == 0:
+			t = ast.PrimitiveTypeInt
+		case operandType.Kind() == ast.ComplexTypeArray || operandType.Kind() == ast.ComplexTypeSlice || operandType.Kind() == ast.ComplexTypeChannel:
+			t = operandType.BaseType()
+		default:
+			t = ast.UnknownType
+		}
+	} else {
+		//try inferring type by typechecking the RHS of the assignment.
+		tc = &TypecheckContext{}
+		t = Typecheck(tc, translateForType(fset, context, rhs))
+	}
+
+	if len(tc.Errors) > 0 {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(pos),
+			Text:  "Could not typecheck RHS of assignment to " + name,
+		})
+	}
+	return t
+}
+
+// valueSpecType determines the type of the variable name, which is declared by spec. If the declaration has no type,
+// the type is inferred by typechecking the value of the variable.
+func valueSpecType(fset *token.FileSet, context *Context, spec *goast.ValueSpec, name string) ast.TypeKind {
+	if spec.Type != nil {
+		return convertTypeToTypeKind(fset, spec.Type, context)
+	}
+	index := 0
+	for i, ident := range spec.Names {
+		if ident.Name == name {
+			index = i
+		}
+	}
+
+	tc := &TypecheckContext{}
+	var t ast.TypeKind = ast.UnknownType
+	switch {
+	case len(spec.Values) == len(spec.Names):
+		t = Typecheck(tc, translateForType(fset, context, spec.Values[index]))
+	case len(spec.Values) == 1:
+		//the variables are declared by the results of a function call: var a, err = f()
+		t = Typecheck(tc, translateForType(fset, context, spec.Values[0]))
+		if tuple, ok := t.(ast.TupleType); ok && index < len(tuple.Types) {
+			t = tuple.Types[index]
+		} else {
+			t = ast.UnknownType
+		}
+	}
+	if len(tc.Errors) > 0 {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(spec.Pos()),
+			Text:  "Could not typecheck value of " + name,
+		})
+	}
+	return t
+}
+
+// translateForType translates expr to determine its type. Errors translating expr are discarded, as they are reported
+// where the expression itself is translated.
+func translateForType(fset *token.FileSet, context *Context, expr goast.Expr) ast.Node {
+	n := len(context.Errors)
+	node := translateGoNode(fset, context, reflect.ValueOf(expr))
+	context.Errors = context.Errors[:n]
+	return node
+}
+
+// isRangeOrReceive returns true if the expression is a range clause or a receive, which can assign a second value.
+func isRangeOrReceive(expr goast.Expr) bool {
+	u, ok := expr.(*goast.UnaryExpr)
+	return ok && (u.Op == token.RANGE || u.Op == token.ARROW)
+}
+
+// declaresVariable returns true if the short variable declaration n declares at least one variable, rather than only
+// assigning variables already declared in the same block. Undeclared variables are reported elsewhere.
+func declaresVariable(n *goast.AssignStmt) bool {
+	for _, l := range n.Lhs {
+		ident, ok := l.(*goast.Ident)
+		if !ok || isBlankIdent(ident) {
+			continue
+		}
+		if ident.Obj == nil {
+			return true
+		}
+		if decl, ok := ident.Obj.Decl.(*goast.AssignStmt); ok && decl.TokPos == n.TokPos {
+			return true
+		}
+	}
+	return false
+}
+
+// translateMultiAssign translates an assignment to more than one variable, from either the results of a function
+// call or a value for each variable. Every value is evaluated before any variable is assigned, so a, b = b, a swaps
+// the values of a and b.
+func translateMultiAssign(fset *token.FileSet, context *Context, n *goast.AssignStmt) ast.Node {
+	out := &ast.MultiAssign{}
+	if len(n.Rhs) == 1 {
+		out.Value = translateGoNode(fset, context, reflect.ValueOf(n.Rhs[0]))
+		if recv, ok := out.Value.(*ast.Receive); ok && len(n.Lhs) == 2 {
+			recv.WithOk = true
+		}
+	} else if len(n.Rhs) == len(n.Lhs) {
+		tuple := &ast.TupleLiteral{}
+		for _, r := range n.Rhs {
+			tuple.Values = append(tuple.Values, translateGoNode(fset, context, reflect.ValueOf(r)))
+		}
+		out.Value = tuple
+	} else {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(n.Pos()),
+			Text:  "Assignment mismatch: " + strconv.Itoa(len(n.Lhs)) + " variables but " + strconv.Itoa(len(n.Rhs)) + " values",
+		})
+		return &ast.NilLiteral{}
+	}
+
+	for _, l := range n.Lhs {
+		newLocal := false
+		if ident, ok := l.(*goast.Ident); ok && ident.Obj != nil {
+			//only a new local if declared by this statement - otherwise it is an assignment to an outer variable.
+			decl, isAssign := ident.Obj.Decl.(*goast.AssignStmt)
+			newLocal = n.Tok == token.DEFINE && isAssign && decl.TokPos == n.TokPos
+		}
+		out.Variables = append(out.Variables, assignTarget(fset, context, l))
+		out.NewLocal = append(out.NewLocal, newLocal)
+	}
+	return out
+}
+
+// assignTarget returns the node representing the variable assigned by expr, or nil if the value is discarded.
+func assignTarget(fset *token.FileSet, context *Context, expr goast.Expr) ast.Node {
+	if isBlankIdent(expr) {
+		return nil
+	}
+	if ident, ok := expr.(*goast.Ident); ok && ident.Obj == nil {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: NotDeclaredErr,
+			Pos:   fset.Position(ident.Pos()),
+			Text:  "Variable not declared.",
+		})
+	}
+	return translateGoNode(fset, context, reflect.ValueOf(expr))
+}
+
 func translateGoBinop(tok token.Token) ast.BinOpType {
 	switch tok {
 	case token.ADD:
@@ -372,27 +869,40 @@ func translateGoBinop(tok token.Token) ast.BinOpType {
 	}
 }
 
-func defaultValue(k ast.TypeKind, context *Context) ast.Node {
+// defaultValue returns a literal of the default value of type k, positioned at pos, the declaration of the value.
+func defaultValue(k ast.TypeKind, context *Context, pos token.Position) ast.Node {
 	if k == ast.PrimitiveTypeInt {
-		return &ast.IntegerLiteral{}
+		return &ast.IntegerLiteral{Span: ast.Span{Pos: pos}}
 	}
 	if k == ast.PrimitiveTypeString {
-		return &ast.StringLiteral{}
+		return &ast.StringLiteral{Span: ast.Span{Pos: pos}}
 	}
 	if a, ok := k.(ast.ArrayType); ok {
 		return &ast.ArrayLiteral{
+			Span:    ast.Span{Pos: pos},
 			Type:    a,
 			Literal: nil,
 		}
 	}
+	if s, ok := k.(ast.SliceType); ok {
+		return &ast.SliceLiteral{
+			Span: ast.Span{Pos: pos},
+			Type: s,
+		}
+	}
 	if st, ok := k.(ast.StructType); ok {
 		return &ast.StructLiteral{
+			Span:   ast.Span{Pos: pos},
 			Type:   st,
 			Values: nil,
 		}
 	}
+	if k == ast.PrimitiveTypeError || k.Kind() == ast.ComplexTypeHandle {
+		return &ast.NilLiteral{Span: ast.Span{Pos: pos}, Type: k}
+	}
 	context.Errors = append(context.Errors, TranslateError{
 		Class: InternalErr,
+		Pos:   pos,
 		Text:  "Could not generate a default value for type: " + reflect.TypeOf(k).String(),
 	})
 	return &ast.NilLiteral{}
@@ -407,14 +917,45 @@ func convertTypeToTypeKind(fset *token.FileSet, t goast.Expr, context *Context)
 		if node.Name == "string" {
 			return ast.PrimitiveTypeString
 		}
-		if node.Name == "int" {
+		if node.Name == "int" || node.Name == "rune" { //runes are represented as ints
 			return ast.PrimitiveTypeInt
 		}
 		if node.Name == "bool" {
 			return ast.PrimitiveTypeBool
 		}
+		if node.Name == "error" && node.Obj == nil {
+			return ast.PrimitiveTypeError
+		}
+		if h, ok := context.handleNamed(node.Name); ok && node.Obj == nil {
+			return h
+		}
+		if node.Obj != nil && node.Obj.Kind == goast.Typ {
+			switch decl := node.Obj.Decl.(type) {
+			case *goast.TypeSpec:
+				if decl.TypeParams != nil {
+					context.Errors = append(context.Errors, TranslateError{
+						Class: TypeErrorFound,
+						Pos:   fset.Position(node.Pos()),
+						Text:  "Cannot use generic type " + node.Name + " without instantiation",
+					})
+					return ast.PrimitiveTypeUndefined
+				}
+				return convertNamedType(fset, decl, context)
+			case *goast.Field: //type parameter
+				if t, ok := context.typeArgs[node.Obj]; ok {
+					return t
+				}
+				context.Errors = append(context.Errors, TranslateError{
+					Class: InternalErr,
+					Pos:   fset.Position(node.Pos()),
+					Text:  "Type parameter " + node.Name + " used outside of an instantiation",
+				})
+				return ast.PrimitiveTypeUndefined
+			}
+		}
 		context.Errors = append(context.Errors, TranslateError{
 			Class: NotSupported,
+			Pos:   fset.Position(node.Pos()),
 			Text:  "Cannot convert go/ast.Ident to TypeKind: " + node.Name,
 		})
 	} else if node, ok := t.(*goast.ArrayType); ok {
@@ -428,11 +969,9 @@ func convertTypeToTypeKind(fset *token.FileSet, t goast.Expr, context *Context)
 		} else { //build an array type based on it
 			var lenNode = node.Len
 			if lenNode == nil {
-				context.Errors = append(context.Errors, TranslateError{
-					Class: NotSupported,
-					Pos:   fset.Position(node.Pos()),
-					Text:  "Slices are not yet supported",
-				})
+				return ast.SliceType{
+					SubType: childTypeKind,
+				}
 			} else {
 				return ast.ArrayType{
 					SubType: childTypeKind,
@@ -440,6 +979,27 @@ func convertTypeToTypeKind(fset *token.FileSet, t goast.Expr, context *Context)
 				}
 			}
 		}
+	} else if spec, args, owner := genericType(context, t); spec != nil {
+		return instantiateType(fset, context, owner, t.Pos(), spec, args)
+	} else if node, ok := t.(*goast.SelectorExpr); ok && context.importedPackage(node) != nil {
+		return translateQualifiedType(fset, context, context.importedPackage(node), node)
+	} else if node, ok := t.(*goast.Ellipsis); ok { //variadic parameter
+		return ast.SliceType{
+			SubType: convertTypeToTypeKind(fset, node.Elt, context),
+		}
+	} else if node, ok := t.(*goast.ChanType); ok {
+		chanType := ast.ChannelType{
+			SubType: convertTypeToTypeKind(fset, node.Value, context),
+		}
+		switch node.Dir {
+		case goast.SEND:
+			chanType.Dir = ast.ChanSend
+		case goast.RECV:
+			chanType.Dir = ast.ChanRecv
+		}
+		return chanType
+	} else if node, ok := t.(*goast.FuncType); ok {
+		return convertFuncType(fset, context, node)
 	} else if node, ok := t.(*goast.StructType); ok {
 		structRet := ast.StructType{}
 		if context.Debug {
@@ -447,6 +1007,19 @@ func convertTypeToTypeKind(fset *token.FileSet, t goast.Expr, context *Context)
 		}
 		for _, field := range node.Fields.List {
 			ft := translateType(fset, field, context)
+			if len(field.Names) == 0 {
+				ident, ok := field.Type.(*goast.Ident)
+				if !ok {
+					context.Errors = append(context.Errors, TranslateError{
+						Class: NotSupported,
+						Pos:   fset.Position(field.Pos()),
+						Text:  "Embedded field must be a type name, got: " + reflect.TypeOf(field.Type).String(),
+					})
+					return ast.PrimitiveTypeUndefined
+				}
+				structRet.Fields = append(structRet.Fields, ast.NamedType{Ident: ident.Name, Type: ft[0], Embedded: true})
+				continue
+			}
 			if len(ft) != 1 {
 				context.Errors = append(context.Errors, TranslateError{
 					Class: InternalErr,
@@ -468,6 +1041,32 @@ func convertTypeToTypeKind(fset *token.FileSet, t goast.Expr, context *Context)
 	return ast.PrimitiveTypeUndefined
 }
 
+// convertNamedType returns the type declared by spec, which must be declared by the package being translated. Structs
+// are given the name of the declaration and the import path of the package, so their methods can be found.
+func convertNamedType(fset *token.FileSet, spec *goast.TypeSpec, context *Context) ast.TypeKind {
+	if context.resolvingTypes[spec] {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: NotSupported,
+			Pos:   fset.Position(spec.Pos()),
+			Text:  "Invalid recursive type: " + spec.Name.Name,
+		})
+		return ast.PrimitiveTypeUndefined
+	}
+	if context.resolvingTypes == nil {
+		context.resolvingTypes = map[*goast.TypeSpec]bool{}
+	}
+	context.resolvingTypes[spec] = true
+	defer delete(context.resolvingTypes, spec)
+
+	t := convertTypeToTypeKind(fset, spec.Type, context)
+	if st, isStruct := t.(ast.StructType); isStruct && !spec.Assign.IsValid() {
+		st.Name = spec.Name.Name
+		st.Package = context.Path
+		return st
+	}
+	return t
+}
+
 func translateType(fset *token.FileSet, typ *goast.Field, context *Context) []ast.TypeKind {
 	if context.Debug {
 		fmt.Println("translateType(): ", reflect.TypeOf(typ.Type))
@@ -486,15 +1085,28 @@ func translateType(fset *token.FileSet, typ *goast.Field, context *Context) []as
 }
 
 func translateGoDecl(fset *token.FileSet, context *Context, decls []goast.Decl) {
+	// methods must be known before any function is translated, as calls are resolved by the type of their receiver.
+	collectMethods(context, decls)
+
 	for _, decl := range decls {
 		switch node := decl.(type) {
 		case *goast.FuncDecl:
 			if context.Debug {
 				fmt.Println("FUN DECL: ", node)
 			}
+			if node.Type.TypeParams != nil {
+				continue //generic functions are translated when they are instantiated.
+			}
+			if node.Recv != nil {
+				if newDecl, ok := translateGoMethodDecl(fset, context, node); ok {
+					context.Declarations = append(context.Declarations, newDecl)
+					saveFunc(context, newDecl.Ident, newDecl.Type)
+				}
+				continue
+			}
 			newDecl := translateGoFuncDecl(fset, context, node)
 			context.Declarations = append(context.Declarations, newDecl)
-			context.Globals.Save(newDecl.Ident, newDecl.Type)
+			saveFunc(context, newDecl.Ident, newDecl.Type)
 		case *goast.GenDecl:
 			if context.Debug {
 				fmt.Println("GEN DECL: ", node)
@@ -507,46 +1119,106 @@ func translateGoDecl(fset *token.FileSet, context *Context, decls []goast.Decl)
 	}
 }
 
+// saveFunc saves a function as a global. Functions execute in the globals of the package which declared them, so
+// functions of imported packages can refer to the other members of their package.
+func saveFunc(context *Context, name string, t ast.TypeKind) {
+	context.Globals.Save(name, t)
+	context.Globals[name].Globals = context.Globals
+}
+
+// collectMethods records the method declarations in decls.
+func collectMethods(context *Context, decls []goast.Decl) {
+	if context.methods == nil {
+		context.methods = map[string]map[string]*goast.FuncDecl{}
+	}
+	for _, decl := range decls {
+		if node, ok := decl.(*goast.FuncDecl); ok && node.Recv != nil {
+			if typeName, ok := receiverTypeName(node); ok {
+				if context.methods[typeName] == nil {
+					context.methods[typeName] = map[string]*goast.FuncDecl{}
+				}
+				context.methods[typeName][node.Name.Name] = node
+			}
+		}
+	}
+}
+
 func translateGoGenDecl(fset *token.FileSet, context *Context, node *goast.GenDecl) ast.NamedType {
+	var decl *ast.NamedType
+	declare := func(d ast.NamedType) {
+		if decl == nil {
+			decl = &d
+		}
+	}
 	for _, spec := range node.Specs {
 		switch n := spec.(type) {
 		case *goast.ImportSpec:
 			if context.Debug {
 				fmt.Println("IMPORT", n.Path)
 			}
-			context.Errors = append(context.Errors, TranslateError{
-				Class: NotYetSupported,
-				Pos:   fset.Position(node.Pos()),
-				Text:  "Import statements are not yet supported",
-			})
+			//imports are loaded before the package is translated, see resolveImports().
+			if context.importer == nil {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: NotYetSupported,
+					Pos:   fset.Position(node.Pos()),
+					Text:  "Import statements are only supported in packages loaded by an Importer",
+				})
+			}
+		case *goast.TypeSpec:
+			//types are resolved where they are referenced, so only check the declaration is valid.
+			//interfaces can only be used as constraints, which are checked when a generic declaration is instantiated.
+			if _, isInterface := n.Type.(*goast.InterfaceType); n.TypeParams == nil && !isInterface {
+				convertNamedType(fset, n, context)
+			}
 		case *goast.ValueSpec:
 			if context.Debug {
 				fmt.Println("GLOBAL: ", n.Type, n.Names, n.Values, reflect.TypeOf(n.Type))
 			}
-			//global initializer expressions currently ignored.
+			if len(n.Values) > 0 {
+				declare(translateGlobalValues(fset, context, n))
+				continue
+			}
 			for _, name := range n.Names {
 				switch t := n.Type.(type) {
 				case *goast.Ident:
 					switch t.Name {
+					case "error":
+						context.Globals.Save(name.Name, ast.PrimitiveTypeError)
+						declare(ast.NamedType{
+							Ident: name.Name,
+							Type:  ast.PrimitiveTypeError,
+						})
 					case "int":
 						context.Globals.Save(name.Name, 0)
-						return ast.NamedType{
+						declare(ast.NamedType{
 							Ident: name.Name,
 							Type:  ast.PrimitiveTypeInt,
-						}
+						})
 					case "bool":
 						context.Globals.Save(name.Name, false)
-						return ast.NamedType{
+						declare(ast.NamedType{
 							Ident: name.Name,
 							Type:  ast.PrimitiveTypeBool,
-						}
+						})
 					case "string":
 						context.Globals.Save(name.Name, "")
-						return ast.NamedType{
+						declare(ast.NamedType{
 							Ident: name.Name,
 							Type:  ast.PrimitiveTypeString,
-						}
+						})
 					default:
+						if t.Obj != nil && t.Obj.Kind == goast.Typ {
+							tk := convertTypeToTypeKind(fset, t, context)
+							v, err := ast.DefaultVariantValue(tk)
+							if err == nil {
+								context.Globals.Save(name.Name, v)
+								declare(ast.NamedType{
+									Ident: name.Name,
+									Type:  tk,
+								})
+								continue
+							}
+						}
 						context.Globals.Save(name.Name, ast.PrimitiveTypeUndefined)
 						context.Errors = append(context.Errors, TranslateError{
 							Class: NotSupported,
@@ -568,12 +1240,12 @@ func translateGoGenDecl(fset *token.FileSet, context *Context, node *goast.GenDe
 							fmt.Println(v)
 						}
 						context.Globals.Save(name.Name, v)
-						return ast.NamedType{
+						declare(ast.NamedType{
 							Ident: name.Name,
 							Type:  tk,
-						}
+						})
 					}
-				case *goast.ArrayType:
+				case *goast.ArrayType, *goast.SelectorExpr:
 					tk := convertTypeToTypeKind(fset, t, context)
 					v, err := ast.DefaultVariantValue(tk)
 					if err != nil {
@@ -584,10 +1256,10 @@ func translateGoGenDecl(fset *token.FileSet, context *Context, node *goast.GenDe
 						})
 					} else {
 						context.Globals.Save(name.Name, v)
-						return ast.NamedType{
+						declare(ast.NamedType{
 							Ident: name.Name,
 							Type:  tk,
-						}
+						})
 					}
 				default:
 					context.Errors = append(context.Errors, TranslateError{
@@ -602,33 +1274,184 @@ func translateGoGenDecl(fset *token.FileSet, context *Context, node *goast.GenDe
 		}
 	}
 
+	if decl != nil {
+		return *decl
+	}
 	return ast.NamedType{
 		Ident: "",
 		Type:  ast.PrimitiveTypeUndefined,
 	}
 }
 
+// translateGlobalValues declares the globals of spec with the values of their initializer expressions. Initializers
+// are evaluated as the declaration is translated, so they can only refer to globals and functions declared before them.
+func translateGlobalValues(fset *token.FileSet, context *Context, spec *goast.ValueSpec) ast.NamedType {
+	var values []*ast.Variant
+	switch {
+	case len(spec.Values) == len(spec.Names):
+		for i, value := range spec.Values {
+			values = append(values, evalGlobalValue(fset, context, value, spec.Names[i].Name))
+		}
+	case len(spec.Values) == 1:
+		//the globals are declared by the results of a function call: var a, err = f()
+		v := evalGlobalValue(fset, context, spec.Values[0], spec.Names[0].Name)
+		if v != nil && v.Type.Kind() == ast.ComplexTypeTuple && len(v.VectorData) == len(spec.Names) {
+			values = v.VectorData
+		} else if v != nil {
+			context.Errors = append(context.Errors, TranslateError{
+				Class: TypeErrorFound,
+				Pos:   fset.Position(spec.Pos()),
+				Text:  "Assignment mismatch: " + strconv.Itoa(len(spec.Names)) + " variables but 1 value",
+			})
+		}
+	default:
+		context.Errors = append(context.Errors, TranslateError{
+			Class: TypeErrorFound,
+			Pos:   fset.Position(spec.Pos()),
+			Text:  "Assignment mismatch: " + strconv.Itoa(len(spec.Names)) + " variables but " + strconv.Itoa(len(spec.Values)) + " values",
+		})
+	}
+
+	var declared ast.TypeKind
+	if spec.Type != nil {
+		declared = convertTypeToTypeKind(fset, spec.Type, context)
+	}
+	out := ast.NamedType{Ident: spec.Names[0].Name, Type: declared}
+	for i, name := range spec.Names {
+		v := &ast.Variant{Type: ast.PrimitiveTypeUndefined}
+		if i < len(values) && values[i] != nil {
+			v = values[i]
+		}
+		if declared != nil {
+			if err := typecheckValue(declared, v); err != nil {
+				context.Errors = append(context.Errors, TranslateError{
+					Class: TypeErrorFound,
+					Pos:   fset.Position(name.Pos()),
+					Text:  "Cannot use value as the type of global " + name.Name + ": " + err.Error(),
+				})
+			} else if v.Type == ast.PrimitiveTypeUndefined { //nil
+				v = &ast.Variant{Type: declared}
+			}
+		}
+		context.Globals.Save(name.Name, v)
+		if out.Type == nil {
+			out.Type = v.Type
+		}
+	}
+	return out
+}
+
+// evalGlobalValue evaluates the initializer expression of the global name, returning nil if it raises an error.
+func evalGlobalValue(fset *token.FileSet, context *Context, expr goast.Expr, name string) *ast.Variant {
+	node := translateGoNode(fset, context, reflect.ValueOf(expr))
+	if node == nil {
+		return nil
+	}
+	execContext := &ast.ExecContext{
+		IsFuncContext:     true,
+		FunctionNamespace: map[string]*ast.Variant{},
+		GlobalNamespace:   context.Globals,
+		Output:            context.Output,
+		Stack:             &ast.Frame{Function: name, Depth: 1},
+		FailFast:          true,
+	}
+	v := ast.ExecMain(node, execContext)
+	if len(execContext.Errors) > 0 {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: NotStatic,
+			Pos:   fset.Position(expr.Pos()),
+			Text:  "Could not evaluate the value of global " + name + ": " + execContext.Errors[0].Text,
+		})
+		return nil
+	}
+	return v
+}
+
+// receiverTypeName returns the name of the type a method is declared on.
+func receiverTypeName(node *goast.FuncDecl) (string, bool) {
+	if len(node.Recv.List) != 1 {
+		return "", false
+	}
+	ident, ok := node.Recv.List[0].Type.(*goast.Ident)
+	if !ok {
+		return "", false
+	}
+	return ident.Name, true
+}
+
+// translateGoMethodDecl translates a method, which is declared as a function named <type>.<method>, taking the
+// receiver as its first parameter.
+func translateGoMethodDecl(fset *token.FileSet, context *Context, node *goast.FuncDecl) (ast.NamedType, bool) {
+	typeName, ok := receiverTypeName(node)
+	if !ok {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: NotSupported,
+			Pos:   fset.Position(node.Pos()),
+			Text:  "Method receivers must be a named struct type: " + node.Name.Name,
+		})
+		return ast.NamedType{}, false
+	}
+	if st, isStruct := convertTypeToTypeKind(fset, node.Recv.List[0].Type, context).(ast.StructType); !isStruct || st.Name == "" {
+		context.Errors = append(context.Errors, TranslateError{
+			Class: NotSupported,
+			Pos:   fset.Position(node.Pos()),
+			Text:  "Methods can only be declared on struct types: " + typeName + "." + node.Name.Name,
+		})
+		return ast.NamedType{}, false
+	}
+
+	decl := translateGoFuncDecl(fset, context, node)
+	decl.Ident = methodName(typeName, node.Name.Name)
+	return decl, true
+}
+
 func translateGoFuncDecl(fset *token.FileSet, context *Context, node *goast.FuncDecl) ast.NamedType {
+	fnType := translateGoFuncType(fset, context, node)
+	fnType.Code = translateGoNode(fset, context, reflect.ValueOf(node.Body))
+	ast.Resolve(fnType)
+	return ast.NamedType{
+		Ident: node.Name.Name,
+		Type:  fnType,
+	}
+}
+
+// translateGoFuncType returns the signature of a function, without translating its body. The receiver of a method is
+// its first parameter.
+func translateGoFuncType(fset *token.FileSet, context *Context, node *goast.FuncDecl) ast.FunctionType {
+	var parameters []ast.TypeKind
+
+	if node.Recv != nil && len(node.Recv.List) == 1 {
+		recv := translateType(fset, node.Recv.List[0], context)
+		if _, named := recv[0].(ast.NamedType); !named {
+			recv[0] = ast.NamedType{Ident: "_", Type: recv[0]}
+		}
+		parameters = append(parameters, recv[0])
+	}
+
+	fnType := convertFuncType(fset, context, node.Type)
+	fnType.Parameters = append(parameters, fnType.Parameters...)
+	return fnType
+}
+
+// convertFuncType returns the signature described by a function type, such as the type of a parameter which accepts
+// a function.
+func convertFuncType(fset *token.FileSet, context *Context, node *goast.FuncType) ast.FunctionType {
 	var returnType ast.TypeKind = ast.PrimitiveTypeUndefined
 	var parameters []ast.TypeKind
 
-	if node.Type.Results != nil {
-		if len(node.Type.Results.List) == 1 {
-			if t := translateType(fset, node.Type.Results.List[0], context); t != nil {
-				if len(t) == 1 {
-					returnType = t[0]
-				}
-			}
-		} else if len(node.Type.Results.List) > 1 {
-			context.Errors = append(context.Errors, TranslateError{
-				Class: NotYetSupported,
-				Pos:   fset.Position(node.Pos()),
-				Text:  "Functions with more than one result are not supported",
-			})
+	if node.Results != nil {
+		var results []ast.TypeKind
+		for _, r := range node.Results.List {
+			results = append(results, translateType(fset, r, context)...)
+		}
+		if len(results) == 1 {
+			returnType = results[0]
+		} else if len(results) > 1 {
+			returnType = ast.TupleType{Types: results}
 		}
 	}
-	if node.Type.Params != nil {
-		for _, p := range node.Type.Params.List {
+	if node.Params != nil {
+		for _, p := range node.Params.List {
 			if t := translateType(fset, p, context); t != nil {
 				for _, pm := range t {
 					parameters = append(parameters, pm)
@@ -637,12 +1460,14 @@ func translateGoFuncDecl(fset *token.FileSet, context *Context, node *goast.Func
 		}
 	}
 
-	return ast.NamedType{
-		Ident: node.Name.Name,
-		Type: ast.FunctionType{
-			Parameters: parameters,
-			Code:       translateGoNode(fset, context, reflect.ValueOf(node.Body)),
-			ReturnType: returnType,
-		},
+	variadic := false
+	if params := node.Params; params != nil && len(params.List) > 0 {
+		_, variadic = params.List[len(params.List)-1].Type.(*goast.Ellipsis)
+	}
+
+	return ast.FunctionType{
+		Parameters: parameters,
+		ReturnType: returnType,
+		Variadic:   variadic,
 	}
 }
@@ -3,6 +3,8 @@ package compiler
 import (
 	goast "go/ast"
 	"go/token"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -30,7 +32,7 @@ func TestBasicLitKindUnknownProducesError(t *testing.T) {
 	}
 }
 
-func TestMultipleReturnProducesError(t *testing.T) {
+func TestMultipleReturnProducesTuple(t *testing.T) {
 	ns := ast.Namespace(map[string]*ast.Variant{})
 	context := &Context{
 		ConType: ContextAdhoc,
@@ -39,17 +41,19 @@ func TestMultipleReturnProducesError(t *testing.T) {
 	}
 	node := translateGoNode(nil, context, reflect.ValueOf(goast.ReturnStmt{
 		Results: []goast.Expr{
-			nil, nil,
+			&goast.BasicLit{Kind: token.INT, Value: "1"},
+			&goast.BasicLit{Kind: token.STRING, Value: `"a"`},
 		},
 	}))
-	if len(context.Errors) != 1 {
-		t.Error("Error expected")
+	if len(context.Errors) != 0 {
+		t.Error("No errors expected: ", context.Errors)
 	}
-	if context.Errors[0].Class != NotYetSupported {
-		t.Error("Incorrect error class")
+	ret, ok := node.(*ast.ReturnStmt)
+	if !ok {
+		t.Fatal("ReturnStmt expected")
 	}
-	if node != nil {
-		t.Error("Nil node expected")
+	if tuple, ok := ret.Expr.(*ast.TupleLiteral); !ok || len(tuple.Values) != 2 {
+		t.Error("TupleLiteral with two values expected")
 	}
 }
 
@@ -121,8 +125,194 @@ func TestUnknownGlobalProducesError(t *testing.T) {
 	}
 }
 
+func TestInvalidGlobalValueProducesError(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		var x int = "a"
+		var y = 1 / 0
+		var a, b = 1
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) != 3 {
+		t.Fatalf("Expected 3 errors, got %v", c.Errors)
+	}
+	for i, class := range []translateErrClass{TypeErrorFound, NotStatic, TypeErrorFound} {
+		if c.Errors[i].Class != class {
+			t.Errorf("Error %d: expected class %v, got %v", i, class, c.Errors[i])
+		}
+	}
+}
+
 func TestExecutionErrorStringCorrect(t *testing.T) {
 	if (&ExecutionError{}).Error() != "0 execution errors" {
 		t.Error("ExecutionError string incorrect")
 	}
 }
+
+func TestAmbiguousPromotedMethodProducesError(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		type A struct {}
+		func (a A) Name() string {
+			return "a"
+		}
+
+		type B struct {}
+		func (b B) Name() string {
+			return "b"
+		}
+
+		type C struct {
+			A
+			B
+		}
+
+    func Test() string {
+			var c C
+			return c.Name()
+    }
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) != 1 {
+		t.Fatalf("Expected 1 error, got %d", len(c.Errors))
+	}
+	if c.Errors[0].Class != TypeErrorFound {
+		t.Error("Incorrect error class")
+	}
+}
+
+func TestGenericConstraintNotSatisfiedProducesError(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		func Max[T int | string](a, b T) T {
+			return a
+		}
+
+    func Test() bool {
+			return Max(true, false)
+    }
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) == 0 {
+		t.Fatal("Expected error")
+	}
+	if c.Errors[0].Class != TypeErrorFound {
+		t.Error("Incorrect error class")
+	}
+}
+
+func TestGenericTypeParameterNotInferredProducesError(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		func Zero[T any]() T {
+			var z T
+			return z
+		}
+
+    func Test() int {
+			return Zero()
+    }
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) == 0 {
+		t.Fatal("Expected error")
+	}
+	if c.Errors[0].Class != TypeErrorFound {
+		t.Error("Incorrect error class")
+	}
+}
+
+func TestRedeclarationInSameBlockProducesError(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+    package test
+
+		func pair() (int, int) {
+			return 1, 2
+		}
+
+    func Test() int {
+			x := 1
+			x := 2
+			a, b := pair()
+			a, b := pair()
+			if true {
+				x := 3
+				x, y := 4, 5
+				a, c := pair()
+				return x + y + a + c
+			}
+			return x + a + b
+    }
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", c.Errors)
+	}
+	for i, line := range []int{10, 12} {
+		if c.Errors[i].Class != TypeErrorFound || c.Errors[i].Text != "No new variables on left side of :=" {
+			t.Errorf("Unexpected error %v", c.Errors[i])
+		}
+		if c.Errors[i].Pos.Line != line {
+			t.Errorf("Expected error on line %d, got %v", line, c.Errors[i].Pos)
+		}
+	}
+}
+
+func TestTranslateErrorsAndNodesHavePositions(t *testing.T) {
+	c, err := ParseLiteral("test.go", `package test
+
+func Test() int {
+	var x unknownType
+	return 1 + 2
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) == 0 {
+		t.Fatal("Expected error")
+	}
+	if pos := c.Errors[0].Pos; pos.Line != 4 || pos.Column != 8 {
+		t.Errorf("Expected an error at 4:8, got %v", pos)
+	}
+
+	code := c.Globals["Test"].Type.(ast.FunctionType).Code.(*ast.StatementList)
+	ret := code.Stmts[len(code.Stmts)-1].(*ast.ReturnStmt)
+	if pos := ret.Position(); pos.String() != "test.go:5:2" {
+		t.Errorf("Expected the return at test.go:5:2, got %v", pos)
+	}
+	if pos := ret.Expr.(*ast.BinaryOp).RHS.Position(); pos.String() != "test.go:5:13" {
+		t.Errorf("Expected the literal at test.go:5:13, got %v", pos)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.go")
+	if err := os.WriteFile(path, []byte("package test\n\nfunc f() {\n\tx := 1 + \"a\"\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := " 4 | \tx := 1 + \"a\"\n   | \t     ^\n"
+	if got := Excerpt(token.Position{Filename: path, Line: 4, Column: 7}); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := Excerpt(token.Position{Filename: path, Line: 40, Column: 1}); got != "" {
+		t.Errorf("Expected no excerpt past the end of the file, got %q", got)
+	}
+	if got := Excerpt(token.Position{}); got != "" {
+		t.Errorf("Expected no excerpt for an invalid position, got %q", got)
+	}
+}
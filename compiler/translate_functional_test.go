@@ -1408,3 +1408,26 @@ func TestForLoopInitializer(t *testing.T) {
 		t.Error("FunctionCall node expected in Code")
 	}
 }
+
+func TestReassignmentIsNotNewLocal(t *testing.T) {
+	_, context := setupTestGetAST(nil, `
+    package test
+
+    func testReassign() int {
+      x := 1
+      x = 2
+      return x
+    }`, t)
+
+	stmts := context.Declarations[0].Type.(ast.FunctionType).Code.(*ast.StatementList).Stmts
+	if len(stmts) != 3 {
+		t.Error("Unexpected number of statements")
+		t.FailNow()
+	}
+	if !stmts[0].(*ast.Assign).NewLocal {
+		t.Error("Expected declaration to be a new local")
+	}
+	if stmts[1].(*ast.Assign).NewLocal {
+		t.Error("Expected reassignment not to be a new local")
+	}
+}
@@ -1,7 +1,11 @@
 package compiler
 
 import (
+	"errors"
+	"fmt"
+	"go/token"
 	"reflect"
+	"strconv"
 
 	"github.com/twitchyliquid64/harsh/ast"
 )
@@ -10,6 +14,43 @@ import (
 type TypecheckContext struct {
 	Errors     []TypeError
 	ReturnType ast.TypeKind
+	scope      *typecheckScope
+}
+
+// typecheckScope records the types of variables declared within a block, mirroring ast.Scope during execution.
+type typecheckScope struct {
+	parent *typecheckScope
+	vars   map[string]ast.TypeKind
+}
+
+func (context *TypecheckContext) pushScope() {
+	context.scope = &typecheckScope{parent: context.scope, vars: map[string]ast.TypeKind{}}
+}
+
+func (context *TypecheckContext) popScope() {
+	context.scope = context.scope.parent
+}
+
+// declare records a new variable in the innermost block, returning false if it was already declared in that block.
+func (context *TypecheckContext) declare(name string, t ast.TypeKind) bool {
+	if context.scope == nil {
+		context.pushScope()
+	}
+	if _, exists := context.scope.vars[name]; exists {
+		return false
+	}
+	context.scope.vars[name] = t
+	return true
+}
+
+// lookup returns the type of the named variable as declared in the innermost enclosing block, or nil.
+func (context *TypecheckContext) lookup(name string) ast.TypeKind {
+	for s := context.scope; s != nil; s = s.parent {
+		if t, ok := s.vars[name]; ok {
+			return t
+		}
+	}
+	return nil
 }
 
 // TypeErrorKind represents an enum of error types which symbolise the kind of TypeError.
@@ -22,15 +63,23 @@ const (
 	TypeErrorIncompatibleTypesErr
 	// TypeErrorNotFoundErr represents a situation where a named sub element is used which does not exist.
 	TypeErrorNotFoundErr
+	// TypeErrorRedeclaredErr represents a variable being declared twice in the same block.
+	TypeErrorRedeclaredErr
+	// TypeErrorAmbiguousSelectorErr represents a selector which matches more than one promoted field or method.
+	TypeErrorAmbiguousSelectorErr
 )
 
 // TypeError represents an error in the AST found during Typecheck().
 type TypeError struct {
 	Msg  string
 	Kind TypeErrorKind
+	Pos  token.Position // position of the node which failed to typecheck, if known
 }
 
 func (t TypeError) Error() string {
+	if t.Pos.IsValid() {
+		return t.Pos.String() + ": " + t.Msg
+	}
 	return t.Msg
 }
 
@@ -73,6 +122,79 @@ func funcEqual(l ast.FunctionType, r ast.FunctionType) bool {
 	return true
 }
 
+// selection describes the result of looking up a field or method of a struct.
+type selection struct {
+	found     bool
+	ambiguous bool
+	path      []string // embedded fields traversed to reach the struct declaring the member
+	field     ast.NamedType
+	isMethod  bool
+	owner     ast.StructType // struct declaring the member
+}
+
+// selectMember looks up the named field or method of st, which may be promoted from an embedded struct. The shallowest
+// member with the name is chosen, and the selection is ambiguous if more than one exists at that depth. hasMethod
+// reports if the named struct type declares the method, and may be nil if methods should not be considered.
+func selectMember(st ast.StructType, name string, hasMethod func(st ast.StructType, method string) bool) selection {
+	type embedded struct {
+		path []string
+		st   ast.StructType
+	}
+	level := []embedded{{st: st}}
+
+	// structs cannot embed themselves, so the search always terminates.
+	for len(level) > 0 {
+		var next []embedded
+		var out selection
+		for _, e := range level {
+			for _, field := range e.st.Fields {
+				if field.Ident == name {
+					out.ambiguous = out.found
+					if !out.found {
+						out = selection{found: true, path: e.path, field: field, owner: e.st}
+					}
+				}
+				if s, isStruct := field.Type.(ast.StructType); isStruct && field.Embedded {
+					next = append(next, embedded{path: append(append([]string{}, e.path...), field.Ident), st: s})
+				}
+			}
+			if hasMethod != nil && e.st.Name != "" && hasMethod(e.st, name) {
+				out.ambiguous = out.found
+				if !out.found {
+					out = selection{found: true, path: e.path, isMethod: true, owner: e.st}
+				}
+			}
+		}
+		if out.found {
+			return out
+		}
+		level = next
+	}
+	return selection{}
+}
+
+// IsComparable returns true if values of the given type can be compared with == and !=. Functions and slices are not
+// comparable, and neither are arrays or structs which contain them.
+func IsComparable(t ast.TypeKind) bool {
+	if _, isNamedType := t.(ast.NamedType); isNamedType {
+		return IsComparable(t.BaseType())
+	}
+
+	switch t.Kind() {
+	case ast.ComplexTypeFunction, ast.ComplexTypeSlice, ast.ComplexTypeTuple:
+		return false
+	case ast.ComplexTypeArray:
+		return IsComparable(t.(ast.ArrayType).SubType)
+	case ast.ComplexTypeStruct:
+		for _, field := range t.(ast.StructType).Fields {
+			if !IsComparable(field.Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // TypeEqual returns true if the given types are equivalent and can be operated without promotion.
 func TypeEqual(l ast.TypeKind, r ast.TypeKind) bool {
 	if _, isNamedType := l.(ast.NamedType); isNamedType {
@@ -88,18 +210,154 @@ func TypeEqual(l ast.TypeKind, r ast.TypeKind) bool {
 	if l.Kind() == ast.ComplexTypeArray && r.Kind() == ast.ComplexTypeArray {
 		return TypeEqual(l.(ast.ArrayType).SubType, r.(ast.ArrayType).SubType)
 	}
+	if l.Kind() == ast.ComplexTypeSlice && r.Kind() == ast.ComplexTypeSlice {
+		return TypeEqual(l.BaseType(), r.BaseType())
+	}
 	if l.Kind() == ast.ComplexTypeFunction && r.Kind() == ast.ComplexTypeFunction {
 		return funcEqual(l.(ast.FunctionType), r.(ast.FunctionType))
 	}
+	if l.Kind() == ast.ComplexTypeChannel && r.Kind() == ast.ComplexTypeChannel {
+		return TypeEqual(l.BaseType(), r.BaseType())
+	}
+	if l.Kind() == ast.ComplexTypeHandle && r.Kind() == ast.ComplexTypeHandle {
+		return l.(ast.HandleType).Name == r.(ast.HandleType).Name
+	}
+	if lt, ok := l.(ast.TupleType); ok {
+		if rt, ok := r.(ast.TupleType); ok {
+			return tuplesEqual(lt, rt)
+		}
+	}
 
 	return l == r
 }
 
+// tuplesEqual returns true if the tuples have the same number of elements, and the types of the elements are equal.
+// Elements of unknown type, such as nil, are considered equal to any type.
+func tuplesEqual(l, r ast.TupleType) bool {
+	if len(l.Types) != len(r.Types) {
+		return false
+	}
+	for i := range l.Types {
+		if l.Types[i] == ast.UnknownType || r.Types[i] == ast.UnknownType {
+			continue
+		}
+		if !TypeEqual(l.Types[i], r.Types[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// typecheckNilComparison checks the comparison n, where operand is compared with the nil literal. Only errors, slices,
+// channels and handles can be compared with nil.
+func typecheckNilComparison(context *TypecheckContext, n *ast.BinaryOp, operand ast.Node) ast.TypeKind {
+	if n.Op != ast.BinOpEquality && n.Op != ast.BinOpNotEquality {
+		context.Errors = append(context.Errors, TypeError{
+			Kind: TypeErrorIncompatibleTypesErr,
+			Msg:  "Cannot perform binary operation " + n.Op.String() + " on nil",
+		})
+		return ast.UnknownType
+	}
+	t := Typecheck(context, operand)
+	switch t.Kind() {
+	case ast.PrimitiveTypeError, ast.ComplexTypeSlice, ast.ComplexTypeChannel, ast.ComplexTypeHandle, ast.UnknownType:
+		return ast.PrimitiveTypeBool
+	}
+	context.Errors = append(context.Errors, TypeError{
+		Kind: TypeErrorIncompatibleTypesErr,
+		Msg:  "Cannot compare type " + t.String() + " with nil",
+	})
+	return ast.UnknownType
+}
+
+// typecheckMultiAssign checks that the value assigned by n is a tuple, with an element for each variable of a type
+// which can be assigned to the variable. Variables declared by the assignment take the type of their element.
+func typecheckMultiAssign(context *TypecheckContext, n *ast.MultiAssign) ast.TypeKind {
+	value := Typecheck(context, n.Value)
+	tuple, isTuple := value.(ast.TupleType)
+	if value != ast.UnknownType && (!isTuple || len(tuple.Types) != len(n.Variables)) {
+		context.Errors = append(context.Errors, TypeError{
+			Kind: TypeErrorIncompatibleTypesErr,
+			Msg:  "Assignment mismatch: " + strconv.Itoa(len(n.Variables)) + " variables but value has type " + value.String(),
+		})
+		return ast.UnknownType
+	}
+
+	for i, variable := range n.Variables {
+		if variable == nil {
+			continue
+		}
+		var t ast.TypeKind = ast.UnknownType
+		if isTuple {
+			t = tuple.Types[i]
+		}
+		if ident, ok := variable.(*ast.VariableReference); ok && n.NewLocal[i] {
+			declared := ident.Type
+			if declared == nil || declared == ast.UnknownType || declared == ast.PrimitiveTypeUndefined {
+				declared = t
+			}
+			if !context.declare(ident.Name, declared) {
+				context.Errors = append(context.Errors, TypeError{
+					Kind: TypeErrorRedeclaredErr,
+					Msg:  ident.Name + " redeclared in this block",
+				})
+				return ast.UnknownType
+			}
+			continue
+		}
+		vt := Typecheck(context, variable)
+		if t == ast.UnknownType || vt == ast.UnknownType {
+			continue
+		}
+		if !TypeEqual(t, vt) {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Cannot perform assignment to " + vt.String() + " with type " + t.String(),
+			})
+			return ast.UnknownType
+		}
+	}
+	return value
+}
+
+// acceptsArgument returns true if an argument of type arg can be passed to a parameter of type param. Native functions
+// declare parameters which accept values of any type with UnknownType. Arguments of unknown type, such as nil, are
+// accepted by any parameter.
+func acceptsArgument(param ast.TypeKind, arg ast.TypeKind) bool {
+	if named, isNamed := param.(ast.NamedType); isNamed {
+		param = named.Type
+	}
+	if param == ast.UnknownType || arg == ast.UnknownType {
+		return true
+	}
+	if param.Kind() == ast.ComplexTypeSlice && arg.Kind() == ast.ComplexTypeSlice {
+		return acceptsArgument(param.BaseType(), arg.BaseType())
+	}
+	return TypeEqual(arg, param)
+}
+
 // Typecheck is a recursive method that returns the effective type of the return value of the node, if it were executed.
-// Any type errors are added to context.Errors.
+// Any type errors are added to context.Errors, at the position of the innermost node which raised them.
 func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
+	before := len(context.Errors)
+	t := typecheckNode(context, node)
+	if node != nil {
+		for i := before; i < len(context.Errors); i++ {
+			if !context.Errors[i].Pos.IsValid() {
+				context.Errors[i].Pos = node.Position()
+			}
+		}
+	}
+	return t
+}
+
+func typecheckNode(context *TypecheckContext, node ast.Node) ast.TypeKind {
 	switch n := (node).(type) {
 	case *ast.StatementList:
+		if !n.NoScope {
+			context.pushScope()
+			defer context.popScope()
+		}
 		for _, subNode := range n.Stmts {
 			Typecheck(context, subNode)
 		}
@@ -113,23 +371,52 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 			})
 			return ast.UnknownType
 		}
-		if len(funcNodeType.(ast.FunctionType).Parameters) != len(n.Args) {
+		fnType := funcNodeType.(ast.FunctionType)
+		if n.Spread && !fnType.Variadic {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Cannot use ... in call to non-variadic function",
+			})
+			return ast.UnknownType
+		}
+		params := fnType.Parameters
+		if fnType.Variadic && !n.Spread {
+			// any number of trailing arguments may be passed, each of the element type of the final parameter.
+			fixed := len(params) - 1
+			if len(n.Args) < fixed {
+				context.Errors = append(context.Errors, TypeError{
+					Kind: TypeErrorIncompatibleTypesErr,
+					Msg:  "Cannot perform function invocation - not enough parameters",
+				})
+				return ast.UnknownType
+			}
+			variadicParam := params[fixed]
+			if named, isNamed := variadicParam.(ast.NamedType); isNamed {
+				variadicParam = named.Type
+			}
+			elemType := variadicParam.BaseType()
+			params = append([]ast.TypeKind{}, params[:fixed]...)
+			for i := fixed; i < len(n.Args); i++ {
+				params = append(params, elemType)
+			}
+		}
+		if len(params) != len(n.Args) {
 			context.Errors = append(context.Errors, TypeError{
 				Kind: TypeErrorIncompatibleTypesErr,
 				Msg:  "Cannot perform function invocation - incorrect number of parameters",
 			})
 			return ast.UnknownType
 		}
-		for i, param := range funcNodeType.(ast.FunctionType).Parameters {
+		for i, param := range params {
 			paramType := Typecheck(context, n.Args[i])
-			if !TypeEqual(paramType, param) {
+			if !acceptsArgument(param, paramType) {
 				context.Errors = append(context.Errors, TypeError{
 					Kind: TypeErrorIncompatibleTypesErr,
 					Msg:  "Parameter type mismatch: parameter has type " + param.String() + " but was called with " + paramType.String(),
 				})
 			}
 		}
-		return funcNodeType.(ast.FunctionType).ReturnType
+		return fnType.ReturnType
 
 	case *ast.VariableReference:
 		if n.Type == nil {
@@ -139,8 +426,23 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 			})
 			return ast.UnknownType
 		}
+		if n.Type == ast.UnknownType || n.Type == ast.PrimitiveTypeUndefined {
+			if t := context.lookup(n.Name); t != nil {
+				return t
+			}
+		}
 		return n.Type
 	case *ast.NilLiteral:
+		if n.Type != nil {
+			return n.Type
+		}
+		return ast.UnknownType //nil can be assigned to any type which has a nil value
+	case *ast.TupleLiteral:
+		t := ast.TupleType{}
+		for _, v := range n.Values {
+			t.Types = append(t.Types, Typecheck(context, v))
+		}
+		return t
 	case *ast.StringLiteral:
 		return ast.PrimitiveTypeString
 	case *ast.IntegerLiteral:
@@ -148,6 +450,12 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 	case *ast.BoolLiteral:
 		return ast.PrimitiveTypeBool
 	case *ast.BinaryOp:
+		if _, isNil := n.RHS.(*ast.NilLiteral); isNil {
+			return typecheckNilComparison(context, n, n.LHS)
+		}
+		if _, isNil := n.LHS.(*ast.NilLiteral); isNil {
+			return typecheckNilComparison(context, n, n.RHS)
+		}
 		l := Typecheck(context, n.LHS)
 		r := Typecheck(context, n.RHS)
 		if l == ast.UnknownType || r == ast.UnknownType {
@@ -160,6 +468,20 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 			})
 			return ast.UnknownType
 		}
+		if l.Kind() == ast.ComplexTypeHandle && n.Op != ast.BinOpEquality && n.Op != ast.BinOpNotEquality {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Cannot perform binary operation " + n.Op.String() + " on handle type " + l.String(),
+			})
+			return ast.UnknownType
+		}
+		if (n.Op == ast.BinOpEquality || n.Op == ast.BinOpNotEquality) && !IsComparable(l) {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Cannot perform binary operation " + n.Op.String() + " on operands with type " + l.String() + ", which is not comparable",
+			})
+			return ast.UnknownType
+		}
 		if isEqualityOrLogicalOp(n.Op) {
 			return ast.PrimitiveTypeBool
 		}
@@ -180,6 +502,19 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 		}
 		return n.Type
 
+	case *ast.SliceLiteral:
+		for _, element := range n.Literal {
+			eType := Typecheck(context, element)
+			if !TypeEqual(eType, n.Type.SubType) {
+				context.Errors = append(context.Errors, TypeError{
+					Kind: TypeErrorIncompatibleTypesErr,
+					Msg:  "Invalid slice literal - cannot have value of type " + eType.String() + " when the slice contains elements of type " + n.Type.SubType.String(),
+				})
+				return ast.UnknownType
+			}
+		}
+		return n.Type
+
 	case *ast.ArrayLiteral:
 		for _, element := range n.Literal {
 			eType := Typecheck(context, element)
@@ -195,7 +530,30 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 
 	case *ast.Assign:
 		l := Typecheck(context, n.Value)
-		r := Typecheck(context, n.Variable)
+		if l.Kind() == ast.ComplexTypeTuple {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Multiple-value " + l.String() + " in single-value context",
+			})
+			return ast.UnknownType
+		}
+		var r ast.TypeKind
+		if ident, ok := n.Variable.(*ast.VariableReference); ok && n.NewLocal {
+			//the variable is new, so must not resolve to any variable it shadows.
+			r = ident.Type
+			if r == nil || r == ast.UnknownType || r == ast.PrimitiveTypeUndefined {
+				r = l
+			}
+			if !context.declare(ident.Name, r) {
+				context.Errors = append(context.Errors, TypeError{
+					Kind: TypeErrorRedeclaredErr,
+					Msg:  ident.Name + " redeclared in this block",
+				})
+				return ast.UnknownType
+			}
+		} else {
+			r = Typecheck(context, n.Variable)
+		}
 		if l == ast.UnknownType || r == ast.UnknownType {
 			return ast.UnknownType
 		}
@@ -208,6 +566,9 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 		}
 		return l
 
+	case *ast.MultiAssign:
+		return typecheckMultiAssign(context, n)
+
 	case *ast.ReturnStmt:
 		if context.ReturnType != nil { //return type is known, test it
 			v := Typecheck(context, n.Expr)
@@ -234,7 +595,7 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 			return ast.UnknownType
 		}
 		RHS := Typecheck(context, n.Expr)
-		if RHS.Kind() != ast.ComplexTypeArray { //TODO: support others
+		if RHS.Kind() != ast.ComplexTypeArray && RHS.Kind() != ast.ComplexTypeSlice {
 			context.Errors = append(context.Errors, TypeError{
 				Kind: TypeErrorIncompatibleTypesErr,
 				Msg:  "Cannot subscript non-array type " + RHS.String(),
@@ -244,6 +605,11 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 		return RHS.BaseType()
 
 	case *ast.ForStmt:
+		if n.Init != nil {
+			context.pushScope()
+			defer context.popScope()
+			Typecheck(context, n.Init)
+		}
 		conditional := Typecheck(context, n.Conditional)
 		if conditional.Kind() != ast.PrimitiveTypeBool {
 			context.Errors = append(context.Errors, TypeError{
@@ -255,15 +621,17 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 		if n.Code != nil {
 			Typecheck(context, n.Code)
 		}
-		if n.Init != nil {
-			Typecheck(context, n.Init)
-		}
 		if n.PostIteration != nil {
 			Typecheck(context, n.PostIteration)
 		}
 		return ast.UnknownType
 
 	case *ast.IfStmt:
+		if n.Init != nil {
+			context.pushScope()
+			defer context.popScope()
+			Typecheck(context, n.Init)
+		}
 		conditional := Typecheck(context, n.Conditional)
 		if conditional.Kind() != ast.PrimitiveTypeBool {
 			context.Errors = append(context.Errors, TypeError{
@@ -275,9 +643,6 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 		if n.Code != nil {
 			Typecheck(context, n.Code)
 		}
-		if n.Init != nil {
-			Typecheck(context, n.Init)
-		}
 		if n.Else != nil {
 			Typecheck(context, n.Else)
 		}
@@ -285,6 +650,38 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 
 	case *ast.NamedSelector:
 		up := Typecheck(context, n.Expr)
+		if pkg, isPackage := up.(ast.PackageType); isPackage {
+			if member, ok := pkg.Members[n.Name]; ok {
+				return member.Type
+			}
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorNotFoundErr,
+				Msg:  "Cannot find " + n.Name + " in " + up.String(),
+			})
+			return ast.UnknownType
+		}
+		if handle, isHandle := up.(ast.HandleType); isHandle {
+			if method, ok := handle.Methods[n.Name]; ok {
+				fnType := method.Type.(ast.FunctionType)
+				fnType.Parameters = fnType.Parameters[1:] //the receiver is bound by the selection
+				return fnType
+			}
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorNotFoundErr,
+				Msg:  "Cannot find method " + n.Name + " of handle type " + handle.Name + " - handles cannot be inspected",
+			})
+			return ast.UnknownType
+		}
+		if up.Kind() == ast.PrimitiveTypeError {
+			if n.Name == "Error" {
+				return ast.FunctionType{ReturnType: ast.PrimitiveTypeString}
+			}
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorNotFoundErr,
+				Msg:  "Cannot find method " + n.Name + " of type error",
+			})
+			return ast.UnknownType
+		}
 		if up.Kind() != ast.ComplexTypeStruct {
 			context.Errors = append(context.Errors, TypeError{
 				Kind: TypeErrorIncompatibleTypesErr,
@@ -292,10 +689,16 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 			})
 			return ast.UnknownType
 		}
-		for _, field := range up.(ast.StructType).Fields {
-			if field.Name() == n.Name {
-				return field.BaseType()
-			}
+		sel := selectMember(up.(ast.StructType), n.Name, nil)
+		if sel.ambiguous {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorAmbiguousSelectorErr,
+				Msg:  "Ambiguous selector " + n.Name + " on type " + up.String(),
+			})
+			return ast.UnknownType
+		}
+		if sel.found {
+			return sel.field.BaseType()
 		}
 		context.Errors = append(context.Errors, TypeError{
 			Kind: TypeErrorNotFoundErr,
@@ -303,6 +706,97 @@ func Typecheck(context *TypecheckContext, node ast.Node) ast.TypeKind {
 		})
 		return ast.UnknownType
 
+	case *ast.GoStmt:
+		if n.Call == nil {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeerrorInternalErr,
+				Msg:  "GoStmt.Call should never be nil",
+			})
+			return ast.UnknownType
+		}
+		Typecheck(context, n.Call)
+		return ast.UnknownType
+
+	case *ast.SendStmt:
+		typecheckSend(context, n.Channel, n.Value)
+		return ast.UnknownType
+
+	case *ast.Receive:
+		t := typecheckReceive(context, n.Channel)
+		if n.WithOk && t != ast.UnknownType {
+			return ast.TupleType{Types: []ast.TypeKind{t, ast.PrimitiveTypeBool}}
+		}
+		return t
+
+	case *ast.BuiltinCall:
+		return typecheckBuiltin(context, n)
+
+	case *ast.RangeStmt:
+		expr := Typecheck(context, n.Expr)
+		var keyType, valueType ast.TypeKind
+		switch expr.Kind() {
+		case ast.ComplexTypeChannel:
+			if n.Value != nil {
+				context.Errors = append(context.Errors, TypeError{
+					Kind: TypeErrorIncompatibleTypesErr,
+					Msg:  "Range over channel permits only one iteration variable",
+				})
+				return ast.UnknownType
+			}
+			if expr.(ast.ChannelType).Dir == ast.ChanSend {
+				context.Errors = append(context.Errors, TypeError{
+					Kind: TypeErrorIncompatibleTypesErr,
+					Msg:  "Cannot range over send-only channel " + expr.String(),
+				})
+				return ast.UnknownType
+			}
+			keyType = expr.BaseType()
+		case ast.ComplexTypeArray, ast.ComplexTypeSlice:
+			keyType = ast.PrimitiveTypeInt
+			valueType = expr.BaseType()
+		case ast.UnknownType:
+		default:
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Cannot range over type " + expr.String(),
+			})
+			return ast.UnknownType
+		}
+		context.pushScope()
+		defer context.popScope()
+		if n.NewLocal {
+			typecheckDeclaredValue(context, n.Key, keyType)
+			typecheckDeclaredValue(context, n.Value, valueType)
+		} else {
+			typecheckAssignedValue(context, n.Key, keyType)
+			typecheckAssignedValue(context, n.Value, valueType)
+		}
+		if n.Code != nil {
+			Typecheck(context, n.Code)
+		}
+		return ast.UnknownType
+
+	case *ast.SelectStmt:
+		for _, c := range n.Cases {
+			context.pushScope()
+			switch {
+			case c.IsDefault:
+			case c.IsSend:
+				typecheckSend(context, c.Channel, c.Value)
+			case c.NewLocal:
+				typecheckDeclaredValue(context, c.Target, typecheckReceive(context, c.Channel))
+				typecheckDeclaredValue(context, c.OkTarget, ast.PrimitiveTypeBool)
+			default:
+				typecheckAssignedValue(context, c.Target, typecheckReceive(context, c.Channel))
+				typecheckAssignedValue(context, c.OkTarget, ast.PrimitiveTypeBool)
+			}
+			if c.Code != nil {
+				Typecheck(context, c.Code)
+			}
+			context.popScope()
+		}
+		return ast.UnknownType
+
 	case nil:
 		context.Errors = append(context.Errors, TypeError{
 			Kind: TypeerrorInternalErr,
@@ -331,3 +825,276 @@ func isEqualityOrLogicalOp(op ast.BinOpType) bool {
 	}
 	return false
 }
+
+// typecheckAssignedValue checks that a value of type t can be stored in variable, which may be nil if unused.
+func typecheckAssignedValue(context *TypecheckContext, variable ast.Node, t ast.TypeKind) {
+	if variable == nil || t == nil || t == ast.UnknownType {
+		return
+	}
+	v := Typecheck(context, variable)
+	if v != ast.UnknownType && !TypeEqual(v, t) {
+		context.Errors = append(context.Errors, TypeError{
+			Kind: TypeErrorIncompatibleTypesErr,
+			Msg:  "Cannot perform assignment to " + v.String() + " with type " + t.String(),
+		})
+	}
+}
+
+// typecheckDeclaredValue declares variable in the current block with type t, if variable is not nil.
+func typecheckDeclaredValue(context *TypecheckContext, variable ast.Node, t ast.TypeKind) {
+	ident, ok := variable.(*ast.VariableReference)
+	if !ok || t == nil {
+		return
+	}
+	typecheckAssignedValue(context, variable, t)
+	if !context.declare(ident.Name, t) {
+		context.Errors = append(context.Errors, TypeError{
+			Kind: TypeErrorRedeclaredErr,
+			Msg:  ident.Name + " redeclared in this block",
+		})
+	}
+}
+
+func typecheckSend(context *TypecheckContext, channel, value ast.Node) {
+	ch := Typecheck(context, channel)
+	v := Typecheck(context, value)
+	if ch == ast.UnknownType {
+		return
+	}
+	if ch.Kind() != ast.ComplexTypeChannel {
+		context.Errors = append(context.Errors, TypeError{
+			Kind: TypeErrorIncompatibleTypesErr,
+			Msg:  "Cannot send on non-channel type " + ch.String(),
+		})
+		return
+	}
+	if ch.(ast.ChannelType).Dir == ast.ChanRecv {
+		context.Errors = append(context.Errors, TypeError{
+			Kind: TypeErrorIncompatibleTypesErr,
+			Msg:  "Cannot send on receive-only channel " + ch.String(),
+		})
+		return
+	}
+	if v != ast.UnknownType && !TypeEqual(v, ch.BaseType()) {
+		context.Errors = append(context.Errors, TypeError{
+			Kind: TypeErrorIncompatibleTypesErr,
+			Msg:  "Cannot send value of type " + v.String() + " on channel of type " + ch.String(),
+		})
+	}
+}
+
+func typecheckReceive(context *TypecheckContext, channel ast.Node) ast.TypeKind {
+	ch := Typecheck(context, channel)
+	if ch == ast.UnknownType {
+		return ast.UnknownType
+	}
+	if ch.Kind() != ast.ComplexTypeChannel {
+		context.Errors = append(context.Errors, TypeError{
+			Kind: TypeErrorIncompatibleTypesErr,
+			Msg:  "Cannot receive from non-channel type " + ch.String(),
+		})
+		return ast.UnknownType
+	}
+	if ch.(ast.ChannelType).Dir == ast.ChanSend {
+		context.Errors = append(context.Errors, TypeError{
+			Kind: TypeErrorIncompatibleTypesErr,
+			Msg:  "Cannot receive from send-only channel " + ch.String(),
+		})
+		return ast.UnknownType
+	}
+	return ch.BaseType()
+}
+
+func typecheckBuiltin(context *TypecheckContext, n *ast.BuiltinCall) ast.TypeKind {
+	switch n.Builtin {
+	case ast.BuiltinMake:
+		if n.Type == nil || n.Type.Kind() != ast.ComplexTypeChannel {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Cannot make value of non-channel type",
+			})
+			return ast.UnknownType
+		}
+		if len(n.Args) > 1 {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "make() of a channel expects at most one size argument",
+			})
+			return ast.UnknownType
+		}
+		for _, arg := range n.Args {
+			if size := Typecheck(context, arg); size != ast.UnknownType && size != ast.PrimitiveTypeInt {
+				context.Errors = append(context.Errors, TypeError{
+					Kind: TypeErrorIncompatibleTypesErr,
+					Msg:  "Cannot make channel with non-integer size of type " + size.String(),
+				})
+			}
+		}
+		return n.Type
+
+	case ast.BuiltinClose:
+		if len(n.Args) != 1 {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "close() expects exactly one argument",
+			})
+			return ast.UnknownType
+		}
+		ch := Typecheck(context, n.Args[0])
+		if ch != ast.UnknownType && ch.Kind() != ast.ComplexTypeChannel {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Cannot close non-channel type " + ch.String(),
+			})
+		} else if ch != ast.UnknownType && ch.(ast.ChannelType).Dir == ast.ChanRecv {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Cannot close receive-only channel " + ch.String(),
+			})
+		}
+		return ast.UnknownType
+
+	case ast.BuiltinLen:
+		if len(n.Args) != 1 {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "len() expects exactly one argument",
+			})
+			return ast.UnknownType
+		}
+		switch t := Typecheck(context, n.Args[0]); t.Kind() {
+		case ast.PrimitiveTypeString, ast.ComplexTypeArray, ast.ComplexTypeSlice:
+		default:
+			if t != ast.UnknownType {
+				context.Errors = append(context.Errors, TypeError{
+					Kind: TypeErrorIncompatibleTypesErr,
+					Msg:  "Cannot take the length of type " + t.String(),
+				})
+			}
+		}
+		return ast.PrimitiveTypeInt
+
+	case ast.BuiltinAppend:
+		if len(n.Args) == 0 {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "append() expects a slice as its first argument",
+			})
+			return ast.UnknownType
+		}
+		s := Typecheck(context, n.Args[0])
+		if s == ast.UnknownType {
+			return s
+		}
+		if s.Kind() != ast.ComplexTypeSlice {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "Cannot append to non-slice type " + s.String(),
+			})
+			return ast.UnknownType
+		}
+		if n.Spread && len(n.Args) != 2 {
+			context.Errors = append(context.Errors, TypeError{
+				Kind: TypeErrorIncompatibleTypesErr,
+				Msg:  "append() with ... expects exactly two arguments",
+			})
+			return s
+		}
+		elemType := s.BaseType()
+		if named, isNamed := s.(ast.NamedType); isNamed {
+			elemType = named.Type.BaseType()
+		}
+		for _, arg := range n.Args[1:] {
+			want, elem := elemType, Typecheck(context, arg)
+			if n.Spread {
+				want = s
+			}
+			if !acceptsArgument(want, elem) {
+				context.Errors = append(context.Errors, TypeError{
+					Kind: TypeErrorIncompatibleTypesErr,
+					Msg:  "Cannot append value of type " + elem.String() + " to slice of type " + s.String(),
+				})
+			}
+		}
+		return s
+	}
+
+	context.Errors = append(context.Errors, TypeError{
+		Kind: TypeerrorInternalErr,
+		Msg:  "Cannot typecheck unknown builtin " + n.Builtin.String(),
+	})
+	return ast.UnknownType
+}
+
+// typecheckValue checks that the value v can be used as a value of type t, returning an error describing the first
+// mismatch found. Values of structs must have exactly the fields of the struct type.
+func typecheckValue(t ast.TypeKind, v *ast.Variant) error {
+	if named, isNamed := t.(ast.NamedType); isNamed {
+		return typecheckValue(named.Type, v)
+	}
+	if t == ast.UnknownType {
+		return nil
+	}
+
+	switch t.Kind() {
+	case ast.PrimitiveTypeInt, ast.PrimitiveTypeString, ast.PrimitiveTypeBool:
+		if v.Type.Kind() != t.Kind() {
+			return errors.New("expected " + t.String() + ", got " + v.Type.String())
+		}
+	case ast.PrimitiveTypeError:
+		if v.Type.Kind() != ast.PrimitiveTypeError && v.Type != ast.PrimitiveTypeUndefined {
+			return errors.New("expected error, got " + v.Type.String())
+		}
+	case ast.ComplexTypeHandle:
+		if v.Type.Kind() != ast.ComplexTypeHandle || v.Type.(ast.HandleType).Name != t.(ast.HandleType).Name {
+			return errors.New("expected " + t.String() + ", got " + v.Type.String())
+		}
+	case ast.ComplexTypeSlice, ast.ComplexTypeArray:
+		if v.Type.Kind() != ast.ComplexTypeSlice && v.Type.Kind() != ast.ComplexTypeArray {
+			return errors.New("expected " + t.String() + ", got " + v.Type.String())
+		}
+		if arr, ok := t.(ast.ArrayType); ok {
+			if l, ok := arr.Len.(*ast.IntegerLiteral); ok && int64(len(v.VectorData)) != l.Val {
+				return fmt.Errorf("expected %s, got %d elements", t, len(v.VectorData))
+			}
+		}
+		for i, elem := range v.VectorData {
+			if err := typecheckValue(t.BaseType(), elem); err != nil {
+				return fmt.Errorf("index %d: %v", i, err)
+			}
+		}
+	case ast.ComplexTypeStruct:
+		if v.Type.Kind() != ast.ComplexTypeStruct {
+			return errors.New("expected " + t.String() + ", got " + v.Type.String())
+		}
+		st := t.(ast.StructType)
+		for _, f := range st.Fields {
+			field, ok := v.NamedData[f.Ident]
+			if !ok {
+				return errors.New("missing field " + f.Ident)
+			}
+			if err := typecheckValue(f.Type, field); err != nil {
+				return fmt.Errorf("field %s: %v", f.Ident, err)
+			}
+		}
+		if len(v.NamedData) > len(st.Fields) {
+			for name := range v.NamedData {
+				if !hasField(st, name) {
+					return errors.New("unknown field " + name)
+				}
+			}
+		}
+	default:
+		return errors.New("cannot pass a value of type " + t.String())
+	}
+	return nil
+}
+
+func hasField(st ast.StructType, name string) bool {
+	for _, f := range st.Fields {
+		if f.Ident == name {
+			return true
+		}
+	}
+	return false
+}
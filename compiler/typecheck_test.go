@@ -1,6 +1,7 @@
 package compiler
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/twitchyliquid64/harsh/ast"
@@ -767,3 +768,383 @@ func TestTypeEqualFuncTypeWithDiffParamsReturnsFalse(t *testing.T) {
 		t.Error("Expected types to not be equal")
 	}
 }
+
+func TestTypecheckSendMismatchedTypeErrors(t *testing.T) {
+	node := &ast.SendStmt{
+		Channel: &ast.BuiltinCall{
+			Builtin: ast.BuiltinMake,
+			Type:    ast.ChannelType{SubType: ast.PrimitiveTypeInt},
+		},
+		Value: &ast.StringLiteral{},
+	}
+	c := &TypecheckContext{}
+	Typecheck(c, node)
+	if len(c.Errors) != 1 {
+		t.Error("Type error expected")
+	}
+}
+
+func TestTypecheckReceiveFromSendOnlyChannelErrors(t *testing.T) {
+	node := &ast.Receive{
+		Channel: &ast.VariableReference{
+			Name: "ch",
+			Type: ast.ChannelType{SubType: ast.PrimitiveTypeInt, Dir: ast.ChanSend},
+		},
+	}
+	c := &TypecheckContext{}
+	ty := Typecheck(c, node)
+	if len(c.Errors) != 1 {
+		t.Error("Type error expected")
+	}
+	if ty != ast.UnknownType {
+		t.Error("Expected unknown type")
+	}
+}
+
+func TestTypecheckReceiveReturnsElementType(t *testing.T) {
+	node := &ast.Receive{
+		Channel: &ast.VariableReference{
+			Name: "ch",
+			Type: ast.ChannelType{SubType: ast.PrimitiveTypeString},
+		},
+	}
+	c := &TypecheckContext{}
+	ty := Typecheck(c, node)
+	if len(c.Errors) != 0 {
+		t.Error("Type errors not expected")
+	}
+	if ty != ast.PrimitiveTypeString {
+		t.Error("Expected string type")
+	}
+}
+
+func TestTypecheckLenAndAppend(t *testing.T) {
+	ints := &ast.VariableReference{Name: "xs", Type: ast.SliceType{SubType: ast.PrimitiveTypeInt}}
+	for _, tc := range []struct {
+		node   *ast.BuiltinCall
+		want   ast.TypeKind
+		errors int
+	}{
+		{&ast.BuiltinCall{Builtin: ast.BuiltinLen, Args: []ast.Node{ints}}, ast.PrimitiveTypeInt, 0},
+		{&ast.BuiltinCall{Builtin: ast.BuiltinLen, Args: []ast.Node{&ast.StringLiteral{Str: "a"}}}, ast.PrimitiveTypeInt, 0},
+		{&ast.BuiltinCall{Builtin: ast.BuiltinLen, Args: []ast.Node{&ast.IntegerLiteral{}}}, ast.PrimitiveTypeInt, 1},
+		{&ast.BuiltinCall{Builtin: ast.BuiltinAppend, Args: []ast.Node{ints, &ast.IntegerLiteral{}}}, ints.Type, 0},
+		{&ast.BuiltinCall{Builtin: ast.BuiltinAppend, Args: []ast.Node{ints, ints}, Spread: true}, ints.Type, 0},
+		{&ast.BuiltinCall{Builtin: ast.BuiltinAppend, Args: []ast.Node{ints, &ast.StringLiteral{Str: "a"}}}, ints.Type, 1},
+		{&ast.BuiltinCall{Builtin: ast.BuiltinAppend, Args: []ast.Node{&ast.IntegerLiteral{}}}, ast.UnknownType, 1},
+	} {
+		c := &TypecheckContext{}
+		if ty := Typecheck(c, tc.node); len(c.Errors) != tc.errors || !TypeEqual(ty, tc.want) {
+			t.Errorf("%s: got type %s with errors %v, want %s with %d errors", tc.node.Builtin, ty, c.Errors, tc.want, tc.errors)
+		}
+	}
+}
+
+func TestTypecheckRedeclarationInBlockErrors(t *testing.T) {
+	node := &ast.StatementList{
+		Stmts: []ast.Node{
+			&ast.Assign{
+				Variable: &ast.VariableReference{Name: "x", Type: ast.PrimitiveTypeInt},
+				Value:    &ast.IntegerLiteral{},
+				NewLocal: true,
+			},
+			&ast.Assign{
+				Variable: &ast.VariableReference{Name: "x", Type: ast.PrimitiveTypeInt},
+				Value:    &ast.IntegerLiteral{},
+				NewLocal: true,
+			},
+		},
+	}
+	c := &TypecheckContext{}
+	Typecheck(c, node)
+	if len(c.Errors) != 1 || c.Errors[0].Kind != TypeErrorRedeclaredErr {
+		t.Error("Expected redeclaration error")
+	}
+}
+
+func TestTypecheckShadowingInNestedBlockResolvesInnerType(t *testing.T) {
+	node := &ast.StatementList{
+		Stmts: []ast.Node{
+			&ast.Assign{
+				Variable: &ast.VariableReference{Name: "x", Type: ast.UnknownType},
+				Value:    &ast.IntegerLiteral{},
+				NewLocal: true,
+			},
+			&ast.StatementList{
+				Stmts: []ast.Node{
+					&ast.Assign{
+						Variable: &ast.VariableReference{Name: "x", Type: ast.UnknownType},
+						Value:    &ast.StringLiteral{},
+						NewLocal: true,
+					},
+					&ast.Assign{
+						Variable: &ast.VariableReference{Name: "x", Type: ast.UnknownType},
+						Value:    &ast.StringLiteral{Str: "abc"},
+					},
+				},
+			},
+			&ast.Assign{
+				Variable: &ast.VariableReference{Name: "x", Type: ast.UnknownType},
+				Value:    &ast.StringLiteral{},
+			},
+		},
+	}
+	c := &TypecheckContext{}
+	Typecheck(c, node)
+	if len(c.Errors) != 1 {
+		t.Error("Expected exactly one error, for assigning a string to the outer int")
+		t.FailNow()
+	}
+	if c.Errors[0].Kind != TypeErrorIncompatibleTypesErr {
+		t.Error("Incorrect error kind")
+	}
+}
+
+func TestTypecheckStructEqualityIsBool(t *testing.T) {
+	structType := ast.StructType{Fields: []ast.NamedType{
+		{Ident: "A", Type: ast.PrimitiveTypeInt},
+		{Ident: "B", Type: ast.ArrayType{SubType: ast.PrimitiveTypeString, Len: &ast.IntegerLiteral{Val: 2}}},
+	}}
+	node := &ast.BinaryOp{
+		Op:  ast.BinOpEquality,
+		LHS: &ast.StructLiteral{Type: structType},
+		RHS: &ast.StructLiteral{Type: structType},
+	}
+	c := &TypecheckContext{}
+	if Typecheck(c, node) != ast.PrimitiveTypeBool {
+		t.Error("Bool type expected")
+	}
+	if len(c.Errors) != 0 {
+		t.Error("No errors expected")
+	}
+}
+
+func TestTypecheckNonComparableEqualityErrors(t *testing.T) {
+	fnType := ast.FunctionType{ReturnType: ast.PrimitiveTypeInt}
+	for _, tk := range []ast.TypeKind{
+		fnType,
+		ast.StructType{Fields: []ast.NamedType{{Ident: "Fn", Type: fnType}}},
+		ast.ArrayType{SubType: fnType, Len: &ast.IntegerLiteral{Val: 1}},
+	} {
+		node := &ast.BinaryOp{
+			Op:  ast.BinOpNotEquality,
+			LHS: &ast.VariableReference{Name: "a", Type: tk},
+			RHS: &ast.VariableReference{Name: "b", Type: tk},
+		}
+		c := &TypecheckContext{}
+		Typecheck(c, node)
+		if len(c.Errors) != 1 {
+			t.Errorf("Type error expected for %s", tk.String())
+			continue
+		}
+		if c.Errors[0].Kind != TypeErrorIncompatibleTypesErr {
+			t.Error("Incompatible types error expected")
+		}
+	}
+}
+
+func TestTypecheckPromotedFieldSelection(t *testing.T) {
+	base := ast.StructType{Name: "Base", Fields: []ast.NamedType{{Ident: "ID", Type: ast.PrimitiveTypeInt}}}
+	derived := ast.StructType{Name: "Derived", Fields: []ast.NamedType{{Ident: "Base", Type: base, Embedded: true}}}
+	node := &ast.NamedSelector{
+		Name: "ID",
+		Expr: &ast.VariableReference{Name: "d", Type: derived},
+	}
+	c := &TypecheckContext{}
+	if Typecheck(c, node) != ast.PrimitiveTypeInt {
+		t.Error("Int type expected")
+	}
+	if len(c.Errors) != 0 {
+		t.Error("No errors expected")
+	}
+}
+
+func TestTypecheckAmbiguousPromotedFieldErrors(t *testing.T) {
+	a := ast.StructType{Name: "A", Fields: []ast.NamedType{{Ident: "ID", Type: ast.PrimitiveTypeInt}}}
+	b := ast.StructType{Name: "B", Fields: []ast.NamedType{{Ident: "ID", Type: ast.PrimitiveTypeString}}}
+	both := ast.StructType{Fields: []ast.NamedType{{Ident: "A", Type: a, Embedded: true}, {Ident: "B", Type: b, Embedded: true}}}
+	node := &ast.NamedSelector{
+		Name: "ID",
+		Expr: &ast.VariableReference{Name: "v", Type: both},
+	}
+	c := &TypecheckContext{}
+	Typecheck(c, node)
+	if len(c.Errors) != 1 {
+		t.Fatal("Type error expected")
+	}
+	if c.Errors[0].Kind != TypeErrorAmbiguousSelectorErr {
+		t.Error("Ambiguous selector error expected")
+	}
+}
+
+func TestTypecheckVariadicCallArity(t *testing.T) {
+	fn := ast.FunctionType{
+		Parameters: []ast.TypeKind{
+			ast.NamedType{Ident: "s", Type: ast.PrimitiveTypeString},
+			ast.NamedType{Ident: "xs", Type: ast.SliceType{SubType: ast.PrimitiveTypeInt}},
+		},
+		ReturnType: ast.PrimitiveTypeInt,
+		Variadic:   true,
+	}
+	tcs := []struct {
+		args   []ast.Node
+		spread bool
+		errors int
+	}{
+		{args: []ast.Node{&ast.StringLiteral{}}},
+		{args: []ast.Node{&ast.StringLiteral{}, &ast.IntegerLiteral{}, &ast.IntegerLiteral{}}},
+		{args: []ast.Node{&ast.StringLiteral{}, &ast.SliceLiteral{Type: ast.SliceType{SubType: ast.PrimitiveTypeInt}}}, spread: true},
+		{args: []ast.Node{}, errors: 1},
+		{args: []ast.Node{&ast.StringLiteral{}, &ast.StringLiteral{}}, errors: 1},
+		{args: []ast.Node{&ast.StringLiteral{}, &ast.IntegerLiteral{}}, spread: true, errors: 1},
+	}
+	for i, tc := range tcs {
+		c := &TypecheckContext{}
+		Typecheck(c, &ast.FunctionCall{
+			Function: &ast.VariableReference{Name: "f", Type: fn},
+			Args:     tc.args,
+			Spread:   tc.spread,
+		})
+		if len(c.Errors) != tc.errors {
+			t.Errorf("Case %d: expected %d errors, got %d", i, tc.errors, len(c.Errors))
+		}
+	}
+}
+
+func TestTypecheckSpreadToNonVariadicErrors(t *testing.T) {
+	fn := ast.FunctionType{
+		Parameters: []ast.TypeKind{ast.NamedType{Ident: "xs", Type: ast.SliceType{SubType: ast.PrimitiveTypeInt}}},
+		ReturnType: ast.PrimitiveTypeInt,
+	}
+	c := &TypecheckContext{}
+	Typecheck(c, &ast.FunctionCall{
+		Function: &ast.VariableReference{Name: "f", Type: fn},
+		Args:     []ast.Node{&ast.SliceLiteral{Type: ast.SliceType{SubType: ast.PrimitiveTypeInt}}},
+		Spread:   true,
+	})
+	if len(c.Errors) != 1 {
+		t.Error("Type error expected")
+	}
+}
+
+func TestTypecheckStandardLibraryCalls(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import (
+		"sort"
+		"strings"
+	)
+
+	func noop() {
+	}
+
+	func Test() {
+		strings.ToUpper(1)
+		strings.Join([]int{1}, ",")
+		sort.Slice([]int{2, 1}, noop)
+		sort.Slice([]string{"b", "a"}, strings.ToUpper)
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	tc := &TypecheckContext{}
+	Typecheck(tc, c.Globals["Test"].Type.(ast.FunctionType).Code)
+	if len(tc.Errors) != 4 {
+		t.Errorf("Expected 4 errors, got %d: %v", len(tc.Errors), tc.Errors)
+	}
+
+	c, err = ParseLiteral("test.go", `
+	package test
+
+	import "sort"
+
+	func less(i int, j int) bool {
+		return i != j
+	}
+
+	func Test() {
+		sort.Slice([]string{"b", "a"}, less)
+		sort.Strings([]string{"b", "a"})
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc = &TypecheckContext{}
+	Typecheck(tc, c.Globals["Test"].Type.(ast.FunctionType).Code)
+	if len(tc.Errors) != 0 {
+		t.Error("Expected no errors, got ", tc.Errors)
+	}
+}
+
+func TestTypecheckErrorsAndMultipleResults(t *testing.T) {
+	c, err := ParseLiteral("test.go", `
+	package test
+
+	import "errors"
+
+	func pair() (int, error) {
+		return 1, nil
+	}
+
+	func Test() {
+		n := 1
+		if n == nil {
+		}
+		a, b, c := pair()
+		x := pair()
+		err := errors.New("a")
+		err.Message()
+		s, e := pair()
+		s = "a"
+		if e != nil {
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &TypecheckContext{}
+	Typecheck(tc, c.Globals["Test"].Type.(ast.FunctionType).Code)
+	for _, expected := range []string{
+		"Cannot compare type int with nil",
+		"Assignment mismatch: 3 variables but value has type (int, error)",
+		"Multiple-value (int, error) in single-value context",
+		"Cannot find method Message of type error",
+		"Cannot perform assignment to int with type string",
+	} {
+		found := false
+		for _, e := range tc.Errors {
+			found = found || e.Msg == expected
+		}
+		if !found {
+			t.Errorf("Expected error %q, got %v", expected, tc.Errors)
+		}
+	}
+}
+
+func TestTypeErrorsHavePositions(t *testing.T) {
+	c, err := ParseLiteral("test.go", `package test
+
+func Test() int {
+	x := 1
+	return x + "a"
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &TypecheckContext{ReturnType: ast.PrimitiveTypeInt}
+	Typecheck(tc, c.Globals["Test"].Type.(ast.FunctionType).Code)
+	if len(tc.Errors) == 0 {
+		t.Fatal("Expected type errors")
+	}
+	if got := tc.Errors[0].Error(); !strings.HasPrefix(got, "test.go:5:9: ") {
+		t.Errorf("Expected an error at test.go:5:9, got %q", got)
+	}
+}
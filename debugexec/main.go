@@ -12,12 +12,18 @@ import (
 
 func main() {
 	if len(os.Args) < 3 {
-		fmt.Println("USAGE: ./debugexec <harsh file> <function name> [<parameter-name>=<parameter-value>...]")
+		fmt.Println("USAGE: ./debugexec <harsh file or package directory> <function name> [<parameter-name>=<parameter-value>...]")
 		return
 	}
 
-	// Parse & translate the file
-	_, context, err := compiler.ParseFile(os.Args[1])
+	// Parse & translate the file or package
+	var context *compiler.Context
+	var err error
+	if info, statErr := os.Stat(os.Args[1]); statErr == nil && info.IsDir() {
+		context, err = compiler.ParseDir(os.Args[1])
+	} else {
+		_, context, err = compiler.ParseFile(os.Args[1])
+	}
 	if err != nil {
 		fmt.Println("Error: ", err)
 		return
@@ -26,13 +32,14 @@ func main() {
 		fmt.Println("Parse Errors:")
 		for i, err := range context.Errors {
 			fmt.Printf("%02d: %s (%s)\r\n", i+1, err.Text, err.Pos.String())
+			fmt.Print(compiler.Excerpt(err.Pos))
 		}
 		return
 	}
 
 	// Type check all the functional declarations
 	wereTypeErrors := false
-	for _, f := range context.Declarations {
+	for _, f := range context.AllDeclarations() {
 		if _, ok := f.Type.(ast.FunctionType); !ok {
 			continue
 		}
@@ -43,7 +50,8 @@ func main() {
 		if len(c.Errors) > 0 {
 			fmt.Println("Type errors in " + f.Ident + ":")
 			for i, e := range c.Errors {
-				fmt.Printf("%02d: %s (%d)\r\n", i+1, e.Msg, e.Kind)
+				fmt.Printf("%02d: %s (%d)\r\n", i+1, e.Error(), e.Kind)
+				fmt.Print(compiler.Excerpt(e.Pos))
 			}
 			wereTypeErrors = true
 		}
@@ -54,7 +62,7 @@ func main() {
 
 	//Find the function we will execute - so we can match input parameters
 	var funcDecl ast.NamedType
-	for _, f := range context.Declarations {
+	for _, f := range context.AllDeclarations() {
 		if _, ok := f.Type.(ast.FunctionType); ok && f.Ident == os.Args[2] {
 			funcDecl = f
 			break
@@ -98,7 +106,11 @@ func main() {
 		if errs, ok := err.(compiler.ExecutionError); ok {
 			for i, err := range errs.Errors {
 				fmt.Printf("%02d: %s (%d)\r\n", i+1, err.Error(), err.Class)
-				err.CreatingNode.Print(4, &ast.PrintContext{Output: os.Stdout, Color: true})
+				fmt.Print(compiler.Excerpt(err.Position()))
+				if err.CreatingNode != nil {
+					err.CreatingNode.Print(4, &ast.PrintContext{Output: os.Stdout, Color: true})
+				}
+				fmt.Print(err.StackTrace())
 			}
 		}
 	} else {
@@ -6,24 +6,48 @@ import (
 	"go/parser"
 	"go/token"
 	"os"
+	"strings"
 
 	myast "github.com/twitchyliquid64/harsh/ast"
 	"github.com/twitchyliquid64/harsh/compiler"
+	"github.com/twitchyliquid64/harsh/opt"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("USAGE: ./debugprint <harsh file>")
+		fmt.Println("USAGE: ./debugprint <harsh file or package directory> [--dce[=<entry points>]] [--goast]")
+		fmt.Println("  --dce removes dead code, and unused functions if the comma-separated functions called by the host are given")
 		return
 	}
 
-	_, context, err := compiler.ParseFile(os.Args[1])
+	var context *compiler.Context
+	var err error
+	if info, statErr := os.Stat(os.Args[1]); statErr == nil && info.IsDir() {
+		context, err = compiler.ParseDir(os.Args[1])
+	} else {
+		_, context, err = compiler.ParseFile(os.Args[1])
+	}
 	if err != nil {
 		fmt.Println("Error: ", err)
 		return
 	}
 
-	for _, decl := range context.Declarations {
+	if entryPoints, ok := flagValue("--dce"); ok {
+		var names []string
+		if entryPoints != "" {
+			names = strings.Split(entryPoints, ",")
+		}
+		removed := opt.EliminateContext(context, names...)
+		if len(removed) > 0 {
+			fmt.Println("Removed dead code:")
+			for i, r := range removed {
+				fmt.Printf("%02d: %s (%s)\r\n", i+1, r.Text, r.Pos.String())
+				fmt.Print(compiler.Excerpt(r.Pos))
+			}
+		}
+	}
+
+	for _, decl := range context.AllDeclarations() {
 		if fType, ok := decl.Type.(myast.FunctionType); ok {
 			fmt.Println("FUNCTION: ", decl.String())
 			if fType.Code != nil {
@@ -37,7 +61,8 @@ func main() {
 			if len(c.Errors) > 0 {
 				fmt.Println("  Type errors:")
 				for i, e := range c.Errors {
-					fmt.Printf("   %02d: %s (%d)\r\n", i+1, e.Msg, e.Kind)
+					fmt.Printf("   %02d: %s (%d)\r\n", i+1, e.Error(), e.Kind)
+					fmt.Print(compiler.Excerpt(e.Pos))
 				}
 			}
 		} else {
@@ -49,10 +74,11 @@ func main() {
 		fmt.Println("Translate Errors:")
 		for i, err := range context.Errors {
 			fmt.Printf("%02d: %s (%s)\r\n", i+1, err.Text, err.Pos.String())
+			fmt.Print(compiler.Excerpt(err.Pos))
 		}
 	}
 
-	if len(os.Args) > 2 && os.Args[2] == "--goast" {
+	if hasFlag("--goast") {
 		fset := token.NewFileSet() // positions are relative to fset
 		f, err := parser.ParseFile(fset, os.Args[1], nil, 0)
 		if err != nil {
@@ -61,3 +87,21 @@ func main() {
 		ast.Print(fset, f)
 	}
 }
+
+func hasFlag(flag string) bool {
+	_, ok := flagValue(flag)
+	return ok
+}
+
+// flagValue returns the value of a flag given as flag=value, or an empty value if it is given without one.
+func flagValue(flag string) (string, bool) {
+	for _, arg := range os.Args[2:] {
+		if arg == flag {
+			return "", true
+		}
+		if strings.HasPrefix(arg, flag+"=") {
+			return strings.TrimPrefix(arg, flag+"="), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,445 @@
+package opt
+
+import (
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/twitchyliquid64/harsh/ast"
+	"github.com/twitchyliquid64/harsh/compiler"
+)
+
+// RemovalKind encapsulates the kinds of dead code removed by EliminateDeadCode().
+type RemovalKind int
+
+// Represents the possible kinds of dead code.
+const (
+	UnusedAssignment RemovalKind = iota // an assignment to a local variable which is never read
+	UnreachableCode                     // code after a return, or in a branch which is never taken
+	UnusedFunction                      // a function without side effects, which cannot be reached from an entry point
+)
+
+// Removal describes dead code which was removed, so it can be reported as a lint.
+type Removal struct {
+	Kind RemovalKind
+	Pos  token.Position
+	Text string
+}
+
+func (r Removal) String() string {
+	if r.Pos.IsValid() {
+		return r.Pos.String() + ": " + r.Text
+	}
+	return r.Text
+}
+
+// EliminateDeadCode removes dead code from the code of fn, returning what was removed. Assignments to local variables
+// which are never read are removed, though their values are still evaluated unless doing so has no effect. Code after
+// a return, and branches which are never taken as their condition is a literal, are removed. The code is rewritten in
+// place, and behaves as it did before.
+func EliminateDeadCode(fn ast.FunctionType) []Removal {
+	body, ok := fn.Code.(*ast.StatementList)
+	if !ok {
+		return nil
+	}
+	e := &eliminator{}
+	rewrite(body, e.unreachable)
+	for {
+		unread := e.unreadLocals(fn, body)
+		if len(unread) == 0 {
+			break
+		}
+		rewrite(body, func(n ast.Node) ast.Node { return e.unusedAssignment(n, unread) })
+	}
+	return e.removed
+}
+
+// EliminateContext removes dead code from every function declared by c and its child contexts, returning what was
+// removed. The host can call any declared function with CallFunc(), so unused functions are only removed if the host
+// gives the names of the functions it calls as entryPoints. Functions without side effects are then removed if they
+// cannot be reached from an entry point, or from a function which is kept: exported functions and methods, which may
+// be called by other packages, functions named main or init, and functions with side effects.
+func EliminateContext(c *compiler.Context, entryPoints ...string) []Removal {
+	var removed []Removal
+	functions := map[string]ast.FunctionType{}
+	for _, decl := range c.AllDeclarations() {
+		if fn, ok := decl.Type.(ast.FunctionType); ok {
+			removed = append(removed, EliminateDeadCode(fn)...)
+			if fn.Code != nil {
+				functions[decl.Ident] = fn
+			}
+		}
+	}
+	if len(entryPoints) == 0 {
+		return removed
+	}
+
+	reachable := map[string]bool{}
+	var reach func(name string)
+	reach = func(name string) {
+		fn, ok := functions[name]
+		if !ok || reachable[name] {
+			return
+		}
+		reachable[name] = true
+		rewrite(fn.Code, func(n ast.Node) ast.Node {
+			if ref, ok := n.(*ast.VariableReference); ok && ref.Storage != ast.StorageLocal {
+				reach(ref.Name)
+			}
+			return n
+		})
+	}
+	for _, name := range entryPoints {
+		reach(name)
+	}
+	pure := pureFunctions(functions)
+	for name := range functions {
+		if !removable(name) || !pure[name] {
+			reach(name)
+		}
+	}
+
+	unused := map[string]bool{}
+	for name := range functions {
+		if !reachable[name] {
+			unused[name] = true
+		}
+	}
+	if len(unused) == 0 {
+		return removed
+	}
+	return append(removed, removeDeclarations(c, unused)...)
+}
+
+// removable returns true if the named function is not kept regardless of whether it is reachable, as it may be called
+// by another package or the runtime.
+func removable(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return !unicode.IsUpper(r) && !strings.Contains(name, ".") && name != "main" && name != "init"
+}
+
+// removeDeclarations removes the named functions from the declarations of c and its child contexts.
+func removeDeclarations(c *compiler.Context, names map[string]bool) []Removal {
+	var removed []Removal
+	decls := c.Declarations[:0]
+	for _, decl := range c.Declarations {
+		if !names[decl.Ident] {
+			decls = append(decls, decl)
+			continue
+		}
+		delete(c.Globals, decl.Ident)
+		removed = append(removed, Removal{
+			Kind: UnusedFunction,
+			Pos:  decl.Type.(ast.FunctionType).Code.Position(),
+			Text: "Function " + decl.Ident + " is never used",
+		})
+	}
+	c.Declarations = decls
+	for _, child := range c.ChildContexts {
+		removed = append(removed, removeDeclarations(child, names)...)
+	}
+	return removed
+}
+
+// eliminator records the dead code removed from a function.
+type eliminator struct {
+	removed []Removal
+}
+
+func (e *eliminator) remove(kind RemovalKind, n ast.Node, text string) {
+	e.removed = append(e.removed, Removal{Kind: kind, Pos: n.Position(), Text: text})
+}
+
+// unreachable removes statements after a statement which always returns, branches of if statements which are never
+// taken, and the bodies of loops which never iterate.
+func (e *eliminator) unreachable(n ast.Node) ast.Node {
+	switch n := n.(type) {
+	case *ast.StatementList:
+		for i, stmt := range n.Stmts {
+			if returns(stmt) && i+1 < len(n.Stmts) {
+				e.remove(UnreachableCode, n.Stmts[i+1], "Unreachable code")
+				n.Stmts = n.Stmts[:i+1]
+				break
+			}
+		}
+	case *ast.IfStmt:
+		if !isLiteral(n.Conditional) {
+			return n
+		}
+		untaken := n.Code
+		if b, ok := n.Conditional.(*ast.BoolLiteral); ok && b.Val {
+			untaken = n.Else
+		}
+		if !isEmpty(untaken) {
+			e.remove(UnreachableCode, untaken, "Unreachable code: the branch is never taken")
+		}
+		return optimizeIf(n)
+	case *ast.ForStmt:
+		if b, ok := n.Conditional.(*ast.BoolLiteral); !ok || b.Val {
+			return n
+		}
+		if !isEmpty(n.Code) {
+			e.remove(UnreachableCode, n.Code, "Unreachable code: the loop never iterates")
+		}
+		if n.Init == nil {
+			return &ast.StatementList{Span: n.Span, NoScope: true}
+		}
+		return &ast.StatementList{Span: n.Span, Stmts: []ast.Node{n.Init}} // the init statement is still executed
+	}
+	return n
+}
+
+// isEmpty returns true if n is nil or a statement list without statements.
+func isEmpty(n ast.Node) bool {
+	list, ok := n.(*ast.StatementList)
+	return n == nil || (ok && len(list.Stmts) == 0)
+}
+
+// local is a variable declared by a function, or one of its parameters.
+type local struct {
+	name string
+	read bool
+}
+
+// unreadLocals returns the assignments to local variables of fn which are never read, keyed by the node which each
+// assigns to.
+func (e *eliminator) unreadLocals(fn ast.FunctionType, body *ast.StatementList) map[ast.Node]*local {
+	s := &scopes{targets: map[ast.Node]*local{}}
+	s.push()
+	for _, param := range fn.Parameters {
+		if nt, named := param.(ast.NamedType); named {
+			s.declare(nt.Ident)
+		}
+	}
+	for _, stmt := range body.Stmts { // the body of a function shares the scope of its parameters
+		s.node(stmt)
+	}
+
+	unread := map[ast.Node]*local{}
+	for target, l := range s.targets {
+		if !l.read {
+			unread[target] = l
+		}
+	}
+	return unread
+}
+
+// unusedAssignment removes the assignment n if it assigns a variable which is never read. The value assigned is kept
+// as a statement if evaluating it may have an effect.
+func (e *eliminator) unusedAssignment(n ast.Node, unread map[ast.Node]*local) ast.Node {
+	switch n := n.(type) {
+	case *ast.Assign:
+		l, ok := unread[n.Variable]
+		if !ok {
+			return n
+		}
+		e.remove(UnusedAssignment, n, l.name+" is assigned but never read")
+		if pure(n.Value) {
+			return &ast.StatementList{Span: n.Span, NoScope: true}
+		}
+		return n.Value
+	case *ast.MultiAssign:
+		for i, variable := range n.Variables {
+			if l, ok := unread[variable]; ok {
+				e.remove(UnusedAssignment, variable, l.name+" is assigned but never read")
+				n.Variables[i] = nil // the value is discarded
+			}
+		}
+	case *ast.RangeStmt:
+		if l, ok := unread[n.Key]; ok {
+			e.remove(UnusedAssignment, n.Key, l.name+" is assigned but never read")
+			n.Key = nil
+		}
+		if l, ok := unread[n.Value]; ok {
+			e.remove(UnusedAssignment, n.Value, l.name+" is assigned but never read")
+			n.Value = nil
+		}
+	case *ast.SelectStmt:
+		for i := range n.Cases {
+			c := &n.Cases[i]
+			if l, ok := unread[c.Target]; ok {
+				e.remove(UnusedAssignment, c.Target, l.name+" is assigned but never read")
+				c.Target = nil
+			}
+			if l, ok := unread[c.OkTarget]; ok {
+				e.remove(UnusedAssignment, c.OkTarget, l.name+" is assigned but never read")
+				c.OkTarget = nil
+			}
+		}
+	case *ast.StatementList:
+		return optimizeList(n) // drops the assignments which were removed
+	}
+	return n
+}
+
+// pure returns true if evaluating n has no effect, and cannot raise an error.
+func pure(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BoolLiteral, *ast.NilLiteral, *ast.VariableReference:
+		return true
+	}
+	return isInt(n) || isBool(n)
+}
+
+// scopes tracks the local variables in scope while walking the code of a function, in the same way as variables are
+// resolved by ast.Resolve(). Variables which are read are marked, and the variable assigned by each assignment is
+// recorded in targets.
+type scopes struct {
+	stack   []map[string]*local
+	targets map[ast.Node]*local
+}
+
+func (s *scopes) push() {
+	s.stack = append(s.stack, map[string]*local{})
+}
+
+func (s *scopes) pop() {
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+func (s *scopes) declare(name string) *local {
+	l := &local{name: name}
+	s.stack[len(s.stack)-1][name] = l
+	return l
+}
+
+// lookup returns the innermost local variable with the given name, or nil if the name refers to a global.
+func (s *scopes) lookup(name string) *local {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if l, ok := s.stack[i][name]; ok {
+			return l
+		}
+	}
+	return nil
+}
+
+// target records the variable assigned by an assignment to n, which declares it if newLocal is set.
+func (s *scopes) target(n ast.Node, newLocal bool) {
+	ref, ok := n.(*ast.VariableReference)
+	if !ok {
+		s.node(n) // assigning to an element or field reads the variable holding it
+		return
+	}
+	if newLocal {
+		s.targets[n] = s.declare(ref.Name)
+	} else if l := s.lookup(ref.Name); l != nil {
+		s.targets[n] = l
+	}
+}
+
+func (s *scopes) node(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.StatementList:
+		if !n.NoScope {
+			s.push()
+			defer s.pop()
+		}
+		s.nodes(n.Stmts)
+	case *ast.Assign:
+		s.node(n.Value)
+		s.target(n.Variable, n.NewLocal)
+	case *ast.MultiAssign:
+		s.node(n.Value)
+		for i, variable := range n.Variables {
+			s.target(variable, n.NewLocal[i])
+		}
+	case *ast.IfStmt:
+		if n.Init != nil {
+			s.push()
+			defer s.pop()
+			s.node(n.Init)
+		}
+		s.nodes([]ast.Node{n.Conditional, n.Code, n.Else})
+	case *ast.ForStmt:
+		if n.Init != nil {
+			s.push()
+			defer s.pop()
+			s.node(n.Init)
+		}
+		s.nodes([]ast.Node{n.Conditional, n.Code, n.PostIteration})
+	case *ast.RangeStmt:
+		s.node(n.Expr)
+		if n.NewLocal {
+			s.push()
+			defer s.pop()
+		}
+		s.target(n.Key, n.NewLocal)
+		s.target(n.Value, n.NewLocal)
+		s.node(n.Code)
+	case *ast.SelectStmt:
+		for _, c := range n.Cases {
+			s.nodes([]ast.Node{c.Channel, c.Value})
+		}
+		for _, c := range n.Cases {
+			s.push()
+			s.target(c.Target, c.NewLocal)
+			s.target(c.OkTarget, c.NewLocal)
+			s.node(c.Code)
+			s.pop()
+		}
+	default: // other nodes do not declare variables, or contain nodes which do
+		rewrite(n, func(n ast.Node) ast.Node {
+			if ref, ok := n.(*ast.VariableReference); ok {
+				if l := s.lookup(ref.Name); l != nil {
+					l.read = true
+				}
+			}
+			return n
+		})
+	}
+}
+
+func (s *scopes) nodes(nodes []ast.Node) {
+	for _, n := range nodes {
+		s.node(n)
+	}
+}
+
+// pureFunctions returns the set of functions which have no side effects. They may only assign their local variables,
+// and call other functions which have no side effects.
+func pureFunctions(functions map[string]ast.FunctionType) map[string]bool {
+	pure := map[string]bool{}
+	for name, fn := range functions {
+		if body, ok := fn.Code.(*ast.StatementList); ok && body.Layout != nil { // the variables of unresolved code may be global
+			pure[name] = true
+		}
+	}
+	for changed := true; changed; { // functions are pure until they are found to call an impure function
+		changed = false
+		for name, isPure := range pure {
+			if isPure && !pureCode(functions[name].Code, pure) {
+				pure[name] = false
+				changed = true
+			}
+		}
+	}
+	return pure
+}
+
+// pureCode returns true if executing code has no side effects, given the set of functions which have none.
+func pureCode(code ast.Node, pure map[string]bool) bool {
+	result := true
+	rewrite(code, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.Assign:
+			result = result && isLocal(n.Variable)
+		case *ast.MultiAssign:
+			for _, variable := range n.Variables {
+				result = result && (variable == nil || isLocal(variable))
+			}
+		case *ast.FunctionCall:
+			ref, ok := n.Function.(*ast.VariableReference)
+			result = result && ok && ref.Storage == ast.StorageGlobal && pure[ref.Name]
+		case *ast.GoStmt, *ast.SendStmt, *ast.Receive, *ast.RangeStmt, *ast.SelectStmt, *ast.BuiltinCall:
+			result = false
+		}
+		return n
+	})
+	return result
+}
+
+func isLocal(n ast.Node) bool {
+	ref, ok := n.(*ast.VariableReference)
+	return ok && ref.Storage == ast.StorageLocal
+}
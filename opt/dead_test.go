@@ -0,0 +1,144 @@
+package opt
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/twitchyliquid64/harsh/ast"
+	"github.com/twitchyliquid64/harsh/compiler"
+)
+
+const deadProgram = `package test
+
+var counter int
+
+func helper(x int) int {
+	return x * 2
+}
+
+func unusedCaller() int {
+	return helper(2)
+}
+
+func bump() {
+	counter = counter + 1
+}
+
+func sideEffect() int {
+	bump()
+	return counter
+}
+
+func Unused() int {
+	return 1
+}
+
+func ping(n int) int {
+	return pong(n)
+}
+
+func pong(n int) int {
+	return ping(n)
+}
+
+func entry() int {
+	return 2
+}
+
+func Test(a int) int {
+	unused := a * 3
+	chained := unused + 1
+	b := sideEffect()
+	for i, v := range [2]int{1, 2} {
+		a = a + v
+	}
+	if false {
+		counter = 100
+	}
+	for false {
+		counter = 200
+	}
+	return a + 1
+	counter = 300
+}
+`
+
+func TestEliminateContext(t *testing.T) {
+	parse := func() *compiler.Context {
+		c, err := compiler.ParseLiteral("test.go", deadProgram)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Errors) > 0 {
+			t.Fatal(c.Errors)
+		}
+		return c
+	}
+	original, c := parse(), parse()
+
+	// without entry points, any function may be called by the host.
+	for _, r := range EliminateContext(parse()) {
+		if r.Kind == UnusedFunction {
+			t.Errorf("Expected functions to be kept without entry points, got %q", r)
+		}
+	}
+
+	removed := EliminateContext(c, "Test", "entry")
+	var texts []string
+	for _, r := range removed {
+		texts = append(texts, r.Text)
+	}
+	sort.Strings(texts)
+	want := []string{
+		"Function helper is never used",
+		"Function ping is never used",
+		"Function pong is never used",
+		"Function unusedCaller is never used",
+		"Unreachable code",
+		"Unreachable code: the branch is never taken",
+		"Unreachable code: the loop never iterates",
+		"b is assigned but never read",
+		"chained is assigned but never read",
+		"i is assigned but never read",
+		"unused is assigned but never read",
+	}
+	if len(texts) != len(want) {
+		t.Fatalf("Got removals %q, want %q", texts, want)
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Errorf("Got removal %q, want %q", texts[i], want[i])
+		}
+	}
+	for _, r := range removed {
+		if r.Text == "unused is assigned but never read" && r.String() != "test.go:39:2: unused is assigned but never read" {
+			t.Errorf("Unexpected report %q", r)
+		}
+	}
+
+	var names []string
+	for _, decl := range c.AllDeclarations() {
+		names = append(names, decl.Ident)
+	}
+	if len(names) != 6 || c.Globals["helper"] != nil || c.Globals["unusedCaller"] != nil || c.Globals["entry"] == nil {
+		t.Errorf("Expected only the unused functions without side effects to be removed, got %v", names)
+	}
+
+	// the value of an unread assignment is still evaluated if it has an effect.
+	for _, ctx := range []*compiler.Context{original, c} {
+		v, err := ctx.CallFunc("Test", map[string]interface{}{"a": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Int != 5 || ctx.Globals["counter"].Int != 1 {
+			t.Errorf("Expected 5 with counter 1, got %d with counter %d", v.Int, ctx.Globals["counter"].Int)
+		}
+	}
+	stmts := c.Globals["Test"].Type.(ast.FunctionType).Code.(*ast.StatementList).Stmts
+	if len(stmts) != 3 {
+		t.Errorf("Expected 3 statements to remain, got %d", len(stmts))
+	}
+	if _, ok := stmts[0].(*ast.FunctionCall); !ok {
+		t.Errorf("Expected the unread call to be kept as a statement, got %T", stmts[0])
+	}
+}
@@ -0,0 +1,259 @@
+// Package opt rewrites AST graphs into simpler graphs with the same behaviour, before they are executed or compiled.
+// Operations on literals are folded into literals, redundant operations are removed, and code which cannot be reached
+// is dropped. A rewritten graph produces the same results and errors as the original, though it evaluates fewer steps.
+package opt
+
+import "github.com/twitchyliquid64/harsh/ast"
+
+// Optimize returns the optimized form of n. The graph is rewritten in place, so n should not be used afterwards unless
+// it is returned. Statement lists are never replaced, so the code of a function remains its body.
+func Optimize(n ast.Node) ast.Node {
+	return rewrite(n, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.StatementList:
+			return optimizeList(n)
+		case *ast.BinaryOp:
+			return optimizeBinary(n)
+		case *ast.UnaryOp:
+			return optimizeUnary(n)
+		case *ast.IfStmt:
+			return optimizeIf(n)
+		}
+		return n
+	})
+}
+
+// rewrite replaces each node of the graph rooted at n with the result of f, from the leaves up. Nil nodes are left
+// nil, and statement lists must be replaced by statement lists.
+func rewrite(n ast.Node, f func(ast.Node) ast.Node) ast.Node {
+	switch n := n.(type) {
+	case nil:
+		return nil
+	case *ast.StatementList:
+		rewriteAll(n.Stmts, f)
+	case *ast.ArrayLiteral:
+		rewriteAll(n.Literal, f)
+	case *ast.SliceLiteral:
+		rewriteAll(n.Literal, f)
+	case *ast.StructLiteral:
+		for name, v := range n.Values {
+			n.Values[name] = rewrite(v, f)
+		}
+	case *ast.TupleLiteral:
+		rewriteAll(n.Values, f)
+	case *ast.ReturnStmt:
+		n.Expr = rewrite(n.Expr, f)
+	case *ast.NamedSelector:
+		n.Expr = rewrite(n.Expr, f)
+	case *ast.BinaryOp:
+		n.LHS, n.RHS = rewrite(n.LHS, f), rewrite(n.RHS, f)
+	case *ast.UnaryOp:
+		n.Expr = rewrite(n.Expr, f)
+	case *ast.Subscript:
+		n.Expr, n.Subscript = rewrite(n.Expr, f), rewrite(n.Subscript, f)
+	case *ast.Assign:
+		n.Variable, n.Value = rewrite(n.Variable, f), rewrite(n.Value, f)
+	case *ast.MultiAssign:
+		n.Value = rewrite(n.Value, f)
+		rewriteAll(n.Variables, f)
+	case *ast.IfStmt:
+		n.Init, n.Conditional = rewrite(n.Init, f), rewrite(n.Conditional, f)
+		n.Code, n.Else = rewrite(n.Code, f), rewrite(n.Else, f)
+	case *ast.ForStmt:
+		n.Init, n.Conditional = rewrite(n.Init, f), rewrite(n.Conditional, f)
+		n.Code, n.PostIteration = rewrite(n.Code, f), rewrite(n.PostIteration, f)
+	case *ast.FunctionCall:
+		n.Function = rewrite(n.Function, f)
+		rewriteAll(n.Args, f)
+	case *ast.GoStmt:
+		rewrite(n.Call, f) // calls are never replaced
+	case *ast.SendStmt:
+		n.Channel, n.Value = rewrite(n.Channel, f), rewrite(n.Value, f)
+	case *ast.Receive:
+		n.Channel = rewrite(n.Channel, f)
+	case *ast.RangeStmt:
+		n.Key, n.Value = rewrite(n.Key, f), rewrite(n.Value, f)
+		n.Expr, n.Code = rewrite(n.Expr, f), rewrite(n.Code, f)
+	case *ast.SelectStmt:
+		for i := range n.Cases {
+			c := &n.Cases[i]
+			c.Channel, c.Value = rewrite(c.Channel, f), rewrite(c.Value, f)
+			c.Target, c.OkTarget = rewrite(c.Target, f), rewrite(c.OkTarget, f)
+			c.Code = rewrite(c.Code, f)
+		}
+	case *ast.BuiltinCall:
+		rewriteAll(n.Args, f)
+	}
+	return f(n)
+}
+
+func rewriteAll(nodes []ast.Node, f func(ast.Node) ast.Node) {
+	for i, n := range nodes {
+		nodes[i] = rewrite(n, f)
+	}
+}
+
+// optimizeList drops empty statement lists from n, along with any statements after a statement which always returns.
+func optimizeList(n *ast.StatementList) *ast.StatementList {
+	stmts := n.Stmts[:0]
+	for _, stmt := range n.Stmts {
+		if list, ok := stmt.(*ast.StatementList); ok && len(list.Stmts) == 0 {
+			continue
+		}
+		stmts = append(stmts, stmt)
+		if returns(stmt) {
+			break
+		}
+	}
+	n.Stmts = stmts
+	return n
+}
+
+// returns is true if executing n always returns from the function. Unreachable statements have been dropped from
+// statement lists, so only their final statement may return.
+func returns(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.StatementList:
+		return len(n.Stmts) > 0 && returns(n.Stmts[len(n.Stmts)-1])
+	case *ast.IfStmt:
+		return n.Else != nil && returns(n.Code) && returns(n.Else)
+	}
+	return false
+}
+
+// optimizeBinary folds an operation on literals into a literal, and removes additions of zero and multiplications by
+// one where the other operand is known to be an int.
+func optimizeBinary(n *ast.BinaryOp) ast.Node {
+	if isLiteral(n.LHS) && isLiteral(n.RHS) {
+		if lit := fold(n, func(context *ast.ExecContext) *ast.Variant {
+			return n.Apply(context, n.LHS.Exec(context), n.RHS.Exec(context))
+		}); lit != nil {
+			return lit
+		}
+	}
+
+	switch {
+	case n.Op == ast.BinOpAdd && isInt(n.LHS) && isIntValue(n.RHS, 0),
+		n.Op == ast.BinOpSub && isInt(n.LHS) && isIntValue(n.RHS, 0),
+		n.Op == ast.BinOpMul && isInt(n.LHS) && isIntValue(n.RHS, 1):
+		return n.LHS
+	case n.Op == ast.BinOpAdd && isIntValue(n.LHS, 0) && isInt(n.RHS),
+		n.Op == ast.BinOpMul && isIntValue(n.LHS, 1) && isInt(n.RHS):
+		return n.RHS
+	}
+	return n
+}
+
+// optimizeUnary folds an operation on a literal into a literal, and removes double negation of a bool.
+func optimizeUnary(n *ast.UnaryOp) ast.Node {
+	if isLiteral(n.Expr) {
+		if lit := fold(n, func(context *ast.ExecContext) *ast.Variant {
+			return n.Apply(context, n.Expr.Exec(context))
+		}); lit != nil {
+			return lit
+		}
+	}
+
+	if inner, ok := n.Expr.(*ast.UnaryOp); ok && n.Op == ast.UnOpNot && inner.Op == ast.UnOpNot && isBool(inner.Expr) {
+		return inner.Expr
+	}
+	return n
+}
+
+// optimizeIf replaces an if statement with a literal condition by the code of the branch it always takes. The init
+// statement is kept in a block around the branch, so the variables it declares remain scoped to the if statement.
+func optimizeIf(n *ast.IfStmt) ast.Node {
+	if !isLiteral(n.Conditional) {
+		return n
+	}
+	var branch ast.Node = n.Else // conditions other than true take the else branch, as when executed
+	if b, ok := n.Conditional.(*ast.BoolLiteral); ok && b.Val {
+		branch = n.Code
+	}
+
+	list := &ast.StatementList{Span: n.Span, NoScope: n.Init == nil}
+	if n.Init != nil {
+		list.Stmts = append(list.Stmts, n.Init)
+	}
+	if branch != nil {
+		list.Stmts = append(list.Stmts, branch)
+	}
+	if len(list.Stmts) == 1 && n.Init == nil {
+		return branch
+	}
+	return list
+}
+
+// fold evaluates an operation on literals with eval, returning a literal of the result. Nil is returned if the
+// operation raises an error, so the error is raised when the code executes.
+func fold(n ast.Node, eval func(context *ast.ExecContext) *ast.Variant) ast.Node {
+	context := &ast.ExecContext{}
+	v := eval(context)
+	if len(context.Errors) > 0 {
+		return nil
+	}
+	span := ast.Span{Pos: n.Position()}
+	switch v.Type {
+	case ast.PrimitiveTypeInt:
+		return &ast.IntegerLiteral{Span: span, Val: v.Int}
+	case ast.PrimitiveTypeString:
+		return &ast.StringLiteral{Span: span, Str: v.String}
+	case ast.PrimitiveTypeBool:
+		return &ast.BoolLiteral{Span: span, Val: v.Bool}
+	}
+	return nil
+}
+
+// isLiteral returns true if n is a literal of a primitive type.
+func isLiteral(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BoolLiteral:
+		return true
+	}
+	return false
+}
+
+func isIntValue(n ast.Node, val int64) bool {
+	lit, ok := n.(*ast.IntegerLiteral)
+	return ok && lit.Val == val
+}
+
+// isInt returns true if n always evaluates to an int without raising an error. Variables are trusted to hold a value
+// of the type recorded when they were translated.
+func isInt(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.IntegerLiteral:
+		return true
+	case *ast.VariableReference:
+		return n.Type == ast.PrimitiveTypeInt
+	case *ast.BinaryOp:
+		switch n.Op {
+		case ast.BinOpAdd, ast.BinOpSub, ast.BinOpMul: // division may raise an error
+			return isInt(n.LHS) && isInt(n.RHS)
+		}
+	}
+	return false
+}
+
+// isBool returns true if n always evaluates to a bool without raising an error. Variables are trusted to hold a
+// value of the type recorded when they were translated.
+func isBool(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.BoolLiteral:
+		return true
+	case *ast.VariableReference:
+		return n.Type == ast.PrimitiveTypeBool
+	case *ast.UnaryOp:
+		return n.Op == ast.UnOpNot && isBool(n.Expr)
+	case *ast.BinaryOp:
+		switch n.Op {
+		case ast.BinOpEquality, ast.BinOpNotEquality:
+			return (isInt(n.LHS) && isInt(n.RHS)) || (isBool(n.LHS) && isBool(n.RHS))
+		case ast.BinOpLAnd, ast.BinOpLOr:
+			return isBool(n.LHS) && isBool(n.RHS)
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package opt
+
+import (
+	"testing"
+
+	"github.com/twitchyliquid64/harsh/ast"
+	"github.com/twitchyliquid64/harsh/compiler"
+)
+
+const testProgram = `package test
+
+var counter int
+
+func Fold() int {
+	return 2 * 3 + 10 / 5 - 7 % 4
+}
+
+func Strings() bool {
+	return "a" + "b" == "ab" && !false
+}
+
+func Simplify(x int, b bool) int {
+	y := x + 0
+	y = 0 + y * 1
+	y = 1 * (y - 0)
+	if !!b {
+		return y
+	}
+	return 0 - 1
+}
+
+func Branches() int {
+	if true {
+		counter = counter + 1
+	} else {
+		counter = counter + 100
+	}
+	if false {
+		counter = counter + 1000
+	}
+	if n := 5; true {
+		return n + counter
+	}
+	counter = 0
+	return 0
+}
+
+func DivZero() int {
+	x := 10 / (2 - 2)
+	counter = counter + 1
+	return x
+}
+`
+
+func parse(t *testing.T, optimize bool) *compiler.Context {
+	c, err := compiler.ParseLiteral("test.go", testProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	if optimize {
+		for _, decl := range c.Declarations {
+			if fn, ok := decl.Type.(ast.FunctionType); ok {
+				Optimize(fn.Code)
+			}
+		}
+	}
+	return c
+}
+
+// body returns the statements of the named function.
+func body(c *compiler.Context, name string) []ast.Node {
+	return c.Globals[name].Type.(ast.FunctionType).Code.(*ast.StatementList).Stmts
+}
+
+func TestMatchesUnoptimized(t *testing.T) {
+	for _, tc := range []struct {
+		fn   string
+		args map[string]interface{}
+	}{
+		{"Fold", nil},
+		{"Strings", nil},
+		{"Simplify", map[string]interface{}{"x": 4, "b": true}},
+		{"Simplify", map[string]interface{}{"x": 4, "b": false}},
+		{"Branches", nil},
+		{"DivZero", nil},
+	} {
+		for _, continueOnError := range []bool{false, true} {
+			unoptimized, optimized := parse(t, false), parse(t, true)
+			unoptimized.ContinueOnError, optimized.ContinueOnError = continueOnError, continueOnError
+
+			want, wantErr := unoptimized.CallFunc(tc.fn, tc.args)
+			got, gotErr := optimized.CallFunc(tc.fn, tc.args)
+			if got.Type.String() != want.Type.String() || (want.Type != ast.PrimitiveTypeUndefined && !got.Equal(want)) {
+				t.Errorf("%s: got %+v, want %+v", tc.fn, got, want)
+			}
+			if (gotErr == nil) != (wantErr == nil) || (gotErr != nil && gotErr.Error() != wantErr.Error()) {
+				t.Errorf("%s: got error %v, want %v", tc.fn, gotErr, wantErr)
+			}
+			if got, want := optimized.Globals["counter"].Int, unoptimized.Globals["counter"].Int; got != want {
+				t.Errorf("%s: counter is %d, want %d", tc.fn, got, want)
+			}
+		}
+	}
+}
+
+func TestFolding(t *testing.T) {
+	c := parse(t, true)
+
+	ret := body(c, "Fold")[0].(*ast.ReturnStmt)
+	if lit, ok := ret.Expr.(*ast.IntegerLiteral); !ok || lit.Val != 5 {
+		t.Errorf("Expected the result to be folded to 5, got %T", ret.Expr)
+	} else if lit.Position().Line != 6 {
+		t.Errorf("Expected the folded literal to keep the position of the operation, got %v", lit.Position())
+	}
+	ret = body(c, "Strings")[0].(*ast.ReturnStmt)
+	if lit, ok := ret.Expr.(*ast.BoolLiteral); !ok || !lit.Val {
+		t.Errorf("Expected the result to be folded to true, got %T", ret.Expr)
+	}
+
+	// division by zero is left to raise its error when executed.
+	assign := body(c, "DivZero")[0].(*ast.Assign)
+	if op, ok := assign.Value.(*ast.BinaryOp); !ok || op.Op != ast.BinOpDiv {
+		t.Errorf("Expected the division to remain, got %T", assign.Value)
+	} else if lit, ok := op.RHS.(*ast.IntegerLiteral); !ok || lit.Val != 0 {
+		t.Errorf("Expected the divisor to be folded to 0, got %T", op.RHS)
+	}
+}
+
+func TestSimplification(t *testing.T) {
+	c := parse(t, true)
+	stmts := body(c, "Simplify")
+	for i := 0; i != 3; i++ {
+		if v := stmts[i].(*ast.Assign).Value; !isVariable(v, "x") && !isVariable(v, "y") {
+			t.Errorf("Statement %d: expected the value to be simplified to a variable, got %T", i, v)
+		}
+	}
+	if cond := stmts[3].(*ast.IfStmt).Conditional; !isVariable(cond, "b") {
+		t.Errorf("Expected the double negation to be removed, got %T", cond)
+	}
+
+	// operands of unknown type are left to raise an error when executed.
+	for _, n := range []ast.Node{
+		&ast.BinaryOp{Op: ast.BinOpAdd, LHS: &ast.VariableReference{Name: "s", Type: ast.PrimitiveTypeString}, RHS: &ast.IntegerLiteral{}},
+		&ast.BinaryOp{Op: ast.BinOpMul, LHS: &ast.IntegerLiteral{Val: 1}, RHS: &ast.VariableReference{Name: "v"}},
+		&ast.BinaryOp{Op: ast.BinOpAdd, LHS: &ast.BinaryOp{Op: ast.BinOpDiv, LHS: &ast.VariableReference{Name: "i", Type: ast.PrimitiveTypeInt}, RHS: &ast.IntegerLiteral{}}, RHS: &ast.IntegerLiteral{}},
+		&ast.UnaryOp{Op: ast.UnOpNot, Expr: &ast.UnaryOp{Op: ast.UnOpNot, Expr: &ast.IntegerLiteral{Val: 1}}},
+		&ast.BinaryOp{Op: ast.BinOpAdd, LHS: &ast.StringLiteral{Str: "a"}, RHS: &ast.IntegerLiteral{}},
+	} {
+		if got := Optimize(n); got != n {
+			t.Errorf("Expected %T to be unchanged, got %T", n, got)
+		}
+	}
+}
+
+func TestBranches(t *testing.T) {
+	c := parse(t, true)
+	stmts := body(c, "Branches")
+	if len(stmts) != 2 {
+		t.Fatalf("Expected the if statements to be collapsed and unreachable code removed, got %d statements", len(stmts))
+	}
+	if list, ok := stmts[0].(*ast.StatementList); !ok || len(list.Stmts) != 1 {
+		t.Errorf("Expected the first if statement to be replaced by its code, got %T", stmts[0])
+	}
+	list, ok := stmts[1].(*ast.StatementList)
+	if !ok || list.NoScope || len(list.Stmts) != 2 {
+		t.Fatalf("Expected the if statement with an init statement to be replaced by a block, got %T", stmts[1])
+	}
+	if _, ok := list.Stmts[0].(*ast.Assign); !ok {
+		t.Errorf("Expected the block to start with the init statement, got %T", list.Stmts[0])
+	}
+}
+
+func isVariable(n ast.Node, name string) bool {
+	ref, ok := n.(*ast.VariableReference)
+	return ok && ref.Name == name
+}
@@ -0,0 +1,27 @@
+package stdlib
+
+import (
+	"errors"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+// Errors hold Go errors, so errors created by harsh code can be inspected by the host, and errors returned by host
+// functions can be inspected by harsh code.
+var errorsPackage = ast.Namespace{
+	"New":    fn(errorsNew, errorType, param("text", stringType)),
+	"Is":     fn(errorsIs, boolType, param("err", errorType), param("target", errorType)),
+	"Unwrap": fn(errorsUnwrap, errorType, param("err", errorType)),
+}
+
+func errorsNew(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(errors.New(args[0].String))
+}
+
+func errorsIs(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(errors.Is(args[0].ErrorData, args[1].ErrorData))
+}
+
+func errorsUnwrap(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return &ast.Variant{Type: errorType, ErrorData: errors.Unwrap(args[0].ErrorData)}
+}
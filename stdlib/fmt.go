@@ -0,0 +1,247 @@
+package stdlib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+var fmtPackage = ast.Namespace{
+	"Errorf":   variadic(fn(fmtErrorf, errorType, param("format", stringType), param("a", anySliceType))),
+	"Sprintf":  variadic(fn(fmtSprintf, stringType, param("format", stringType), param("a", anySliceType))),
+	"Sprint":   variadic(fn(fmtSprint, stringType, param("a", anySliceType))),
+	"Sprintln": variadic(fn(fmtSprintln, stringType, param("a", anySliceType))),
+	"Printf":   variadic(fn(fmtPrint(fmtSprintf), noResult, param("format", stringType), param("a", anySliceType))),
+	"Print":    variadic(fn(fmtPrint(fmtSprint), noResult, param("a", anySliceType))),
+	"Println":  variadic(fn(fmtPrint(fmtSprintln), noResult, param("a", anySliceType))),
+}
+
+func fmtErrorf(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return &ast.Variant{Type: errorType, ErrorData: Errorf(args[0].String, args[1].VectorData...)}
+}
+
+func fmtSprintf(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(Sprintf(args[0].String, args[1].VectorData...))
+}
+
+func fmtSprint(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(Sprint(args[0].VectorData...))
+}
+
+func fmtSprintln(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(Sprintln(args[0].VectorData...))
+}
+
+// fmtPrint returns a native function which writes the output of sprint to the output of the program.
+func fmtPrint(sprint ast.NativeFunc) ast.NativeFunc {
+	return func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+		s := sprint(context, node, args)
+		if _, err := io.WriteString(context.Writer(), s.String); err != nil {
+			return fail(context, node, err.Error())
+		}
+		return undefined()
+	}
+}
+
+// Sprint formats its operands like fmt.Sprint, adding spaces between operands when neither is a string.
+func Sprint(a ...*ast.Variant) string {
+	var out strings.Builder
+	for i, v := range a {
+		if i > 0 && v.Type.Kind() != ast.PrimitiveTypeString && a[i-1].Type.Kind() != ast.PrimitiveTypeString {
+			out.WriteString(" ")
+		}
+		out.WriteString(formatValue("%v", v))
+	}
+	return out.String()
+}
+
+// Sprintln formats its operands like fmt.Sprintln, separated by spaces and followed by a newline.
+func Sprintln(a ...*ast.Variant) string {
+	parts := make([]string, len(a))
+	for i, v := range a {
+		parts[i] = formatValue("%v", v)
+	}
+	return strings.Join(parts, " ") + "\n"
+}
+
+// Sprintf formats its operands according to format, like fmt.Sprintf. Each verb is applied to the elements of arrays,
+// slices and structs, and the + flag prints the field names of structs.
+func Sprintf(format string, a ...*ast.Variant) string {
+	return sprintf(format, a, nil)
+}
+
+// Errorf formats its operands like Sprintf, and returns an error with the formatted text. As with fmt.Errorf, each
+// error operand of a %w verb is wrapped by the returned error, so it can be found with errors.Is() and errors.As().
+func Errorf(format string, a ...*ast.Variant) error {
+	var wrapped []error
+	text := sprintf(format, a, &wrapped)
+	switch len(wrapped) {
+	case 0:
+		return errors.New(text)
+	case 1:
+		return &wrapError{text: text, err: wrapped[0]}
+	}
+	return &wrapErrors{text: text, errs: wrapped}
+}
+
+// wrapError is an error returned by Errorf which wraps a single error.
+type wrapError struct {
+	text string
+	err  error
+}
+
+func (e *wrapError) Error() string { return e.text }
+func (e *wrapError) Unwrap() error { return e.err }
+
+// wrapErrors is an error returned by Errorf which wraps more than one error.
+type wrapErrors struct {
+	text string
+	errs []error
+}
+
+func (e *wrapErrors) Error() string   { return e.text }
+func (e *wrapErrors) Unwrap() []error { return e.errs }
+
+// sprintf implements Sprintf. If wrapped is not nil, %w verbs format errors like %v and the errors are collected into
+// wrapped.
+func sprintf(format string, a []*ast.Variant, wrapped *[]error) string {
+	var out strings.Builder
+	next := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			out.WriteByte('%')
+			i++
+			continue
+		}
+
+		// the spec is rebuilt as it is parsed, so * widths and precisions can be replaced by their arguments.
+		spec := "%"
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			spec += format[i : i+1]
+			i++
+		}
+		for _, allowPrecision := range []bool{false, true} {
+			if allowPrecision {
+				if i >= len(format) || format[i] != '.' {
+					break
+				}
+				spec += "."
+				i++
+			}
+			if i < len(format) && format[i] == '*' {
+				if next < len(a) && a[next].Type.Kind() == ast.PrimitiveTypeInt {
+					spec += strconv.FormatInt(a[next].Int, 10)
+				} else {
+					out.WriteString("%!(BADWIDTH)")
+				}
+				next++
+				i++
+				continue
+			}
+			for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+				spec += format[i : i+1]
+				i++
+			}
+		}
+
+		if i >= len(format) {
+			out.WriteString("%!(NOVERB)")
+			break
+		}
+		verb, size := utf8.DecodeRuneInString(format[i:])
+		i += size - 1
+		spec += string(verb)
+		if next >= len(a) {
+			out.WriteString("%!" + string(verb) + "(MISSING)")
+			continue
+		}
+		if verb == 'w' && wrapped != nil && a[next].Type.Kind() == ast.PrimitiveTypeError && a[next].ErrorData != nil {
+			*wrapped = append(*wrapped, a[next].ErrorData)
+			spec = spec[:len(spec)-1] + "v"
+		}
+		out.WriteString(formatValue(spec, a[next]))
+		next++
+	}
+
+	if next < len(a) {
+		extra := make([]string, 0, len(a)-next)
+		for _, v := range a[next:] {
+			extra = append(extra, v.Type.String()+"="+formatValue("%v", v))
+		}
+		out.WriteString("%!(EXTRA " + strings.Join(extra, ", ") + ")")
+	}
+	return out.String()
+}
+
+// formatValue formats a value with a single verb, given by spec. Composite values are formatted element-wise.
+func formatValue(spec string, v *ast.Variant) string {
+	if v == nil {
+		return fmt.Sprintf(spec, nil)
+	}
+	switch v.Type.Kind() {
+	case ast.PrimitiveTypeInt:
+		return fmt.Sprintf(spec, int(v.Int))
+	case ast.PrimitiveTypeString:
+		return fmt.Sprintf(spec, v.String)
+	case ast.PrimitiveTypeBool:
+		return fmt.Sprintf(spec, v.Bool)
+	case ast.PrimitiveTypeError:
+		return fmt.Sprintf(spec, v.ErrorData)
+	case ast.ComplexTypeArray, ast.ComplexTypeSlice:
+		elems := make([]string, len(v.VectorData))
+		for i, elem := range v.VectorData {
+			elems[i] = formatValue(spec, elem)
+		}
+		return "[" + strings.Join(elems, " ") + "]"
+	case ast.ComplexTypeStruct:
+		names := fieldNames(v)
+		withNames := strings.HasSuffix(spec, "v") && strings.Contains(spec, "+")
+		fields := make([]string, len(names))
+		for i, name := range names {
+			fields[i] = formatValue(spec, v.NamedData[name])
+			if withNames {
+				fields[i] = name + ":" + fields[i]
+			}
+		}
+		return "{" + strings.Join(fields, " ") + "}"
+	case ast.ComplexTypeChannel:
+		if v.ChannelData == nil {
+			return fmt.Sprintf(spec, nil)
+		}
+		return fmt.Sprintf("%p", v.ChannelData)
+	case ast.ComplexTypeFunction:
+		return "func" + v.Type.String()
+	case ast.ComplexTypeHandle:
+		return "<" + v.Type.String() + ">" //the contents of handles are hidden
+	}
+	return fmt.Sprintf(spec, nil)
+}
+
+// fieldNames returns the names of the fields of a struct value, in the order they were declared if the type of the
+// value is known, or in alphabetical order otherwise.
+func fieldNames(v *ast.Variant) []string {
+	if st, ok := v.Type.(ast.StructType); ok {
+		names := make([]string, len(st.Fields))
+		for i, f := range st.Fields {
+			names[i] = f.Ident
+		}
+		return names
+	}
+	names := make([]string, 0, len(v.NamedData))
+	for name := range v.NamedData {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
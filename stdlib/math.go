@@ -0,0 +1,60 @@
+package stdlib
+
+import (
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+var mathPackage = ast.Namespace{
+	"Abs": fn(mathAbs, intType, param("x", intType)),
+	"Min": fn(mathMin, intType, param("x", intType), param("y", intType)),
+	"Max": fn(mathMax, intType, param("x", intType), param("y", intType)),
+	"Pow": fn(mathPow, intType, param("x", intType), param("y", intType)),
+}
+
+func mathAbs(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	if args[0].Int < 0 {
+		return ast.MakeVariant(-args[0].Int)
+	}
+	return ast.MakeVariant(args[0].Int)
+}
+
+func mathMin(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	if args[1].Int < args[0].Int {
+		return ast.MakeVariant(args[1].Int)
+	}
+	return ast.MakeVariant(args[0].Int)
+}
+
+func mathMax(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	if args[1].Int > args[0].Int {
+		return ast.MakeVariant(args[1].Int)
+	}
+	return ast.MakeVariant(args[0].Int)
+}
+
+// mathPow raises x to the power y. Negative powers are an error, as the result would not be an integer.
+func mathPow(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	x, y := args[0].Int, args[1].Int
+	if y < 0 {
+		return fail(context, node, "math: negative exponent in Pow")
+	}
+	switch { // powers of 0, 1 and -1 never overflow, so the loop below would run up to y times.
+	case x == 0 && y > 0:
+		return ast.MakeVariant(0)
+	case x == 1 || y == 0:
+		return ast.MakeVariant(1)
+	case x == -1 && y%2 == 0:
+		return ast.MakeVariant(1)
+	case x == -1:
+		return ast.MakeVariant(-1)
+	}
+	result := int64(1)
+	for ; y > 0; y-- {
+		next := result * x
+		if next/x != result {
+			return fail(context, node, "math: Pow overflows int")
+		}
+		result = next
+	}
+	return ast.MakeVariant(result)
+}
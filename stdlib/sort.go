@@ -0,0 +1,61 @@
+package stdlib
+
+import (
+	"sort"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+// Slices share their elements, so sorting the elements of an argument sorts the slice of the caller.
+var sortPackage = ast.Namespace{
+	"Ints":             fn(sortInts, noResult, param("x", intSliceType)),
+	"Strings":          fn(sortStrings, noResult, param("x", stringSliceType)),
+	"IntsAreSorted":    fn(sortIntsAreSorted, boolType, param("x", intSliceType)),
+	"StringsAreSorted": fn(sortStringsAreSorted, boolType, param("x", stringSliceType)),
+	"Slice": fn(sortSlice, noResult,
+		param("x", anySliceType),
+		param("less", ast.FunctionType{
+			Parameters: []ast.TypeKind{param("i", intType), param("j", intType)},
+			ReturnType: boolType,
+		})),
+}
+
+func sortInts(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	elems := args[0].VectorData
+	sort.SliceStable(elems, func(i, j int) bool { return elems[i].Int < elems[j].Int })
+	return undefined()
+}
+
+func sortStrings(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	elems := args[0].VectorData
+	sort.SliceStable(elems, func(i, j int) bool { return elems[i].String < elems[j].String })
+	return undefined()
+}
+
+func sortIntsAreSorted(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	elems := args[0].VectorData
+	return ast.MakeVariant(sort.SliceIsSorted(elems, func(i, j int) bool { return elems[i].Int < elems[j].Int }))
+}
+
+func sortStringsAreSorted(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	elems := args[0].VectorData
+	return ast.MakeVariant(sort.SliceIsSorted(elems, func(i, j int) bool { return elems[i].String < elems[j].String }))
+}
+
+// sortSlice sorts x with the harsh function less, which is called with the indices of the elements to compare. Sorting
+// stops at the first error raised by less. Function literals are not supported, so less must be a named function, which
+// reads the elements being sorted from a global variable.
+func sortSlice(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	elems, less := args[0].VectorData, args[1]
+	failed := false
+	sort.SliceStable(elems, func(i, j int) bool {
+		if failed {
+			return false
+		}
+		n := len(context.Errors)
+		r := context.Call(node, less, ast.MakeVariant(i), ast.MakeVariant(j))
+		failed = len(context.Errors) > n
+		return r.Bool
+	})
+	return undefined()
+}
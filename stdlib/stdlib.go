@@ -0,0 +1,78 @@
+// Package stdlib implements a subset of the Go standard library for harsh programs. Packages are implemented in Go,
+// and only provide functions which cannot access the host system - printing functions write to the Output of the
+// ExecContext. As harsh has no floating point or rune types, math operates on ints and unicode represents runes as
+// ints.
+package stdlib
+
+import (
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+// Packages contains the members of each standard library package, keyed by import path. Every member is a function
+// with a native implementation.
+var Packages = map[string]ast.Namespace{
+	"errors":  errorsPackage,
+	"fmt":     fmtPackage,
+	"math":    mathPackage,
+	"sort":    sortPackage,
+	"strconv": strconvPackage,
+	"strings": stringsPackage,
+	"unicode": unicodePackage,
+}
+
+var (
+	intType         ast.TypeKind = ast.PrimitiveTypeInt
+	stringType      ast.TypeKind = ast.PrimitiveTypeString
+	boolType        ast.TypeKind = ast.PrimitiveTypeBool
+	errorType       ast.TypeKind = ast.PrimitiveTypeError
+	noResult        ast.TypeKind = ast.PrimitiveTypeUndefined
+	intSliceType                 = ast.SliceType{SubType: ast.PrimitiveTypeInt}
+	stringSliceType              = ast.SliceType{SubType: ast.PrimitiveTypeString}
+	anySliceType                 = ast.SliceType{SubType: ast.UnknownType} // accepts slices of any type
+)
+
+// fn returns a function with the given signature, implemented by impl.
+func fn(impl ast.NativeFunc, result ast.TypeKind, params ...ast.TypeKind) *ast.Variant {
+	return &ast.Variant{
+		Type: ast.FunctionType{
+			Parameters: params,
+			ReturnType: result,
+			Native:     impl,
+		},
+	}
+}
+
+// variadic marks the function f as variadic, so its final parameter collects any trailing arguments.
+func variadic(f *ast.Variant) *ast.Variant {
+	fnType := f.Type.(ast.FunctionType)
+	fnType.Variadic = true
+	f.Type = fnType
+	return f
+}
+
+// param returns a named parameter of a function signature.
+func param(name string, t ast.TypeKind) ast.TypeKind {
+	return ast.NamedType{Ident: name, Type: t}
+}
+
+func makeStringSlice(elems []string) *ast.Variant {
+	out := &ast.Variant{Type: stringSliceType}
+	for _, s := range elems {
+		out.VectorData = append(out.VectorData, ast.MakeVariant(s))
+	}
+	return out
+}
+
+func undefined() *ast.Variant {
+	return &ast.Variant{Type: ast.PrimitiveTypeUndefined}
+}
+
+// fail reports an error raised by a native function, returning an undefined value.
+func fail(context *ast.ExecContext, node ast.Node, text string) *ast.Variant {
+	context.Raise(ast.ExecutionError{
+		Class:        ast.HostErr,
+		CreatingNode: node,
+		Text:         text,
+	})
+	return undefined()
+}
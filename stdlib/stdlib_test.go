@@ -0,0 +1,148 @@
+package stdlib
+
+import (
+	"testing"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+func call(t *testing.T, pkg, name string, args ...*ast.Variant) (*ast.Variant, []ast.ExecutionError) {
+	fn, ok := Packages[pkg][name]
+	if !ok {
+		t.Fatal("No function " + pkg + "." + name)
+	}
+	context := &ast.ExecContext{IsFuncContext: true, GlobalNamespace: ast.Namespace{}, FunctionNamespace: ast.Namespace{}}
+	r := context.Call(nil, fn, args...)
+	return r, context.Errors
+}
+
+func TestMembersAreNativeFunctions(t *testing.T) {
+	for path, members := range Packages {
+		for name, member := range members {
+			fnType, ok := member.Type.(ast.FunctionType)
+			if !ok || fnType.Native == nil {
+				t.Errorf("%s.%s is not a native function", path, name)
+			}
+			for _, p := range fnType.Parameters {
+				if _, named := p.(ast.NamedType); !named {
+					t.Errorf("%s.%s has an unnamed parameter", path, name)
+				}
+			}
+		}
+	}
+}
+
+func TestStringsSplitAndJoin(t *testing.T) {
+	parts, errs := call(t, "strings", "Split", ast.MakeVariant("a,b,c"), ast.MakeVariant(","))
+	if len(errs) > 0 || len(parts.VectorData) != 3 || parts.Type.Kind() != ast.ComplexTypeSlice {
+		t.Fatal("Incorrect result: ", parts, errs)
+	}
+	joined, _ := call(t, "strings", "Join", parts, ast.MakeVariant("+"))
+	if joined.String != "a+b+c" {
+		t.Error("Incorrect value: " + joined.String)
+	}
+}
+
+func TestSortIntsSortsCallersSlice(t *testing.T) {
+	s := &ast.Variant{Type: intSliceType, VectorData: []*ast.Variant{ast.MakeVariant(3), ast.MakeVariant(1), ast.MakeVariant(2)}}
+	call(t, "sort", "Ints", s)
+	for i, elem := range s.VectorData {
+		if elem.Int != int64(i+1) {
+			t.Errorf("Element %d: expected %d, got %d", i, i+1, elem.Int)
+		}
+	}
+}
+
+func TestAtoiReturnsError(t *testing.T) {
+	r, errs := call(t, "strconv", "Atoi", ast.MakeVariant("42"))
+	if len(errs) > 0 || r.VectorData[0].Int != 42 || r.VectorData[1].ErrorData != nil {
+		t.Errorf("Atoi(\"42\"): expected 42 and a nil error, got %v %v", r.VectorData, errs)
+	}
+	r, errs = call(t, "strconv", "Atoi", ast.MakeVariant("abc"))
+	if len(errs) > 0 {
+		t.Fatal("Expected the error to be returned, got ", errs)
+	}
+	if err := r.VectorData[1].ErrorData; err == nil || err.Error() != `strconv.Atoi: parsing "abc": invalid syntax` {
+		t.Errorf("Atoi(\"abc\"): unexpected error %v", err)
+	}
+}
+
+func TestMathPow(t *testing.T) {
+	tcs := []struct {
+		x, y, result int
+		fails        bool
+	}{
+		{x: 2, y: 10, result: 1024},
+		{x: -3, y: 3, result: -27},
+		{x: 7, y: 0, result: 1},
+		{x: -1, y: 1 << 62, result: 1},
+		{x: 2, y: 63, fails: true},
+		{x: 2, y: -1, fails: true},
+	}
+	for _, tc := range tcs {
+		r, errs := call(t, "math", "Pow", ast.MakeVariant(tc.x), ast.MakeVariant(tc.y))
+		if tc.fails {
+			if len(errs) != 1 || errs[0].Class != ast.HostErr {
+				t.Errorf("Pow(%d, %d): expected HostErr, got %v", tc.x, tc.y, errs)
+			}
+			continue
+		}
+		if len(errs) > 0 || r.Int != int64(tc.result) {
+			t.Errorf("Pow(%d, %d): expected %d, got %d %v", tc.x, tc.y, tc.result, r.Int, errs)
+		}
+	}
+}
+
+func TestSprintfMatchesGo(t *testing.T) {
+	point := &ast.Variant{
+		Type:      ast.StructType{Fields: []ast.NamedType{{Ident: "X", Type: ast.PrimitiveTypeInt}, {Ident: "S", Type: ast.PrimitiveTypeString}}},
+		NamedData: map[string]*ast.Variant{"X": ast.MakeVariant(1), "S": ast.MakeVariant("a")},
+	}
+	ints := &ast.Variant{Type: intSliceType, VectorData: []*ast.Variant{ast.MakeVariant(1), ast.MakeVariant(2)}}
+
+	tcs := []struct {
+		format string
+		args   []*ast.Variant
+		want   string
+	}{
+		{"%d|%5d|%-4d|%+d", []*ast.Variant{ast.MakeVariant(1), ast.MakeVariant(2), ast.MakeVariant(3), ast.MakeVariant(4)}, "1|    2|3   |+4"},
+		{"%s %q %x %.2s %5.1s", []*ast.Variant{ast.MakeVariant("a"), ast.MakeVariant("b"), ast.MakeVariant("hi"), ast.MakeVariant("abc"), ast.MakeVariant("xyz")}, `a "b" 6869 ab     x`},
+		{"%t %v %x", []*ast.Variant{ast.MakeVariant(true), ast.MakeVariant(false), ast.MakeVariant(255)}, "true false ff"},
+		{"%v %+v %3v", []*ast.Variant{point, point, ints}, "{1 a} {X:1 S:a} [  1   2]"},
+		{"%*d|%.*s|100%%", []*ast.Variant{ast.MakeVariant(4), ast.MakeVariant(7), ast.MakeVariant(2), ast.MakeVariant("abc")}, "   7|ab|100%"},
+		{"%d %d", []*ast.Variant{ast.MakeVariant(1)}, "1 %!d(MISSING)"},
+		{"%d", []*ast.Variant{ast.MakeVariant("s")}, "%!d(string=s)"},
+		{"%d", []*ast.Variant{ast.MakeVariant(1), ast.MakeVariant("x")}, "1%!(EXTRA string=x)"},
+	}
+	for _, tc := range tcs {
+		if got := Sprintf(tc.format, tc.args...); got != tc.want {
+			t.Errorf("Sprintf(%q): expected %q, got %q", tc.format, tc.want, got)
+		}
+	}
+
+	if got := Sprint(ast.MakeVariant("a"), ast.MakeVariant(1), ast.MakeVariant(2), ast.MakeVariant("b"), ast.MakeVariant(true)); got != "a1 2btrue" {
+		t.Errorf("Sprint: got %q", got)
+	}
+	if got := Sprintln(ast.MakeVariant("a"), ast.MakeVariant(1), ints); got != "a 1 [1 2]\n" {
+		t.Errorf("Sprintln: got %q", got)
+	}
+}
+
+func TestErrorfWrapsErrors(t *testing.T) {
+	base, _ := call(t, "errors", "New", ast.MakeVariant("base"))
+	wrapped, errs := call(t, "fmt", "Errorf", ast.MakeVariant("%d: %w"),
+		&ast.Variant{Type: anySliceType, VectorData: []*ast.Variant{ast.MakeVariant(3), base}})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if wrapped.ErrorData.Error() != "3: base" {
+		t.Errorf("Incorrect text: %q", wrapped.ErrorData.Error())
+	}
+	is, _ := call(t, "errors", "Is", wrapped, base)
+	if !is.Bool {
+		t.Error("Expected errors.Is to find the wrapped error")
+	}
+	if Sprintf("%w", base) != "%!w(*errors.errorString=&{base})" {
+		t.Errorf("Incorrect Sprintf of %%w: %q", Sprintf("%w", base))
+	}
+}
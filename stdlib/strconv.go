@@ -0,0 +1,46 @@
+package stdlib
+
+import (
+	"strconv"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+var strconvPackage = ast.Namespace{
+	"Itoa":       fn(strconvItoa, stringType, param("i", intType)),
+	"Atoi":       fn(strconvAtoi, ast.TupleType{Types: []ast.TypeKind{intType, errorType}}, param("s", stringType)),
+	"FormatInt":  fn(strconvFormatInt, stringType, param("i", intType), param("base", intType)),
+	"FormatBool": fn(strconvFormatBool, stringType, param("b", boolType)),
+	"Quote":      fn(strconvQuote, stringType, param("s", stringType)),
+}
+
+func strconvItoa(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(strconv.FormatInt(args[0].Int, 10))
+}
+
+// strconvAtoi returns the parsed int and the error from parsing it, which is nil if s is a valid int.
+func strconvAtoi(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	i, err := strconv.Atoi(args[0].String)
+	return &ast.Variant{
+		Type: ast.TupleType{Types: []ast.TypeKind{intType, errorType}},
+		VectorData: []*ast.Variant{
+			ast.MakeVariant(i),
+			{Type: errorType, ErrorData: err},
+		},
+	}
+}
+
+func strconvFormatInt(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	if args[1].Int < 2 || args[1].Int > 36 {
+		return fail(context, node, "strconv: illegal FormatInt base")
+	}
+	return ast.MakeVariant(strconv.FormatInt(args[0].Int, int(args[1].Int)))
+}
+
+func strconvFormatBool(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(strconv.FormatBool(args[0].Bool))
+}
+
+func strconvQuote(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(strconv.Quote(args[0].String))
+}
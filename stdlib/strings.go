@@ -0,0 +1,84 @@
+package stdlib
+
+import (
+	"strings"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+var stringsPackage = ast.Namespace{
+	"Contains":   fn(stringPredicate(strings.Contains), boolType, param("s", stringType), param("substr", stringType)),
+	"HasPrefix":  fn(stringPredicate(strings.HasPrefix), boolType, param("s", stringType), param("prefix", stringType)),
+	"HasSuffix":  fn(stringPredicate(strings.HasSuffix), boolType, param("s", stringType), param("suffix", stringType)),
+	"EqualFold":  fn(stringPredicate(strings.EqualFold), boolType, param("s", stringType), param("t", stringType)),
+	"Index":      fn(stringIndex(strings.Index), intType, param("s", stringType), param("substr", stringType)),
+	"LastIndex":  fn(stringIndex(strings.LastIndex), intType, param("s", stringType), param("substr", stringType)),
+	"Count":      fn(stringIndex(strings.Count), intType, param("s", stringType), param("substr", stringType)),
+	"ToUpper":    fn(stringMapping(strings.ToUpper), stringType, param("s", stringType)),
+	"ToLower":    fn(stringMapping(strings.ToLower), stringType, param("s", stringType)),
+	"TrimSpace":  fn(stringMapping(strings.TrimSpace), stringType, param("s", stringType)),
+	"Trim":       fn(stringTrim(strings.Trim), stringType, param("s", stringType), param("cutset", stringType)),
+	"TrimPrefix": fn(stringTrim(strings.TrimPrefix), stringType, param("s", stringType), param("prefix", stringType)),
+	"TrimSuffix": fn(stringTrim(strings.TrimSuffix), stringType, param("s", stringType), param("suffix", stringType)),
+	"Split":      fn(stringsSplit, stringSliceType, param("s", stringType), param("sep", stringType)),
+	"Fields":     fn(stringsFields, stringSliceType, param("s", stringType)),
+	"Join":       fn(stringsJoin, stringType, param("elems", stringSliceType), param("sep", stringType)),
+	"Repeat":     fn(stringsRepeat, stringType, param("s", stringType), param("count", intType)),
+	"Replace":    fn(stringsReplace, stringType, param("s", stringType), param("old", stringType), param("new", stringType), param("n", intType)),
+	"ReplaceAll": fn(stringsReplaceAll, stringType, param("s", stringType), param("old", stringType), param("new", stringType)),
+}
+
+func stringPredicate(f func(string, string) bool) ast.NativeFunc {
+	return func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+		return ast.MakeVariant(f(args[0].String, args[1].String))
+	}
+}
+
+func stringIndex(f func(string, string) int) ast.NativeFunc {
+	return func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+		return ast.MakeVariant(f(args[0].String, args[1].String))
+	}
+}
+
+func stringMapping(f func(string) string) ast.NativeFunc {
+	return func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+		return ast.MakeVariant(f(args[0].String))
+	}
+}
+
+func stringTrim(f func(string, string) string) ast.NativeFunc {
+	return func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+		return ast.MakeVariant(f(args[0].String, args[1].String))
+	}
+}
+
+func stringsSplit(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return makeStringSlice(strings.Split(args[0].String, args[1].String))
+}
+
+func stringsFields(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return makeStringSlice(strings.Fields(args[0].String))
+}
+
+func stringsJoin(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	elems := make([]string, len(args[0].VectorData))
+	for i, elem := range args[0].VectorData {
+		elems[i] = elem.String
+	}
+	return ast.MakeVariant(strings.Join(elems, args[1].String))
+}
+
+func stringsRepeat(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	if args[1].Int < 0 {
+		return fail(context, node, "strings: negative Repeat count")
+	}
+	return ast.MakeVariant(strings.Repeat(args[0].String, int(args[1].Int)))
+}
+
+func stringsReplace(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(strings.Replace(args[0].String, args[1].String, args[2].String, int(args[3].Int)))
+}
+
+func stringsReplaceAll(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+	return ast.MakeVariant(strings.ReplaceAll(args[0].String, args[1].String, args[2].String))
+}
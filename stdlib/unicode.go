@@ -0,0 +1,30 @@
+package stdlib
+
+import (
+	"unicode"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+var unicodePackage = ast.Namespace{
+	"IsDigit":  fn(runePredicate(unicode.IsDigit), boolType, param("r", intType)),
+	"IsLetter": fn(runePredicate(unicode.IsLetter), boolType, param("r", intType)),
+	"IsLower":  fn(runePredicate(unicode.IsLower), boolType, param("r", intType)),
+	"IsUpper":  fn(runePredicate(unicode.IsUpper), boolType, param("r", intType)),
+	"IsSpace":  fn(runePredicate(unicode.IsSpace), boolType, param("r", intType)),
+	"IsPunct":  fn(runePredicate(unicode.IsPunct), boolType, param("r", intType)),
+	"ToLower":  fn(runeMapping(unicode.ToLower), intType, param("r", intType)),
+	"ToUpper":  fn(runeMapping(unicode.ToUpper), intType, param("r", intType)),
+}
+
+func runePredicate(f func(rune) bool) ast.NativeFunc {
+	return func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+		return ast.MakeVariant(f(rune(args[0].Int)))
+	}
+}
+
+func runeMapping(f func(rune) rune) ast.NativeFunc {
+	return func(context *ast.ExecContext, node ast.Node, args []*ast.Variant) *ast.Variant {
+		return ast.MakeVariant(int64(f(rune(args[0].Int))))
+	}
+}
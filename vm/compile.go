@@ -0,0 +1,424 @@
+// Package vm compiles the code of functions to bytecode, which runs on a stack machine. Local variables are held in
+// the slots of the frame assigned to them by ast.Resolve(), rather than looked up by name as the code executes, and
+// literals are evaluated once. Compiled code produces the same results and errors as the tree walker in package ast,
+// evaluating the same number of steps.
+package vm
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+// CompileError is returned if code cannot be compiled, as it uses a feature the VM does not support.
+type CompileError struct {
+	Node ast.Node
+	Text string
+}
+
+func (e CompileError) Error() string {
+	if e.Node == nil {
+		return e.Text
+	}
+	if pos := e.Node.Position(); pos.IsValid() {
+		return pos.String() + ": " + e.Text
+	}
+	return e.Text
+}
+
+// Function is the code of a function compiled to bytecode. It is a node, so it can be executed by ast.ExecMain() in
+// place of the code it was compiled from, with the arguments of the function in the FunctionNamespace of the context.
+// Functions it calls are compiled as they are first called. Calls of functions which cannot be compiled, such as
+// those implemented in Go or which start goroutines, are executed by the tree walker.
+type Function struct {
+	Code ast.Node // the code the function was compiled from
+
+	params []string // names of the parameters, which are held in the first slots
+	slots  int      // number of slots in a frame of the function
+	stack  int      // maximum depth of the operand stack
+	code   []instr
+	nodes  []ast.Node // nodes evaluated by instructions
+	consts []*ast.Variant
+	names  []string // names of globals referenced by the function
+	cache  *cache
+}
+
+// cache holds the functions compiled by a call of Compile(), keyed by the code they were compiled from. Code which
+// cannot be compiled is cached as nil.
+type cache struct {
+	mu        sync.Mutex
+	functions map[ast.Node]*Function
+}
+
+// lookup returns the compiled code of fnType, compiling it on first use. Nil is returned if it cannot be compiled.
+func (c *cache) lookup(fnType ast.FunctionType) *Function {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.functions[fnType.Code]
+	if !ok {
+		f, _ = compile(fnType, c)
+		c.functions[fnType.Code] = f
+	}
+	return f
+}
+
+// Compile compiles the code of fn. A CompileError is returned if the code uses a feature the VM does not support, in
+// which case it should be executed by the tree walker.
+func Compile(fn ast.FunctionType) (*Function, error) {
+	c := &cache{functions: map[ast.Node]*Function{}}
+	f, err := compile(fn, c)
+	if err != nil {
+		return nil, err
+	}
+	c.functions[fn.Code] = f
+	return f, nil
+}
+
+func compile(fn ast.FunctionType, c *cache) (*Function, error) {
+	if fn.Code == nil {
+		return nil, CompileError{Text: "Function has no code"}
+	}
+	list, ok := fn.Code.(*ast.StatementList)
+	if !ok {
+		return nil, CompileError{Node: fn.Code, Text: "Function code is not a statement list"}
+	}
+	if !ast.Resolve(fn) {
+		return nil, CompileError{Node: fn.Code, Text: "Cannot resolve the variables of the function"}
+	}
+	b := &builder{fn: &Function{Code: fn.Code, params: list.Layout.Params, slots: list.Layout.Slots, cache: c}}
+	b.emit(opStep, 0, list)
+	for _, stmt := range list.Stmts {
+		if err := b.stmt(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return b.fn, nil
+}
+
+// builder holds the state of the compilation of a function.
+type builder struct {
+	fn    *Function
+	depth int // depth of the operand stack
+}
+
+// emit appends an instruction evaluating node, returning its address.
+func (c *builder) emit(op opcode, arg int, node ast.Node) int {
+	in := instr{op: op, arg: int32(arg), node: -1}
+	if node != nil {
+		in.node = int32(len(c.fn.nodes))
+		c.fn.nodes = append(c.fn.nodes, node)
+	}
+	c.fn.code = append(c.fn.code, in)
+
+	c.depth += stackEffect(op, arg)
+	if c.depth > c.fn.stack {
+		c.fn.stack = c.depth
+	}
+	return len(c.fn.code) - 1
+}
+
+// patch sets the target of the jump at addr to the next instruction.
+func (c *builder) patch(addr int) {
+	c.fn.code[addr].arg = int32(len(c.fn.code))
+}
+
+func (c *builder) constant(v *ast.Variant) int {
+	c.fn.consts = append(c.fn.consts, v)
+	return len(c.fn.consts) - 1
+}
+
+func (c *builder) global(name string) int {
+	for i, n := range c.fn.names {
+		if n == name {
+			return i
+		}
+	}
+	c.fn.names = append(c.fn.names, name)
+	return len(c.fn.names) - 1
+}
+
+func unsupported(node ast.Node) error {
+	if node == nil {
+		return CompileError{Text: "Missing node"}
+	}
+	return CompileError{Node: node, Text: "Cannot compile " + reflect.TypeOf(node).Elem().Name()}
+}
+
+// stmt compiles a node executed as a statement, which leaves nothing on the operand stack.
+func (c *builder) stmt(node ast.Node) error {
+	switch n := node.(type) {
+	case *ast.StatementList:
+		c.emit(opStep, 0, n)
+		for _, stmt := range n.Stmts {
+			if err := c.stmt(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.Assign:
+		c.emit(opStep, 0, n)
+		switch v := n.Variable.(type) {
+		case *ast.VariableReference:
+			if err := c.expr(n.Value); err != nil {
+				return err
+			}
+			if err := c.store(v); err != nil {
+				return err
+			}
+		case *ast.Subscript, *ast.NamedSelector:
+			if err := c.expr(v); err != nil {
+				return err
+			}
+			if err := c.expr(n.Value); err != nil {
+				return err
+			}
+			c.emit(opStoreRef, 0, v)
+		default:
+			return unsupported(n.Variable)
+		}
+		return nil
+
+	case *ast.MultiAssign:
+		c.emit(opStep, 0, n)
+		if err := c.expr(n.Value); err != nil {
+			return err
+		}
+		unpack := c.emit(opUnpack, 0, n)
+		for i, variable := range n.Variables {
+			switch v := variable.(type) {
+			case nil:
+			case *ast.VariableReference:
+				c.emit(opElem, i, nil)
+				if err := c.store(v); err != nil {
+					return err
+				}
+			case *ast.Subscript, *ast.NamedSelector:
+				if err := c.expr(v); err != nil {
+					return err
+				}
+				c.emit(opElem, i, nil)
+				c.emit(opStoreRef, 0, v)
+			default:
+				return unsupported(variable)
+			}
+		}
+		c.patch(unpack)
+		return nil
+
+	case *ast.IfStmt:
+		c.emit(opStep, 0, n)
+		if n.Init != nil {
+			if err := c.stmt(n.Init); err != nil {
+				return err
+			}
+		}
+		if err := c.expr(n.Conditional); err != nil {
+			return err
+		}
+		skip := c.emit(opJumpUnless, 0, nil)
+		if err := c.stmt(n.Code); err != nil {
+			return err
+		}
+		if n.Else != nil {
+			end := c.emit(opJump, 0, nil)
+			c.patch(skip)
+			if err := c.stmt(n.Else); err != nil {
+				return err
+			}
+			c.patch(end)
+		} else {
+			c.patch(skip)
+		}
+		return nil
+
+	case *ast.ForStmt:
+		c.emit(opStep, 0, n)
+		if n.Init != nil {
+			if err := c.stmt(n.Init); err != nil {
+				return err
+			}
+		}
+		loop := len(c.fn.code)
+		if err := c.expr(n.Conditional); err != nil {
+			return err
+		}
+		exit := c.emit(opLoopUnless, 0, n)
+		if err := c.stmt(n.Code); err != nil {
+			return err
+		}
+		if n.PostIteration != nil {
+			if err := c.stmt(n.PostIteration); err != nil {
+				return err
+			}
+		}
+		c.emit(opJump, loop, nil)
+		c.patch(exit)
+		return nil
+
+	case *ast.RangeStmt:
+		c.emit(opStep, 0, n)
+		if err := c.expr(n.Expr); err != nil {
+			return err
+		}
+		start := c.emit(opRange, 0, n)
+		loop := c.emit(opNext, 0, n)
+		for _, target := range []ast.Node{n.Key, n.Value} {
+			switch v := target.(type) {
+			case nil:
+				c.emit(opPop, 0, nil)
+			case *ast.VariableReference:
+				if err := c.store(v); err != nil {
+					return err
+				}
+			default:
+				return unsupported(target)
+			}
+		}
+		if err := c.stmt(n.Code); err != nil {
+			return err
+		}
+		c.emit(opJump, loop, nil)
+		c.patch(start)
+		c.patch(loop)
+		c.depth -= 2 //the loop is popped once it is done
+		return nil
+
+	case *ast.ReturnStmt:
+		c.emit(opStep, 0, n)
+		if err := c.expr(n.Expr); err != nil {
+			return err
+		}
+		c.emit(opReturn, 0, nil)
+		return nil
+	}
+
+	if err := c.expr(node); err != nil {
+		return err
+	}
+	c.emit(opPop, 0, nil)
+	return nil
+}
+
+// store compiles the assignment of the value at the top of the operand stack to the variable v.
+func (c *builder) store(v *ast.VariableReference) error {
+	switch v.Storage {
+	case ast.StorageLocal:
+		c.emit(opStore, v.Slot, v)
+	case ast.StorageGlobal:
+		c.emit(opStoreGlobal, c.global(v.Name), v)
+	default:
+		return CompileError{Node: v, Text: "Variable " + v.Name + " is not resolved"}
+	}
+	return nil
+}
+
+// expr compiles a node evaluated as an expression, which pushes its value onto the operand stack.
+func (c *builder) expr(node ast.Node) error {
+	switch n := node.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BoolLiteral, *ast.NilLiteral:
+		c.emit(opConst, c.constant(n.Exec(&ast.ExecContext{})), n)
+
+	case *ast.VariableReference:
+		switch n.Storage {
+		case ast.StorageLocal:
+			c.emit(opLoad, n.Slot, n)
+		case ast.StorageGlobal:
+			c.emit(opLoadGlobal, c.global(n.Name), n)
+		default:
+			return CompileError{Node: n, Text: "Variable " + n.Name + " is not resolved"}
+		}
+
+	case *ast.BinaryOp:
+		if err := c.exprs(n.LHS, n.RHS); err != nil {
+			return err
+		}
+		c.emit(opBinary, 0, n)
+
+	case *ast.UnaryOp:
+		if err := c.expr(n.Expr); err != nil {
+			return err
+		}
+		c.emit(opUnary, 0, n)
+
+	case *ast.Subscript:
+		if err := c.exprs(n.Expr, n.Subscript); err != nil {
+			return err
+		}
+		c.emit(opSubscript, 0, n)
+
+	case *ast.NamedSelector:
+		if err := c.expr(n.Expr); err != nil {
+			return err
+		}
+		c.emit(opSelect, 0, n)
+
+	case *ast.FunctionCall:
+		if err := c.expr(n.Function); err != nil {
+			return err
+		}
+		callee := c.emit(opCallee, 0, n)
+		if err := c.exprs(n.Args...); err != nil {
+			return err
+		}
+		c.emit(opCall, len(n.Args), n)
+		c.patch(callee)
+
+	case *ast.TupleLiteral:
+		if err := c.exprs(n.Values...); err != nil {
+			return err
+		}
+		c.emit(opTuple, len(n.Values), n)
+
+	case *ast.SliceLiteral:
+		if err := c.exprs(n.Literal...); err != nil {
+			return err
+		}
+		c.emit(opSlice, len(n.Literal), n)
+
+	case *ast.ArrayLiteral:
+		if err := c.expr(n.Type.Len); err != nil {
+			return err
+		}
+		alloc := c.emit(opArray, 0, n)
+		for i, literal := range n.Literal {
+			if err := c.expr(literal); err != nil {
+				return err
+			}
+			c.emit(opSetElem, i, nil)
+		}
+		c.patch(alloc)
+
+	case *ast.BuiltinCall:
+		if err := c.exprs(n.Args...); err != nil {
+			return err
+		}
+		c.emit(opBuiltin, len(n.Args), n)
+
+	case *ast.StructLiteral:
+		var values int
+		for _, field := range n.Type.Fields {
+			if value := n.Values[field.Ident]; value != nil {
+				if err := c.expr(value); err != nil {
+					return err
+				}
+				values++
+			}
+		}
+		c.emit(opStruct, values, n)
+
+	default:
+		return unsupported(node)
+	}
+	return nil
+}
+
+func (c *builder) exprs(nodes ...ast.Node) error {
+	for _, node := range nodes {
+		if err := c.expr(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,450 @@
+package vm
+
+import (
+	"go/token"
+	"strconv"
+
+	"github.com/twitchyliquid64/harsh/ast"
+)
+
+type opcode uint8
+
+// Represents the instructions of the VM. Instructions which evaluate a node record a step, as the node would when it
+// is executed by the tree walker.
+const (
+	opStep        opcode = iota // records the evaluation of a statement
+	opConst                     // pushes constant arg
+	opLoad                      // pushes the local variable in slot arg
+	opLoadGlobal                // pushes the global named by arg
+	opStore                     // pops a value, assigning it to the local variable in slot arg
+	opStoreGlobal               // pops a value, assigning it to the global named by arg
+	opStoreRef                  // pops a value, then the element or field it is assigned to
+	opPop                       // pops a value, discarding it
+	opBinary                    // pops two operands, pushing the result of the operation
+	opUnary                     // pops an operand, pushing the result of the operation
+	opSubscript                 // pops an index then an array or slice, pushing the element
+	opSelect                    // pops a value, pushing the field or method selected from it
+	opJump                      // continues from address arg
+	opJumpUnless                // pops a value, continuing from address arg unless it is true
+	opLoopUnless                // pops the conditional of a loop, continuing from address arg unless it is true
+	opReturn                    // pops a value, returning it from the function
+	opCallee                    // checks the value at the top of the stack can be called, otherwise continuing from address arg
+	opCall                      // pops arg arguments then a function, pushing the result of calling the function
+	opTuple                     // pops arg values, pushing a tuple of them
+	opSlice                     // pops arg values, pushing a slice of them
+	opArray                     // pops the length of an array, pushing the array, or continuing from address arg if invalid
+	opSetElem                   // pops a value, setting element arg of the array at the top of the stack
+	opStruct                    // pops the arg values of the fields set by a struct literal, pushing the struct
+	opUnpack                    // pops the tuple assigned by a MultiAssign, continuing from address arg if it does not match
+	opElem                      // pushes element arg of the tuple being assigned
+	opBuiltin                   // pops arg arguments, pushing the result of the builtin function
+	opRange                     // pops the range expression, pushing the value ranged over and the next iteration, or continuing from address arg if invalid
+	opNext                      // pushes the value then the key of the next iteration of the range loop at the top of the stack, or pops the loop and continues from address arg if it is done
+)
+
+// instr is a single instruction, which evaluates the node at index node of Function.nodes, or -1 if none.
+type instr struct {
+	op   opcode
+	arg  int32
+	node int32
+}
+
+// stackEffect returns the change in the depth of the operand stack caused by an instruction.
+func stackEffect(op opcode, arg int) int {
+	switch op {
+	case opConst, opLoad, opLoadGlobal, opElem:
+		return 1
+	case opStore, opStoreGlobal, opPop, opBinary, opSubscript, opJumpUnless, opLoopUnless, opReturn, opSetElem, opUnpack:
+		return -1
+	case opStoreRef:
+		return -2
+	case opCall:
+		return -arg
+	case opTuple, opSlice, opStruct, opBuiltin:
+		return 1 - arg
+	case opRange:
+		return 1
+	case opNext:
+		return 2
+	}
+	return 0
+}
+
+func undefined() *ast.Variant {
+	return &ast.Variant{Type: ast.PrimitiveTypeUndefined}
+}
+
+// Exec runs the function as the code of a call, with the arguments of the call in context.FunctionNamespace. As for
+// the code of a function executed by the tree walker, IsReturn is set on the result if it was returned.
+func (f *Function) Exec(context *ast.ExecContext) *ast.Variant {
+	slots := make([]*ast.Variant, f.slots)
+	for i, name := range f.params {
+		if v := context.FunctionNamespace[name]; v != nil && name != "" {
+			slots[i] = v.Copy()
+		}
+	}
+	ret, returned := f.run(context, slots)
+	ret.IsReturn = returned
+	return ret
+}
+
+// Print prints the code the function was compiled from.
+func (f *Function) Print(level int, printContext *ast.PrintContext) {
+	f.Code.Print(level, printContext)
+}
+
+// Position returns the position of the code the function was compiled from.
+func (f *Function) Position() token.Position {
+	return f.Code.Position()
+}
+
+// call invokes the function fp, the value of the function of the call n, with args. Compiled functions run on the
+// VM, in a new frame of the call stack, and any other function is called by the tree walker.
+func (f *Function) call(context *ast.ExecContext, n *ast.FunctionCall, fp *ast.Variant, args []*ast.Variant) *ast.Variant {
+	fnType, _ := ast.FunctionTypeOf(fp.Type)
+	var callee *Function
+	if fnType.Code != nil && fnType.Native == nil && len(args) == len(fnType.Parameters) {
+		callee = f.cache.lookup(fnType)
+	}
+	if callee == nil {
+		return context.CallFunction(n, n.Name(), fp, args)
+	}
+	frame, ok := context.PushFrame(n, n.Name())
+	if !ok {
+		return undefined()
+	}
+
+	calleeContext := &ast.ExecContext{
+		GlobalNamespace: context.GlobalNamespace,
+		Scheduler:       context.Scheduler,
+		Output:          context.Output,
+		Stack:           frame,
+	}
+	if fp.Globals != nil {
+		calleeContext.GlobalNamespace = fp.Globals
+	}
+	slots := make([]*ast.Variant, callee.slots)
+	for i, arg := range args {
+		slots[i] = arg.Copy() //arguments are passed by value
+	}
+
+	ret, _ := callee.run(calleeContext, slots)
+	for _, v := range slots {
+		calleeContext.Replace(n, v, nil)
+	}
+	for i := range calleeContext.Errors {
+		if calleeContext.Errors[i].Stack == nil {
+			calleeContext.Errors[i].Stack = frame.Trace()
+		}
+	}
+	context.Errors = append(context.Errors, calleeContext.Errors...)
+	return ret
+}
+
+// run executes the function with the given frame of local variables, returning the result and true if a value was
+// returned.
+func (f *Function) run(context *ast.ExecContext, slots []*ast.Variant) (*ast.Variant, bool) {
+	stack := make([]*ast.Variant, 0, f.stack)
+	var tuple *ast.Variant // the value assigned by the current MultiAssign
+
+	for pc := 0; pc < len(f.code); pc++ {
+		in := f.code[pc]
+		var node ast.Node
+		if in.node >= 0 {
+			node = f.nodes[in.node]
+		}
+
+		switch in.op {
+		case opStep:
+			context.Step(node)
+
+		case opConst:
+			context.Step(node)
+			stack = append(stack, f.consts[in.arg])
+
+		case opLoad:
+			context.Step(node)
+			v := slots[in.arg]
+			if v == nil {
+				v = &ast.Variant{Type: ast.PrimitiveTypeUndefined, VariableReferenceFailed: true}
+			}
+			stack = append(stack, v)
+
+		case opLoadGlobal:
+			context.Step(node)
+			v, ok := context.GlobalNamespace[f.names[in.arg]]
+			if !ok {
+				v = &ast.Variant{Type: ast.PrimitiveTypeUndefined, VariableReferenceFailed: true}
+			}
+			stack = append(stack, v)
+
+		case opStore:
+			context.Step(node)
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			context.Replace(node, slots[in.arg], v)
+			if slot := slots[in.arg]; slot != nil && v.VectorData == nil && v.NamedData == nil {
+				*slot = *v //the frame owns the values of its slots, so values without elements are assigned in place
+				slot.IsReturn, slot.VariableReferenceFailed = false, false
+			} else {
+				slots[in.arg] = v.Copy()
+			}
+
+		case opStoreGlobal:
+			context.Step(node)
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			name := f.names[in.arg]
+			context.Replace(node, context.GlobalNamespace[name], v)
+			context.GlobalNamespace.Save(name, v)
+
+		case opStoreRef:
+			v, variable := stack[len(stack)-1], stack[len(stack)-2]
+			stack = stack[:len(stack)-2]
+			context.Replace(node, variable, v)
+			*variable = *v.Copy()
+
+		case opPop:
+			stack = stack[:len(stack)-1]
+
+		case opBinary:
+			n := node.(*ast.BinaryOp)
+			context.Step(n)
+			l, r := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = binary(context, n, l, r)
+
+		case opUnary:
+			context.Step(node)
+			stack[len(stack)-1] = node.(*ast.UnaryOp).Apply(context, stack[len(stack)-1])
+
+		case opSubscript:
+			context.Step(node)
+			base, index := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = node.(*ast.Subscript).Apply(context, base, index)
+
+		case opSelect:
+			context.Step(node)
+			stack[len(stack)-1] = node.(*ast.NamedSelector).Apply(context, stack[len(stack)-1])
+
+		case opJump:
+			pc = int(in.arg) - 1
+
+		case opJumpUnless:
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if v.Type != ast.PrimitiveTypeBool || !v.Bool {
+				pc = int(in.arg) - 1
+			}
+
+		case opLoopUnless:
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if v.Type != ast.PrimitiveTypeBool {
+				context.Raise(ast.ExecutionError{
+					Class:        ast.TypeErr,
+					CreatingNode: node,
+					Text:         "Non-bool used as loop conditional: " + v.Type.String(),
+				})
+				pc = int(in.arg) - 1
+			} else if !v.Bool {
+				pc = int(in.arg) - 1
+			}
+
+		case opReturn:
+			ret := *stack[len(stack)-1]
+			ret.IsReturn = false
+			return &ret, true
+
+		case opCallee:
+			context.Step(node)
+			if !node.(*ast.FunctionCall).Callee(context, stack[len(stack)-1]) {
+				stack[len(stack)-1] = undefined()
+				pc = int(in.arg) - 1
+			}
+
+		case opCall:
+			n := node.(*ast.FunctionCall)
+			args := make([]*ast.Variant, in.arg)
+			copy(args, stack[len(stack)-int(in.arg):])
+			stack = stack[:len(stack)-int(in.arg)]
+			fp := stack[len(stack)-1]
+			if args, ok := n.Bind(context, fp, args); ok {
+				stack[len(stack)-1] = f.call(context, n, fp, args)
+			} else {
+				stack[len(stack)-1] = undefined()
+			}
+
+		case opTuple:
+			context.Step(node)
+			values := stack[len(stack)-int(in.arg):]
+			ret := &ast.Variant{}
+			t := ast.TupleType{}
+			for _, v := range values {
+				v = v.Copy() //values are assigned or returned, so are copied
+				t.Types = append(t.Types, v.Type)
+				ret.VectorData = append(ret.VectorData, v)
+			}
+			ret.Type = t
+			stack = append(stack[:len(stack)-int(in.arg)], ret)
+
+		case opSlice:
+			context.Step(node)
+			values := make([]*ast.Variant, in.arg)
+			for i, v := range stack[len(stack)-int(in.arg):] {
+				values[i] = v.Copy()
+			}
+			stack = append(stack[:len(stack)-int(in.arg)], &ast.Variant{
+				Type:       ast.ComplexTypeSlice,
+				VectorData: values,
+			})
+
+		case opArray:
+			context.Step(node)
+			values, ok := node.(*ast.ArrayLiteral).Alloc(context, stack[len(stack)-1])
+			if !ok {
+				stack[len(stack)-1] = undefined()
+				pc = int(in.arg) - 1
+				break
+			}
+			stack[len(stack)-1] = &ast.Variant{
+				Type:       ast.ComplexTypeArray,
+				VectorData: values,
+			}
+
+		case opSetElem:
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1].VectorData[in.arg] = v.Copy()
+
+		case opStruct:
+			context.Step(node)
+			values := stack[len(stack)-int(in.arg):]
+			stack = append(stack[:len(stack)-int(in.arg)], structLiteral(context, node.(*ast.StructLiteral), values))
+
+		case opUnpack:
+			n := node.(*ast.MultiAssign)
+			tuple = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if tuple.Type.Kind() != ast.ComplexTypeTuple || len(tuple.VectorData) != len(n.Variables) {
+				context.Raise(ast.ExecutionError{
+					Class:        ast.TypeErr,
+					CreatingNode: n,
+					Text:         "Assignment mismatch: " + strconv.Itoa(len(n.Variables)) + " variables but value has type " + tuple.Type.String(),
+				})
+				pc = int(in.arg) - 1
+			}
+
+		case opElem:
+			stack = append(stack, tuple.VectorData[in.arg])
+
+		case opBuiltin:
+			context.Step(node)
+			args := make([]*ast.Variant, in.arg)
+			copy(args, stack[len(stack)-int(in.arg):])
+			stack = append(stack[:len(stack)-int(in.arg)], node.(*ast.BuiltinCall).Apply(context, args))
+
+		case opRange:
+			base, ok := node.(*ast.RangeStmt).Range(context, stack[len(stack)-1])
+			if !ok {
+				stack = stack[:len(stack)-1]
+				pc = int(in.arg) - 1
+				break
+			}
+			stack[len(stack)-1] = base
+			stack = append(stack, intValue(0))
+
+		case opNext:
+			base, i := stack[len(stack)-2], stack[len(stack)-1]
+			key, value, ok := node.(*ast.RangeStmt).Next(context, base, int(i.Int))
+			if !ok {
+				stack = stack[:len(stack)-2]
+				pc = int(in.arg) - 1
+				break
+			}
+			stack[len(stack)-1] = intValue(i.Int + 1)
+			if value == nil {
+				value = undefined()
+			}
+			stack = append(stack, value, key)
+		}
+	}
+	return undefined(), false
+}
+
+// binary performs the operation n on l and r. Operations on integers are performed directly, and any other operation
+// as it is by the tree walker.
+func binary(context *ast.ExecContext, n *ast.BinaryOp, l, r *ast.Variant) *ast.Variant {
+	if l.Type != ast.PrimitiveTypeInt || r.Type != ast.PrimitiveTypeInt {
+		return n.Apply(context, l, r)
+	}
+	switch n.Op {
+	case ast.BinOpAdd:
+		return intValue(l.Int + r.Int)
+	case ast.BinOpSub:
+		return intValue(l.Int - r.Int)
+	case ast.BinOpMul:
+		return intValue(l.Int * r.Int)
+	case ast.BinOpEquality:
+		return boolValue(l.Int == r.Int)
+	case ast.BinOpNotEquality:
+		return boolValue(l.Int != r.Int)
+	}
+	return n.Apply(context, l, r)
+}
+
+// Values on the operand stack are never modified in place, as they are copied when they are assigned, so the results
+// of operations on integers and booleans can share preallocated values.
+var (
+	smallInts  [1024 + 128]ast.Variant // the integers -128 to 1023
+	falseValue = &ast.Variant{Type: ast.PrimitiveTypeBool, Bool: false}
+	trueValue  = &ast.Variant{Type: ast.PrimitiveTypeBool, Bool: true}
+)
+
+func init() {
+	for i := range smallInts {
+		smallInts[i] = ast.Variant{Type: ast.PrimitiveTypeInt, Int: int64(i - 128)}
+	}
+}
+
+func boolValue(b bool) *ast.Variant {
+	if b {
+		return trueValue
+	}
+	return falseValue
+}
+
+func intValue(i int64) *ast.Variant {
+	if i >= -128 && i < 1024 {
+		return &smallInts[i+128]
+	}
+	return &ast.Variant{Type: ast.PrimitiveTypeInt, Int: i}
+}
+
+// structLiteral returns the struct initialized by n, given the values of the fields it sets in the order they are
+// declared. Other fields are set to their default value.
+func structLiteral(context *ast.ExecContext, n *ast.StructLiteral, values []*ast.Variant) *ast.Variant {
+	o := &ast.Variant{
+		Type:           n.Type,
+		NamedData:      map[string]*ast.Variant{},
+		EmbeddedFields: n.Type.EmbeddedFields(),
+	}
+	for _, field := range n.Type.Fields {
+		if n.Values[field.Ident] != nil {
+			o.NamedData[field.Ident] = values[0].Copy()
+			values = values[1:]
+			continue
+		}
+		var err error
+		o.NamedData[field.Ident], err = context.DefaultValue(n, field.Type)
+		if err != nil {
+			context.Raise(ast.ExecutionError{
+				Class:        ast.InternalErr,
+				CreatingNode: n,
+				Text:         "Failed to create default value to populate field '" + field.Ident + "' with type: " + field.Type.String(),
+			})
+		}
+	}
+	return o
+}
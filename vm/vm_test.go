@@ -0,0 +1,349 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/twitchyliquid64/harsh/ast"
+	"github.com/twitchyliquid64/harsh/compiler"
+)
+
+const testProgram = `package test
+
+type point struct {
+	X int
+	Y int
+}
+
+var counter int
+
+func fib(n int) int {
+	if n == 0 || n == 1 {
+		return n
+	}
+	return fib(n - 1) + fib(n - 2)
+}
+
+func Fib() int {
+	return fib(20)
+}
+
+func Sum() int {
+	total := 0
+	for i := 0; i != 1000; i = i + 1 {
+		total = total + i * 2 % 7
+	}
+	return total
+}
+
+func Arrays() int {
+	a := [3]int{1, 2, 3}
+	b := a
+	b[0] = 10
+	s := []int{4, 5}
+	t := s
+	t[1] = a[2] + b[0]
+	return a[0] + b[0] + s[1]
+}
+
+func Structs() int {
+	p := point{X: 1}
+	q := p
+	q.Y = 5
+	return p.X + p.Y + q.Y
+}
+
+func pair(a int) (int, string) {
+	return a * 2, "x"
+}
+
+func Multi() string {
+	n, s := pair(4)
+	counter = counter + n
+	if n == 8 {
+		return s + "y"
+	} else {
+		return s
+	}
+}
+
+func Shadow() int {
+	x := 1
+	if true {
+		x := 2
+		x = x + 1
+	}
+	for i := 0; i != 3; i = i + 1 {
+		x = x + i
+		y := x
+		x = y
+	}
+	return x
+}
+
+func Params(a int, b string) string {
+	a = a + 1
+	if a == 2 {
+		return b + b
+	}
+	return b
+}
+
+func Native() int {
+	return double(21) + counter
+}
+
+func Chan() int {
+	ch := make(chan int, 1)
+	ch <- 3
+	return <-ch
+}
+
+func CallsChan() int {
+	return Chan() + 1
+}
+
+func DivZero(d int) int {
+	return 10 / d
+}
+
+func Bounds(i int) int {
+	return [2]int{1, 2}[i]
+}
+
+func Types() int {
+	return 1 + "a"
+}
+
+func Forever() int {
+	for true {
+		counter = counter + 1
+	}
+	return 0
+}
+
+func deep(n int) int {
+	return deep(n + 1)
+}
+
+func Deep() int {
+	return deep(0)
+}
+
+func Literal() point {
+	return point{Y: 2}
+}
+
+func Slices() int {
+	var xs []int
+	for i := 0; i != 5; i = i + 1 {
+		xs = append(xs, i * i)
+	}
+	ys := append([]int{}, xs...)
+	ys[0] = 7
+	total := len(xs) * 100 + len(ys) + len("abc")
+	for i, x := range xs {
+		total = total + i * x + ys[i]
+	}
+	for range ys {
+		total = total + 1
+	}
+	return total
+}
+
+func RangeArray() int {
+	a := [3]int{1, 2, 3}
+	total := 0
+	for _, v := range a {
+		a[2] = 10
+		total = total + v
+	}
+	for i := range a {
+		total = total + i
+	}
+	return total * 100 + a[2]
+}
+
+func RangeReturn() string {
+	for _, s := range []string{"a", "b", "c"} {
+		if s == "b" {
+			return s
+		}
+	}
+	return ""
+}
+
+func RangeInvalid(n int) int {
+	for i := range n {
+		return i
+	}
+	return len(n)
+}
+`
+
+func parse(t testing.TB) *compiler.Context {
+	c := compiler.NewContext()
+	if err := c.RegisterFunc("double", func(i int) int { return i * 2 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Parse("test.go", testProgram); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Errors) > 0 {
+		t.Fatal(c.Errors)
+	}
+	return c
+}
+
+// execute runs code as the named function of c, with the given arguments.
+func execute(c *compiler.Context, code ast.Node, args ast.Namespace, failFast bool) (*ast.Variant, []ast.ExecutionError) {
+	context := &ast.ExecContext{
+		IsFuncContext:     true,
+		FunctionNamespace: ast.Namespace{},
+		GlobalNamespace:   c.Globals,
+		MaxSteps:          1000000,
+		MaxDepth:          100,
+		FailFast:          failFast,
+	}
+	for name, arg := range args {
+		context.FunctionNamespace[name] = arg.Copy()
+	}
+	ret := ast.ExecMain(code, context)
+	return ret, context.Errors
+}
+
+// sameResult returns true if got and want have the same type and value, and were both returned or not.
+func sameResult(got, want *ast.Variant) bool {
+	if got.Type.String() != want.Type.String() || got.IsReturn != want.IsReturn {
+		return false
+	}
+	return got.Type == ast.PrimitiveTypeUndefined || got.Equal(want)
+}
+
+func TestMatchesTreeWalker(t *testing.T) {
+	for _, tc := range []struct {
+		fn   string
+		args ast.Namespace
+	}{
+		{"Fib", nil},
+		{"Sum", nil},
+		{"Arrays", nil},
+		{"Structs", nil},
+		{"Multi", nil},
+		{"Shadow", nil},
+		{"Params", ast.Namespace{"a": ast.MakeVariant(1), "b": ast.MakeVariant("ab")}},
+		{"Native", nil},
+		{"CallsChan", nil},
+		{"DivZero", ast.Namespace{"d": ast.MakeVariant(0)}},
+		{"Bounds", ast.Namespace{"i": ast.MakeVariant(-1)}},
+		{"Types", nil},
+		{"Forever", nil},
+		{"Deep", nil},
+		{"Literal", nil},
+		{"Slices", nil},
+		{"RangeArray", nil},
+		{"RangeReturn", nil},
+		{"RangeInvalid", ast.Namespace{"n": ast.MakeVariant(3)}},
+	} {
+		for _, failFast := range []bool{true, false} {
+			walked, compiled := parse(t), parse(t)
+			fnType := compiled.Globals[tc.fn].Type.(ast.FunctionType)
+			f, err := Compile(fnType)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.fn, err)
+			}
+
+			want, wantErrs := execute(walked, walked.Globals[tc.fn].Type.(ast.FunctionType).Code, tc.args, failFast)
+			got, gotErrs := execute(compiled, f, tc.args, failFast)
+			if !sameResult(got, want) {
+				t.Errorf("%s: got %+v, want %+v", tc.fn, got, want)
+			}
+			if len(gotErrs) != len(wantErrs) {
+				t.Errorf("%s: got errors %v, want %v", tc.fn, gotErrs, wantErrs)
+				continue
+			}
+			for i := range gotErrs {
+				if gotErrs[i].Class != wantErrs[i].Class || gotErrs[i].Text != wantErrs[i].Text {
+					t.Errorf("%s: got error %v, want %v", tc.fn, gotErrs[i], wantErrs[i])
+				}
+				if gotErrs[i].Class != ast.BudgetExceededErr && gotErrs[i].StackTrace() != wantErrs[i].StackTrace() {
+					t.Errorf("%s: got stack trace\n%s\nwant\n%s", tc.fn, gotErrs[i].StackTrace(), wantErrs[i].StackTrace())
+				}
+			}
+			if got, want := compiled.Globals["counter"].Int, walked.Globals["counter"].Int; got != want {
+				t.Errorf("%s: counter is %d, want %d", tc.fn, got, want)
+			}
+		}
+	}
+}
+
+func TestCompileUnsupported(t *testing.T) {
+	c := parse(t)
+	_, err := Compile(c.Globals["Chan"].Type.(ast.FunctionType))
+	if _, ok := err.(CompileError); !ok {
+		t.Fatalf("Expected a CompileError, got %v", err)
+	}
+	if want := "test.go:88:2: Cannot compile SendStmt"; err.Error() != want {
+		t.Errorf("Got error %q, want %q", err, want)
+	}
+}
+
+func TestCompileResolvesCode(t *testing.T) {
+	x := func() *ast.VariableReference { return &ast.VariableReference{Name: "x"} }
+	body := &ast.StatementList{Stmts: []ast.Node{
+		&ast.Assign{NewLocal: true, Variable: x(), Value: &ast.VariableReference{Name: "a"}},
+		&ast.ReturnStmt{Expr: &ast.BinaryOp{Op: ast.BinOpAdd, LHS: x(), RHS: &ast.VariableReference{Name: "g"}}},
+	}}
+	f, err := Compile(ast.FunctionType{
+		Parameters: []ast.TypeKind{ast.NamedType{Ident: "a", Type: ast.PrimitiveTypeInt}},
+		ReturnType: ast.PrimitiveTypeInt,
+		Code:       body,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.Layout == nil || body.Layout.Slots != 2 {
+		t.Fatalf("Expected the code to be resolved to 2 slots, got %+v", body.Layout)
+	}
+
+	c := parse(t)
+	c.Globals["g"] = ast.MakeVariant(5)
+	v, errs := execute(c, f, ast.Namespace{"a": ast.MakeVariant(2)}, true)
+	if len(errs) > 0 || v.Int != 7 {
+		t.Errorf("Expected 7, got %+v %v", v, errs)
+	}
+}
+
+func TestStructLiteralKeepsType(t *testing.T) {
+	c := parse(t)
+	f, err := Compile(c.Globals["Literal"].Type.(ast.FunctionType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, errs := execute(c, f, nil, true)
+	if st, ok := v.Type.(ast.StructType); len(errs) > 0 || !ok || st.Name != "point" {
+		t.Errorf("Expected a value of struct type point, got %+v %v", v, errs)
+	}
+}
+
+func benchmark(b *testing.B, name string, compile bool) {
+	c := parse(b)
+	var code ast.Node = c.Globals[name].Type.(ast.FunctionType).Code
+	if compile {
+		f, err := Compile(c.Globals[name].Type.(ast.FunctionType))
+		if err != nil {
+			b.Fatal(err)
+		}
+		code = f
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, errs := execute(c, code, nil, true); len(errs) > 0 {
+			b.Fatal(errs)
+		}
+	}
+}
+
+func BenchmarkFibTreeWalker(b *testing.B) { benchmark(b, "Fib", false) }
+func BenchmarkFibVM(b *testing.B)         { benchmark(b, "Fib", true) }
+func BenchmarkSumTreeWalker(b *testing.B) { benchmark(b, "Sum", false) }
+func BenchmarkSumVM(b *testing.B)         { benchmark(b, "Sum", true) }